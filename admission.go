@@ -0,0 +1,110 @@
+package ttlmap
+
+import (
+	"errors"
+)
+
+// TinyLFUAdmission makes a full map reject new elements that are not used
+// more often than the element they would evict. Key frequencies, including
+// reads of missing keys, are estimated with a count-min sketch sized for the
+// capacity at creation, and halved every 10 x capacity accesses so the
+// estimate follows recent traffic. Writes of rejected elements return
+// ErrRejected. Overwriting a live element is never rejected, even if the
+// new value needs more room, so the key is not lost. Reads take the write lock of a concurrent map to record the
+// access.
+func TinyLFUAdmission() TtlMapOption {
+	return func(m *TtlMap) error {
+		m.sketch = newCountMinSketch(m.capacity)
+		return nil
+	}
+}
+
+// ErrRejected is returned by writes to a map created with TinyLFUAdmission
+// when the admission filter keeps the element out of the full map
+var ErrRejected = errors.New("Element rejected by admission filter")
+
+const (
+	sketchDepth      = 4
+	sketchMinWidth   = 16
+	sketchMaxCounter = 15
+	// sketchSamples is the number of accesses per unit of capacity after
+	// which the counters are halved
+	sketchSamples = 10
+)
+
+// countMinSketch estimates key frequencies in constant space, estimates
+// may be too high because of hash collisions but are never too low
+type countMinSketch struct {
+	rows      [sketchDepth][]uint8
+	mask      uint64
+	additions int
+	resetAt   int
+}
+
+func newCountMinSketch(capacity int) *countMinSketch {
+	width := sketchMinWidth
+	for width < capacity {
+		width *= 2
+	}
+	s := &countMinSketch{
+		mask:    uint64(width - 1),
+		resetAt: sketchSamples * capacity,
+	}
+	for i := range s.rows {
+		s.rows[i] = make([]uint8, width)
+	}
+	return s
+}
+
+// indexes derives one counter index per row from a single hash, an inlined
+// 64 bit FNV-1a like hashKey
+func (s *countMinSketch) indexes(key string) [sketchDepth]uint64 {
+	sum := uint64(14695981039346656037)
+	for i := 0; i < len(key); i += 1 {
+		sum ^= uint64(key[i])
+		sum *= 1099511628211
+	}
+	h1, h2 := sum&0xffffffff, sum>>32
+	var indexes [sketchDepth]uint64
+	for i := range indexes {
+		indexes[i] = (h1 + uint64(i)*h2) & s.mask
+	}
+	return indexes
+}
+
+func (s *countMinSketch) increment(key string) {
+	for i, index := range s.indexes(key) {
+		if s.rows[i][index] < sketchMaxCounter {
+			s.rows[i][index] += 1
+		}
+	}
+	s.additions += 1
+	if s.additions >= s.resetAt {
+		s.reset()
+	}
+}
+
+func (s *countMinSketch) estimate(key string) uint8 {
+	min := uint8(sketchMaxCounter)
+	for i, index := range s.indexes(key) {
+		if s.rows[i][index] < min {
+			min = s.rows[i][index]
+		}
+	}
+	return min
+}
+
+// reset halves all counters to age out old accesses
+func (s *countMinSketch) reset() {
+	for _, row := range s.rows {
+		for i := range row {
+			row[i] /= 2
+		}
+	}
+	s.additions /= 2
+}
+
+// admit reports whether the new key should replace the victim
+func (s *countMinSketch) admit(key, victimKey string) bool {
+	return s.estimate(key) > s.estimate(victimKey)
+}
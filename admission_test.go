@@ -0,0 +1,111 @@
+package ttlmap
+
+import (
+	"fmt"
+	"testing"
+
+	. "gopkg.in/check.v1"
+)
+
+func (s *TestSuite) TestTinyLFUAdmission(c *C) {
+	m := s.newMap(2, TinyLFUAdmission())
+
+	m.Set("a", 1, 10)
+	m.Set("b", 2, 10)
+	m.Get("a")
+	m.Get("b")
+
+	// One hit wonders are not admitted into a full map
+	for i := 0; i < 10; i += 1 {
+		c.Assert(m.Set(fmt.Sprintf("x%d", i), i, 10), Equals, ErrRejected)
+	}
+	c.Assert(m.Contains("a"), Equals, true)
+	c.Assert(m.Contains("b"), Equals, true)
+	c.Assert(m.Len(), Equals, 2)
+
+	// Keys requested often enough are admitted, misses count as well
+	for i := 0; i < 3; i += 1 {
+		m.Get("c")
+	}
+	m.Set("c", 3, 10)
+	c.Assert(m.Contains("c"), Equals, true)
+	c.Assert(m.Len(), Equals, 2)
+}
+
+func (s *TestSuite) TestTinyLFUAdmissionRejected(c *C) {
+	m := s.newMap(1, TinyLFUAdmission())
+	m.Set("a", 1, 10)
+	m.Get("a")
+
+	set, err := m.SetIfAbsent("b", 2, 10)
+	c.Assert(err, Equals, ErrRejected)
+	c.Assert(set, Equals, false)
+
+	actual, loaded, err := m.GetOrSet("b", 2, 10)
+	c.Assert(err, Equals, ErrRejected)
+	c.Assert(actual, IsNil)
+	c.Assert(loaded, Equals, false)
+	c.Assert(m.Contains("b"), Equals, false)
+	c.Assert(m.Contains("a"), Equals, true)
+}
+
+func (s *TestSuite) TestTinyLFUAdmissionExpired(c *C) {
+	m := s.newMap(1, TinyLFUAdmission())
+
+	m.Set("a", 1, 1)
+	m.Get("a")
+	s.advanceSeconds(1)
+
+	// Expired elements make room without an admission check
+	m.Set("b", 2, 10)
+	c.Assert(m.Contains("b"), Equals, true)
+}
+
+func (s *TestSuite) TestTinyLFUAdmissionOverwrite(c *C) {
+	m := s.newMap(10, TinyLFUAdmission(), MaxCost(10), WithSizer(func(key string, value interface{}) int64 {
+		return int64(value.(int))
+	}))
+	m.Set("a", 2, 10)
+	m.Set("b", 5, 10)
+	for i := 0; i < 5; i += 1 {
+		m.Get("b")
+	}
+
+	// Growing a live element evicts rather than losing the key
+	c.Assert(m.Set("a", 6, 10), IsNil)
+	value, ok := m.Get("a")
+	c.Assert(ok, Equals, true)
+	c.Assert(value, Equals, 6)
+	c.Assert(m.Contains("b"), Equals, false)
+
+	// New keys are still subject to admission
+	c.Assert(m.Set("c", 5, 10), Equals, ErrRejected)
+	c.Assert(m.Contains("a"), Equals, true)
+}
+
+func (s *TestSuite) TestCountMinSketchAllocations(c *C) {
+	sketch := newCountMinSketch(4)
+	allocs := testing.AllocsPerRun(100, func() {
+		sketch.increment("some key")
+		sketch.estimate("some key")
+	})
+	c.Assert(allocs, Equals, float64(0))
+}
+
+func (s *TestSuite) TestCountMinSketch(c *C) {
+	sketch := newCountMinSketch(4)
+	c.Assert(sketch.rows[0], HasLen, sketchMinWidth)
+	c.Assert(sketch.estimate("a"), Equals, uint8(0))
+
+	for i := 0; i < 20; i += 1 {
+		sketch.increment("a")
+	}
+	c.Assert(sketch.estimate("a"), Equals, uint8(sketchMaxCounter))
+
+	// 40 additions halve the counters
+	for i := 0; i < 20; i += 1 {
+		sketch.increment("b")
+	}
+	c.Assert(sketch.estimate("a") < sketchMaxCounter, Equals, true)
+	c.Assert(sketch.additions, Equals, 20)
+}
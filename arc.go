@@ -0,0 +1,181 @@
+package ttlmap
+
+import (
+	"container/list"
+)
+
+// arc implements the adaptive replacement cache policy. Resident elements
+// live in recent (seen once) and frequent (seen at least twice), the keys of
+// elements evicted from either list are remembered in the matching ghost
+// list. A hit on a ghost key moves the target size of recent towards the
+// list the key was evicted from.
+type arc struct {
+	capacity *int
+	// target is the desired number of elements in recent
+	target         int
+	recent         *list.List
+	frequent       *list.List
+	recentGhosts   *ghostList
+	frequentGhosts *ghostList
+	// evictingEl is being evicted, its key is remembered once it is removed
+	evictingEl *mapElement
+}
+
+type arcEntry struct {
+	mapEl    *mapElement
+	frequent bool
+}
+
+func newARC(capacity *int) *arc {
+	return &arc{
+		capacity:       capacity,
+		recent:         list.New(),
+		frequent:       list.New(),
+		recentGhosts:   newGhostList(),
+		frequentGhosts: newGhostList(),
+	}
+}
+
+func (a *arc) add(mapEl *mapElement) {
+	c := *a.capacity
+	switch {
+	case a.recentGhosts.remove(mapEl.key):
+		a.target = minInt(c, a.target+maxInt(a.frequentGhosts.len()/maxInt(a.recentGhosts.len(), 1), 1))
+		a.pushFrequent(mapEl)
+		return
+	case a.frequentGhosts.remove(mapEl.key):
+		a.target = maxInt(0, a.target-maxInt(a.recentGhosts.len()/maxInt(a.frequentGhosts.len(), 1), 1))
+		a.pushFrequent(mapEl)
+		return
+	}
+	mapEl.evictEl = a.recent.PushFront(&arcEntry{mapEl: mapEl})
+	a.trimGhosts()
+}
+
+func (a *arc) pushFrequent(mapEl *mapElement) {
+	mapEl.evictEl = a.frequent.PushFront(&arcEntry{mapEl: mapEl, frequent: true})
+}
+
+func (a *arc) access(mapEl *mapElement) {
+	entry := mapEl.evictEl.Value.(*arcEntry)
+	if entry.frequent {
+		a.frequent.MoveToFront(mapEl.evictEl)
+		return
+	}
+	a.recent.Remove(mapEl.evictEl)
+	a.pushFrequent(mapEl)
+}
+
+func (a *arc) remove(mapEl *mapElement) {
+	entry := mapEl.evictEl.Value.(*arcEntry)
+	if entry.frequent {
+		a.frequent.Remove(mapEl.evictEl)
+	} else {
+		a.recent.Remove(mapEl.evictEl)
+	}
+	mapEl.evictEl = nil
+
+	// Only evicted keys are remembered, not expired or deleted ones
+	if mapEl != a.evictingEl {
+		return
+	}
+	a.evictingEl = nil
+	if entry.frequent {
+		a.frequentGhosts.push(mapEl.key)
+	} else {
+		a.recentGhosts.push(mapEl.key)
+	}
+	a.trimGhosts()
+}
+
+func (a *arc) victim() *mapElement {
+	var e *list.Element
+	if a.recent.Len() > 0 && (a.recent.Len() > a.target || a.frequent.Len() == 0) {
+		e = a.recent.Back()
+	} else {
+		e = a.frequent.Back()
+	}
+	if e == nil {
+		return nil
+	}
+	return e.Value.(*arcEntry).mapEl
+}
+
+func (a *arc) evicting(mapEl *mapElement) {
+	a.evictingEl = mapEl
+}
+
+// trimGhosts keeps recent and its ghosts within capacity and all lists
+// within twice the capacity
+func (a *arc) trimGhosts() {
+	c := *a.capacity
+	for a.recent.Len()+a.recentGhosts.len() > c && a.recentGhosts.len() > 0 {
+		a.recentGhosts.removeOldest()
+	}
+	for a.recent.Len()+a.frequent.Len()+a.recentGhosts.len()+a.frequentGhosts.len() > 2*c &&
+		a.frequentGhosts.len() > 0 {
+		a.frequentGhosts.removeOldest()
+	}
+}
+
+func (a *arc) tracksAccess() bool {
+	return true
+}
+
+func (a *arc) clear() {
+	a.target = 0
+	a.recent.Init()
+	a.frequent.Init()
+	a.recentGhosts = newGhostList()
+	a.frequentGhosts = newGhostList()
+	a.evictingEl = nil
+}
+
+// ghostList remembers keys in the order they were pushed
+type ghostList struct {
+	order *list.List
+	keys  map[string]*list.Element
+}
+
+func newGhostList() *ghostList {
+	return &ghostList{order: list.New(), keys: make(map[string]*list.Element)}
+}
+
+func (g *ghostList) len() int {
+	return g.order.Len()
+}
+
+func (g *ghostList) push(key string) {
+	g.remove(key)
+	g.keys[key] = g.order.PushFront(key)
+}
+
+func (g *ghostList) remove(key string) bool {
+	e, ok := g.keys[key]
+	if !ok {
+		return false
+	}
+	g.order.Remove(e)
+	delete(g.keys, key)
+	return true
+}
+
+func (g *ghostList) removeOldest() {
+	if e := g.order.Back(); e != nil {
+		g.remove(e.Value.(string))
+	}
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
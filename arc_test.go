@@ -0,0 +1,53 @@
+package ttlmap
+
+import (
+	"fmt"
+
+	. "gopkg.in/check.v1"
+)
+
+func (s *TestSuite) TestEvictARCScanResistance(c *C) {
+	m := s.newMap(3, Eviction(EvictARC))
+
+	m.Set("a", 1, 10)
+	m.Set("b", 2, 10)
+	m.Get("a")
+	m.Get("b")
+
+	// A scan of one hit keys only evicts other one hit keys
+	for i := 0; i < 10; i += 1 {
+		m.Set(fmt.Sprintf("x%d", i), i, 10)
+	}
+	c.Assert(m.Contains("a"), Equals, true)
+	c.Assert(m.Contains("b"), Equals, true)
+	c.Assert(m.Contains("x9"), Equals, true)
+	c.Assert(m.Len(), Equals, 3)
+}
+
+func (s *TestSuite) TestEvictARCGhostHit(c *C) {
+	m := s.newMap(2, Eviction(EvictARC))
+	a := m.evictor.(*arc)
+
+	m.Set("a", 1, 10)
+	m.Get("a")
+	m.Set("b", 2, 10)
+	m.Set("c", 3, 10)
+	c.Assert(m.Contains("b"), Equals, false)
+	c.Assert(a.recentGhosts.len(), Equals, 1)
+
+	// b was evicted too early, recent is given more room
+	m.Set("b", 2, 10)
+	c.Assert(a.target, Equals, 1)
+	c.Assert(m.Contains("a"), Equals, true)
+	c.Assert(m.Contains("b"), Equals, true)
+	c.Assert(m.Contains("c"), Equals, false)
+	c.Assert(a.frequent.Len(), Equals, 2)
+
+	// Deleted keys are not remembered
+	m.Delete("a")
+	c.Assert(a.frequentGhosts.len(), Equals, 0)
+
+	m.Clear()
+	c.Assert(a.target, Equals, 0)
+	c.Assert(a.recent.Len()+a.frequent.Len(), Equals, 0)
+}
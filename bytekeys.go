@@ -0,0 +1,115 @@
+package ttlmap
+
+// The ByBytes methods take keys as byte slices, e.g. read from the network.
+// Lookups index the elements with string(key) directly, which Go compiles to
+// a lookup that does not copy the key, so reads and updates of existing keys
+// do not allocate. The key is only copied when a new element is inserted.
+// Maps with LockFreeReads, HotKeyCache or TinyLFUAdmission convert the key
+// and take the string paths, their indexes keep the keys.
+
+// GetByBytes is Get with a byte slice key
+func (m *TtlMap) GetByBytes(key []byte) (interface{}, bool) {
+	if m.byteKeysConverted() {
+		return m.Get(string(key))
+	}
+	start := m.getStarted()
+	value, ok := m.lookupByBytes(key)
+	m.gotten(start, ok)
+	return value, ok
+}
+
+func (m *TtlMap) lookupByBytes(key []byte) (interface{}, bool) {
+	value, stored, mapEl, expired := m.lockNGetByBytes(key)
+	if mapEl == nil {
+		return nil, false
+	}
+	if expired {
+		value, _, live := m.lockNExpire(stored)
+		return value, live
+	}
+	return value, true
+}
+
+// ContainsByBytes is Contains with a byte slice key
+func (m *TtlMap) ContainsByBytes(key []byte) bool {
+	if m.byteKeysConverted() {
+		return m.Contains(string(key))
+	}
+	if m.mutex != nil {
+		m.mutex.RLock()
+		defer m.mutex.RUnlock()
+	}
+
+	mapEl, expired := m.getByBytes(key)
+	return mapEl != nil && !expired
+}
+
+// SetByBytes is Set with a byte slice key, the key is copied if there is no
+// element with it yet
+func (m *TtlMap) SetByBytes(key []byte, value interface{}, ttlSeconds int) error {
+	expiryTime, err := m.secondsToExpiryTime(ttlSeconds)
+	if err != nil {
+		return err
+	}
+	if m.mutex != nil {
+		m.mutex.Lock()
+		defer m.mutex.Unlock()
+	}
+
+	if mapEl, _ := m.getByBytes(key); mapEl != nil {
+		return m.set(mapEl.key, value, expiryTime)
+	}
+	return m.set(string(key), value, expiryTime)
+}
+
+// DeleteByBytes is Delete with a byte slice key
+func (m *TtlMap) DeleteByBytes(key []byte) bool {
+	if m.mutex != nil {
+		m.mutex.Lock()
+		defer m.mutex.Unlock()
+	}
+
+	mapEl, expired := m.getByBytes(key)
+	if mapEl == nil {
+		return false
+	}
+	m.drop(mapEl, expired)
+	return !expired
+}
+
+// byteKeysConverted reports whether the ByBytes methods convert the key and
+// call their string counterparts
+func (m *TtlMap) byteKeysConverted() bool {
+	return m.readIndex != nil || m.hot != nil || m.sketch != nil
+}
+
+// lockNGetByBytes is lockNGet with a byte slice key, it returns the key the
+// element is stored with for lockNExpire
+func (m *TtlMap) lockNGetByBytes(key []byte) (value interface{}, stored string, mapEl *mapElement, expired bool) {
+	if m.mutex != nil {
+		if m.writesOnRead() {
+			m.mutex.Lock()
+			defer m.mutex.Unlock()
+		} else {
+			m.mutex.RLock()
+			defer m.mutex.RUnlock()
+		}
+	}
+
+	mapEl, expired = m.getByBytes(key)
+	if mapEl == nil {
+		return nil, "", nil, false
+	}
+	if !expired {
+		m.access(mapEl)
+	}
+	return mapEl.value, mapEl.key, mapEl, expired
+}
+
+func (m *TtlMap) getByBytes(key []byte) (*mapElement, bool) {
+	mapEl, ok := m.elements[string(key)]
+	if !ok {
+		return nil, false
+	}
+	return mapEl, mapEl.heapEl.Priority <= m.now()
+}
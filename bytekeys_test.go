@@ -0,0 +1,65 @@
+package ttlmap
+
+import (
+	"testing"
+
+	. "gopkg.in/check.v1"
+)
+
+func (s *TestSuite) TestByteKeys(c *C) {
+	m := s.newMap(10)
+
+	key := []byte("a")
+	c.Assert(m.SetByBytes(key, 1, 1), IsNil)
+	key[0] = 'b'
+	// The key was copied on insert
+	c.Assert(m.Contains("a"), Equals, true)
+	c.Assert(m.ContainsByBytes(key), Equals, false)
+
+	value, exists := m.GetByBytes([]byte("a"))
+	c.Assert(exists, Equals, true)
+	c.Assert(value, Equals, 1)
+
+	c.Assert(m.SetByBytes([]byte("a"), 2, 5), IsNil)
+	value, _ = m.Get("a")
+	c.Assert(value, Equals, 2)
+
+	m.Set("c", 3, 1)
+	s.advanceSeconds(1)
+	_, exists = m.GetByBytes([]byte("c"))
+	c.Assert(exists, Equals, false)
+	c.Assert(m.Len(), Equals, 1)
+
+	c.Assert(m.DeleteByBytes([]byte("a")), Equals, true)
+	c.Assert(m.DeleteByBytes([]byte("a")), Equals, false)
+	c.Assert(m.SetByBytes([]byte("a"), 1, 0), NotNil)
+
+	hot := s.newMap(10, HotKeyCache(1))
+	hot.SetByBytes([]byte("a"), 1, 10)
+	value, _ = hot.GetByBytes([]byte("a"))
+	c.Assert(value, Equals, 1)
+}
+
+func (s *TestSuite) TestByteKeysAllocations(c *C) {
+	m := s.newMap(10)
+	m.Set("some:longer:key:read:from:the:network", 1, 10)
+	key := []byte("some:longer:key:read:from:the:network")
+
+	allocs := testing.AllocsPerRun(100, func() {
+		m.GetByBytes(key)
+		m.ContainsByBytes(key)
+		m.SetByBytes(key, 1, 10)
+	})
+	c.Assert(allocs, Equals, 0.0)
+}
+
+func BenchmarkGetByBytes(b *testing.B) {
+	m, _ := NewConcurrent(100)
+	m.Set("some:longer:key:read:from:the:network", 1, 10)
+	key := []byte("some:longer:key:read:from:the:network")
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i += 1 {
+		m.GetByBytes(key)
+	}
+}
@@ -0,0 +1,117 @@
+package ttlmap
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrComputePanicked is returned to the callers waiting on a GetOrCompute
+// call whose fn panicked
+var ErrComputePanicked = errors.New("Compute function panicked")
+
+// computation is a GetOrCompute call in flight, callers missing the same key
+// wait on it rather than calling fn again
+type computation struct {
+	done  chan struct{}
+	value interface{}
+	err   error
+}
+
+// GetOrCompute returns the value of the live element with the given key, or
+// calls fn and sets the value it returns with the given ttl. Concurrent misses
+// for the same key call fn only once, the other callers wait for it and share
+// its result. fn is called without holding the map lock, so it may access the
+// map. If fn returns an error nothing is set and all the waiting callers get
+// the error.
+func (m *TtlMap) GetOrCompute(key string, ttlSeconds int, fn func() (interface{}, error)) (interface{}, error) {
+	return m.GetOrComputeCtx(context.Background(), key, ttlSeconds, func(context.Context) (interface{}, error) {
+		return fn()
+	})
+}
+
+// GetOrComputeCtx is GetOrCompute with a context passed to fn. Callers
+// waiting for another caller's fn return the context error once their own
+// context is done. If fn fails with the error of the computing caller's
+// context, the waiting callers compute the value again instead of sharing the
+// error.
+func (m *TtlMap) GetOrComputeCtx(ctx context.Context, key string, ttlSeconds int, fn func(ctx context.Context) (interface{}, error)) (interface{}, error) {
+	expiryTime, err := m.secondsToExpiryTime(ttlSeconds)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if value, ok := m.Get(key); ok {
+			return value, nil
+		}
+
+		c, leader := m.startComputation(key)
+		if leader {
+			return m.compute(ctx, key, expiryTime, c, fn)
+		}
+		select {
+		case <-c.done:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		if c.err != context.Canceled && c.err != context.DeadlineExceeded {
+			return c.value, c.err
+		}
+	}
+}
+
+func (m *TtlMap) compute(ctx context.Context, key string, expiryTime int64, c *computation, fn func(ctx context.Context) (interface{}, error)) (interface{}, error) {
+	defer m.finishComputation(key, c)
+
+	// Another computation may have set the key after the miss, which was
+	// already counted
+	if value, ok := m.lookup(key); ok {
+		c.value = value
+		return value, nil
+	}
+
+	c.err = ErrComputePanicked
+	c.value, c.err = fn(ctx)
+	if c.err != nil {
+		c.value = nil
+		return nil, c.err
+	}
+	if c.err = m.lockNSet(key, c.value, expiryTime); c.err != nil {
+		return nil, c.err
+	}
+	return c.value, nil
+}
+
+// startComputation returns the computation in flight for the key, leader is
+// true if the caller registered it and has to compute the value
+func (m *TtlMap) startComputation(key string) (c *computation, leader bool) {
+	m.computeMutex.Lock()
+	defer m.computeMutex.Unlock()
+
+	if c := m.computing[key]; c != nil {
+		return c, false
+	}
+	if m.computing == nil {
+		m.computing = make(map[string]*computation)
+	}
+	c = &computation{done: make(chan struct{})}
+	m.computing[key] = c
+	return c, true
+}
+
+func (m *TtlMap) finishComputation(key string, c *computation) {
+	m.computeMutex.Lock()
+	delete(m.computing, key)
+	m.computeMutex.Unlock()
+	close(c.done)
+}
+
+func (m *TtlMap) lockNSet(key string, value interface{}, expiryTime int64) error {
+	if m.mutex != nil {
+		m.mutex.Lock()
+		defer m.mutex.Unlock()
+	}
+	return m.set(key, value, expiryTime)
+}
@@ -0,0 +1,118 @@
+package ttlmap
+
+import (
+	"errors"
+	"sync"
+
+	. "gopkg.in/check.v1"
+)
+
+func (s *TestSuite) TestGetOrCompute(c *C) {
+	m := s.newMap(10, RecordLatencies())
+
+	calls := 0
+	compute := func() (interface{}, error) {
+		calls += 1
+		return calls, nil
+	}
+
+	value, err := m.GetOrCompute("a", 1, compute)
+	c.Assert(err, IsNil)
+	c.Assert(value, Equals, 1)
+
+	value, err = m.GetOrCompute("a", 1, compute)
+	c.Assert(err, IsNil)
+	c.Assert(value, Equals, 1)
+	c.Assert(calls, Equals, 1)
+
+	// Every call counts as one lookup
+	stats := m.Stats()
+	c.Assert(stats.Hits, Equals, uint64(1))
+	c.Assert(stats.Misses, Equals, uint64(1))
+	c.Assert(stats.Latencies.Get.Count, Equals, uint64(2))
+
+	// An expired element is computed again
+	s.advanceSeconds(1)
+	value, err = m.GetOrCompute("a", 1, compute)
+	c.Assert(err, IsNil)
+	c.Assert(value, Equals, 2)
+
+	_, err = m.GetOrCompute("b", 0, compute)
+	c.Assert(err, Not(Equals), nil)
+}
+
+func (s *TestSuite) TestGetOrComputeError(c *C) {
+	m := s.newMap(10)
+
+	failed := errors.New("failed")
+	value, err := m.GetOrCompute("a", 1, func() (interface{}, error) {
+		return 1, failed
+	})
+	c.Assert(err, Equals, failed)
+	c.Assert(value, IsNil)
+	c.Assert(m.Contains("a"), Equals, false)
+	c.Assert(m.computing, HasLen, 0)
+}
+
+func (s *TestSuite) TestGetOrComputePanic(c *C) {
+	m := s.newMap(10)
+
+	func() {
+		defer func() {
+			c.Assert(recover(), Equals, "boom")
+		}()
+		m.GetOrCompute("a", 1, func() (interface{}, error) {
+			panic("boom")
+		})
+	}()
+	c.Assert(m.computing, HasLen, 0)
+
+	value, err := m.GetOrCompute("a", 1, func() (interface{}, error) {
+		return 1, nil
+	})
+	c.Assert(err, IsNil)
+	c.Assert(value, Equals, 1)
+}
+
+func (s *TestSuite) TestGetOrComputeDeduplicates(c *C) {
+	m := s.newMap(10)
+
+	calls := 0
+	started := make(chan struct{})
+	release := make(chan struct{})
+	compute := func() (interface{}, error) {
+		calls += 1
+		close(started)
+		<-release
+		// fn runs without the map lock
+		m.Len()
+		return "value", nil
+	}
+
+	const callers = 10
+	var wg sync.WaitGroup
+	values := make(chan interface{}, callers)
+	call := func() {
+		defer wg.Done()
+		value, err := m.GetOrCompute("a", 10, compute)
+		c.Assert(err, IsNil)
+		values <- value
+	}
+
+	// The other callers arrive while the first one is computing
+	wg.Add(callers)
+	go call()
+	<-started
+	for i := 1; i < callers; i += 1 {
+		go call()
+	}
+	close(release)
+	wg.Wait()
+	close(values)
+
+	c.Assert(calls, Equals, 1)
+	for value := range values {
+		c.Assert(value, Equals, "value")
+	}
+	c.Assert(m.computing, HasLen, 0)
+}
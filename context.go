@@ -0,0 +1,43 @@
+package ttlmap
+
+import (
+	"context"
+)
+
+// GetCtx is Get returning the context error instead if the context is done
+func (m *TtlMap) GetCtx(ctx context.Context, key string) (interface{}, bool, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, false, err
+	}
+	value, ok := m.Get(key)
+	return value, ok, nil
+}
+
+// SetCtx is Set returning the context error without setting anything if the
+// context is done
+func (m *TtlMap) SetCtx(ctx context.Context, key string, value interface{}, ttlSeconds int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return m.Set(key, value, ttlSeconds)
+}
+
+// WaitCallbacksCtx is WaitCallbacks returning the context error if the
+// context is done before all queued callbacks have run
+func (m *TtlMap) WaitCallbacksCtx(ctx context.Context) error {
+	d := m.dispatcher
+	if d == nil {
+		return nil
+	}
+	done := make(chan struct{})
+	go func() {
+		d.wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
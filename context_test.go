@@ -0,0 +1,107 @@
+package ttlmap
+
+import (
+	"context"
+	"errors"
+
+	. "gopkg.in/check.v1"
+)
+
+func (s *TestSuite) TestCtxVariants(c *C) {
+	m := s.newMap(10)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	c.Assert(m.SetCtx(ctx, "a", 1, 10), IsNil)
+	value, ok, err := m.GetCtx(ctx, "a")
+	c.Assert(err, IsNil)
+	c.Assert(ok, Equals, true)
+	c.Assert(value, Equals, 1)
+
+	cancel()
+	c.Assert(m.SetCtx(ctx, "b", 2, 10), Equals, context.Canceled)
+	c.Assert(m.Contains("b"), Equals, false)
+	_, ok, err = m.GetCtx(ctx, "a")
+	c.Assert(err, Equals, context.Canceled)
+	c.Assert(ok, Equals, false)
+}
+
+func (s *TestSuite) TestGetOrComputeCtx(c *C) {
+	m := s.newMap(10)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	value, err := m.GetOrComputeCtx(ctx, "a", 10, func(ctx context.Context) (interface{}, error) {
+		return 1, ctx.Err()
+	})
+	c.Assert(err, IsNil)
+	c.Assert(value, Equals, 1)
+
+	cancel()
+	_, err = m.GetOrComputeCtx(ctx, "b", 10, func(ctx context.Context) (interface{}, error) {
+		c.Fatal("fn called with a done context")
+		return nil, nil
+	})
+	c.Assert(err, Equals, context.Canceled)
+}
+
+func (s *TestSuite) TestGetOrComputeCtxAbandon(c *C) {
+	m := s.newMap(10)
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	leaderCtx, cancelLeader := context.WithCancel(context.Background())
+	leaderErr := make(chan error)
+	go func() {
+		_, err := m.GetOrComputeCtx(leaderCtx, "a", 10, func(ctx context.Context) (interface{}, error) {
+			close(started)
+			<-release
+			<-ctx.Done()
+			return nil, ctx.Err()
+		})
+		leaderErr <- err
+	}()
+	<-started
+
+	// A waiter gives up on the stuck computation with its own context
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := m.GetOrComputeCtx(ctx, "a", 10, func(ctx context.Context) (interface{}, error) {
+		return nil, errors.New("should not be called")
+	})
+	c.Assert(err, Equals, context.Canceled)
+
+	// A waiter with a live context computes the value itself once the
+	// leader is cancelled
+	waiterValue := make(chan interface{})
+	go func() {
+		value, err := m.GetOrComputeCtx(context.Background(), "a", 10, func(ctx context.Context) (interface{}, error) {
+			return 2, nil
+		})
+		c.Assert(err, IsNil)
+		waiterValue <- value
+	}()
+	close(release)
+	cancelLeader()
+	c.Assert(<-leaderErr, Equals, context.Canceled)
+	c.Assert(<-waiterValue, Equals, 2)
+	c.Assert(m.Contains("a"), Equals, true)
+}
+
+func (s *TestSuite) TestWaitCallbacksCtx(c *C) {
+	m := s.newMap(10)
+	c.Assert(m.WaitCallbacksCtx(context.Background()), IsNil)
+
+	release := make(chan struct{})
+	m = s.newMap(10, AsyncCallbacks(1), OnRemove(func(key string, value interface{}, reason RemovalReason) {
+		<-release
+	}))
+	defer m.Close()
+	m.Set("a", 1, 10)
+	m.Delete("a")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	c.Assert(m.WaitCallbacksCtx(ctx), Equals, context.Canceled)
+
+	close(release)
+	c.Assert(m.WaitCallbacksCtx(context.Background()), IsNil)
+}
@@ -0,0 +1,83 @@
+package ttlmap
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Sizer returns the cost of an element, e.g. the size of its value in bytes
+type Sizer func(key string, value interface{}) int64
+
+// WithSizer sets the function that computes the cost of elements for
+// MaxCost, without it every element costs 1
+func WithSizer(sizer Sizer) TtlMapOption {
+	return func(m *TtlMap) error {
+		if sizer == nil {
+			return errors.New("Please pass sizer")
+		}
+		m.sizer = sizer
+		return nil
+	}
+}
+
+// MaxCost limits the total cost of the elements in the map in addition to
+// the capacity. Setting an element evicts as many elements as needed to fit
+// it, an element that costs more than maxCost on its own is rejected.
+func MaxCost(maxCost int64) TtlMapOption {
+	return func(m *TtlMap) error {
+		if maxCost <= 0 {
+			return fmt.Errorf("Max cost should be > 0, got %d", maxCost)
+		}
+		m.maxCost = maxCost
+		return nil
+	}
+}
+
+// Cost returns the total cost of the elements in the map, including expired
+// elements that have not been removed yet
+func (m *TtlMap) Cost() int64 {
+	if m.mutex != nil {
+		m.mutex.RLock()
+		defer m.mutex.RUnlock()
+	}
+	return m.cost
+}
+
+func (m *TtlMap) costOf(key string, value interface{}) (int64, error) {
+	cost := int64(1)
+	if m.sizer != nil {
+		cost = m.sizer(key, value)
+	}
+	if cost < 0 {
+		return 0, fmt.Errorf("Cost of %q should be >= 0, got %d", key, cost)
+	}
+	if m.maxCost > 0 && cost > m.maxCost {
+		return 0, fmt.Errorf("Cost of %q is %d, exceeds max cost %d", key, cost, m.maxCost)
+	}
+	return cost, nil
+}
+
+// reclaimExpired removes expired elements other than keep until growing the
+// total cost by delta fits into MaxCost, reports whether it does
+func (m *TtlMap) reclaimExpired(keep *mapElement, delta int64) bool {
+	now := m.now()
+	for m.cost+delta > m.maxCost {
+		if m.expiryTimes.Len() == 0 {
+			return false
+		}
+		heapEl := m.expiryTimes.PeekEl()
+		if heapEl.Priority > now || heapEl.Value == keep {
+			return false
+		}
+		m.remove(heapEl.Value.(*mapElement), Expired)
+	}
+	return true
+}
+
+// isFull reports whether an element of the given cost does not fit
+func (m *TtlMap) isFull(cost int64) bool {
+	if len(m.elements) >= m.capacity {
+		return true
+	}
+	return m.maxCost > 0 && m.cost+cost > m.maxCost
+}
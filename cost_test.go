@@ -0,0 +1,101 @@
+package ttlmap
+
+import (
+	. "gopkg.in/check.v1"
+)
+
+func byteSizer(key string, value interface{}) int64 {
+	return int64(len(value.([]byte)))
+}
+
+func (s *TestSuite) TestMaxCostValidation(c *C) {
+	_, err := NewMap(1, MaxCost(0))
+	c.Assert(err, Not(Equals), nil)
+
+	_, err = NewMap(1, WithSizer(nil))
+	c.Assert(err, Not(Equals), nil)
+
+	m := s.newMap(10, WithSizer(byteSizer), MaxCost(10))
+	c.Assert(m.Set("a", make([]byte, 11), 10), Not(Equals), nil)
+	c.Assert(m.Len(), Equals, 0)
+	c.Assert(m.Cost(), Equals, int64(0))
+}
+
+func (s *TestSuite) TestMaxCost(c *C) {
+	m := s.newMap(10, WithSizer(byteSizer), MaxCost(10))
+
+	m.Set("a", make([]byte, 3), 1)
+	m.Set("b", make([]byte, 3), 2)
+	m.Set("c", make([]byte, 3), 3)
+	c.Assert(m.Cost(), Equals, int64(9))
+
+	// A large element evicts as many elements as needed
+	m.Set("d", make([]byte, 7), 10)
+	c.Assert(m.Contains("a"), Equals, false)
+	c.Assert(m.Contains("b"), Equals, false)
+	c.Assert(m.Contains("c"), Equals, true)
+	c.Assert(m.Cost(), Equals, int64(10))
+
+	// Shrinking an element frees its cost
+	m.Set("d", make([]byte, 1), 10)
+	c.Assert(m.Cost(), Equals, int64(4))
+
+	// Growing an element evicts others but never the element itself
+	m.Set("d", make([]byte, 8), 10)
+	c.Assert(m.Contains("c"), Equals, false)
+	c.Assert(m.Contains("d"), Equals, true)
+	c.Assert(m.Cost(), Equals, int64(8))
+
+	c.Assert(m.SetKeepTTL("d", make([]byte, 2)), Equals, true)
+	c.Assert(m.Cost(), Equals, int64(2))
+
+	m.Delete("d")
+	c.Assert(m.Cost(), Equals, int64(0))
+}
+
+func (s *TestSuite) TestMaxCostWithoutSizer(c *C) {
+	m := s.newMap(10, MaxCost(2))
+
+	m.Set("a", 1, 1)
+	m.Set("b", 2, 2)
+	m.Set("c", 3, 3)
+	c.Assert(m.Len(), Equals, 2)
+	c.Assert(m.Contains("a"), Equals, false)
+	c.Assert(m.Cost(), Equals, int64(2))
+
+	m.Clear()
+	c.Assert(m.Cost(), Equals, int64(0))
+}
+
+func (s *TestSuite) TestRenameRecomputesCost(c *C) {
+	keySizer := func(key string, value interface{}) int64 {
+		return int64(len(key))
+	}
+	m := s.newMap(10, WithSizer(keySizer), MaxCost(10))
+	m.Set("a", 1, 1)
+	m.Set("bbb", 2, 2)
+	m.Set("ccc", 3, 10)
+	c.Assert(m.Cost(), Equals, int64(7))
+
+	// A longer key evicts others to fit
+	c.Assert(m.Rename("ccc", "ccccccc"), Equals, true)
+	c.Assert(m.Contains("a"), Equals, false)
+	c.Assert(m.Contains("bbb"), Equals, true)
+	c.Assert(m.Cost(), Equals, int64(10))
+
+	c.Assert(m.Rename("ccccccc", "c"), Equals, true)
+	c.Assert(m.Cost(), Equals, int64(4))
+
+	// The element does not fit under a key that costs more than MaxCost
+	c.Assert(m.Rename("c", "ccccccccccc"), Equals, false)
+	c.Assert(m.Contains("c"), Equals, true)
+	c.Assert(m.Cost(), Equals, int64(4))
+
+	// Full maps that reject writes do not evict live elements for renames
+	full := s.newMap(10, WithSizer(keySizer), MaxCost(4), RejectWhenFull())
+	full.Set("a", 1, 10)
+	full.Set("bb", 2, 10)
+	c.Assert(full.Rename("a", "aaa"), Equals, false)
+	c.Assert(full.Rename("a", "aa"), Equals, true)
+	c.Assert(full.Cost(), Equals, int64(4))
+}
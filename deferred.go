@@ -0,0 +1,112 @@
+package ttlmap
+
+import (
+	"fmt"
+)
+
+// DeferredExpiry makes the map buffer the expiry times of new elements and
+// fold them into the expiry index in batches of the given size, instead of
+// paying an expiry heap push on every Set of a new key. The buffer is also
+// folded whenever the map looks for the soonest expiring element: when the
+// reaper runs, when expired elements are purged and when a full map evicts.
+// Reads are not affected, they check the expiry time of the element itself.
+func DeferredExpiry(batch int) TtlMapOption {
+	return func(m *TtlMap) error {
+		if batch <= 0 {
+			return fmt.Errorf("Deferred expiry batch should be > 0, got %d", batch)
+		}
+		m.expiryBatch = batch
+		return nil
+	}
+}
+
+// deferredIndex buffers pushes in front of another expiry index
+type deferredIndex struct {
+	expiryIndex
+	batch int
+	// pending elements are not pushed into the index yet, each knows its
+	// position in pendingIndex
+	pending []*heapElement
+}
+
+func newDeferredIndex(index expiryIndex, batch int) *deferredIndex {
+	return &deferredIndex{
+		expiryIndex: index,
+		batch:       batch,
+		pending:     make([]*heapElement, 0, batch),
+	}
+}
+
+func (d *deferredIndex) Len() int {
+	return d.expiryIndex.Len() + len(d.pending)
+}
+
+func (d *deferredIndex) PushEl(el *heapElement) {
+	d.pending = append(d.pending, el)
+	el.Value.(*mapElement).pendingIndex = len(d.pending)
+	if len(d.pending) >= d.batch {
+		d.fold()
+	}
+}
+
+func (d *deferredIndex) PopEl() *heapElement {
+	d.fold()
+	return d.expiryIndex.PopEl()
+}
+
+func (d *deferredIndex) PeekEl() *heapElement {
+	d.fold()
+	return d.expiryIndex.PeekEl()
+}
+
+func (d *deferredIndex) UpdateEl(el *heapElement, priority int64) {
+	if el.Value.(*mapElement).pendingIndex > 0 {
+		el.Priority = priority
+		return
+	}
+	d.expiryIndex.UpdateEl(el, priority)
+}
+
+func (d *deferredIndex) RemoveEl(el *heapElement) {
+	mapEl := el.Value.(*mapElement)
+	if mapEl.pendingIndex == 0 {
+		d.expiryIndex.RemoveEl(el)
+		return
+	}
+	last := len(d.pending) - 1
+	moved := d.pending[last]
+	d.pending[mapEl.pendingIndex-1] = moved
+	moved.Value.(*mapElement).pendingIndex = mapEl.pendingIndex
+	d.pending[last] = nil
+	d.pending = d.pending[:last]
+	mapEl.pendingIndex = 0
+}
+
+func (d *deferredIndex) ForEach(fn func(el *heapElement) bool) {
+	for _, el := range d.pending {
+		if !fn(el) {
+			return
+		}
+	}
+	d.expiryIndex.ForEach(fn)
+}
+
+func (d *deferredIndex) CountExpired(now int64) int {
+	count := d.expiryIndex.CountExpired(now)
+	for _, el := range d.pending {
+		if el.Priority <= now {
+			count += 1
+		}
+	}
+	return count
+}
+
+// fold pushes the pending elements into the index
+func (d *deferredIndex) fold() {
+	for i, el := range d.pending {
+		el.Value.(*mapElement).pendingIndex = 0
+		d.expiryIndex.PushEl(el)
+		d.pending[i] = nil
+	}
+	d.pending = d.pending[:0]
+}
@@ -0,0 +1,70 @@
+package ttlmap
+
+import (
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+func (s *TestSuite) TestDeferredExpiryValidation(c *C) {
+	_, err := NewMap(1, DeferredExpiry(0))
+	c.Assert(err, Not(Equals), nil)
+}
+
+func (s *TestSuite) TestDeferredExpiry(c *C) {
+	m := s.newMap(10, DeferredExpiry(4))
+	d := m.expiryTimes.(*deferredIndex)
+
+	m.Set("a", 1, 3)
+	m.Set("b", 2, 1)
+	m.Set("c", 3, 2)
+	c.Assert(d.pending, HasLen, 3)
+	c.Assert(d.expiryIndex.Len(), Equals, 0)
+	c.Assert(m.Len(), Equals, 3)
+
+	// Buffered elements can be updated and removed
+	m.Touch("a", 4)
+	m.Set("c", 30, 2)
+	m.Delete("b")
+	c.Assert(d.pending, HasLen, 2)
+	c.Assert(m.elements["a"].pendingIndex, Equals, 1)
+	c.Assert(m.elements["c"].pendingIndex, Equals, 2)
+
+	// Reads check the expiry time of the buffered element
+	s.advanceSeconds(2)
+	c.Assert(m.Contains("c"), Equals, false)
+	c.Assert(m.LiveLen(), Equals, 1)
+
+	// A full batch is folded
+	m.Set("d", 4, 10)
+	m.Set("e", 5, 1)
+	c.Assert(d.pending, HasLen, 0)
+	c.Assert(d.expiryIndex.Len(), Equals, 4)
+	c.Assert(m.elements["a"].pendingIndex, Equals, 0)
+
+	// Expired elements are removed in order, buffered or not
+	m.Set("f", 6, 3)
+	s.advanceSeconds(3)
+	expired := m.RemoveExpired(0)
+	c.Assert(expired, HasLen, 4)
+	c.Assert(expired[0].Key, Equals, "c")
+	c.Assert(expired[1].Key, Equals, "e")
+	c.Assert(expired[2].Key, Equals, "a")
+	c.Assert(expired[3].Key, Equals, "f")
+	c.Assert(m.Len(), Equals, 1)
+}
+
+func (s *TestSuite) TestDeferredExpiryEviction(c *C) {
+	m := s.newMap(2, DeferredExpiry(16), TimingWheel(time.Second))
+
+	m.Set("a", 1, 5)
+	m.Set("b", 2, 1)
+	m.Set("c", 3, 10)
+	c.Assert(m.Contains("b"), Equals, false)
+	c.Assert(m.Len(), Equals, 2)
+
+	m.Clear()
+	c.Assert(m.expiryTimes.(*deferredIndex).pending, HasLen, 0)
+	m.Set("a", 1, 5)
+	c.Assert(m.expiryTimes.Len(), Equals, 1)
+}
@@ -0,0 +1,141 @@
+package ttlmap
+
+import (
+	"fmt"
+	"sync"
+)
+
+// AsyncCallbacks makes the map run the expiration and removal callbacks on
+// the given number of worker goroutines after the map lock is released,
+// instead of calling them while the map is locked. Callbacks may then access
+// the map, and a slow callback no longer stalls other operations. Callbacks
+// are queued without bound, run in order when there is a single worker, and
+// may run concurrently with more workers. Use WaitCallbacks to wait for the
+// queued callbacks and Close to stop the workers.
+func AsyncCallbacks(workers int) TtlMapOption {
+	return func(m *TtlMap) error {
+		if workers <= 0 {
+			return fmt.Errorf("Callback workers should be > 0, got %d", workers)
+		}
+		m.callbackWorkers = workers
+		return nil
+	}
+}
+
+// WaitCallbacks waits until all queued callbacks have run, it returns right
+// away if callbacks are synchronous
+func (m *TtlMap) WaitCallbacks() {
+	if m.dispatcher != nil {
+		m.dispatcher.wait()
+	}
+}
+
+// Close stops the reaper and the callback workers, the callbacks queued so
+// far still run. The map remains usable, callbacks of later removals run
+// synchronously.
+func (m *TtlMap) Close() {
+	m.StopReaper()
+
+	if m.mutex != nil {
+		m.mutex.Lock()
+	}
+	d := m.dispatcher
+	m.dispatcher = nil
+	if m.mutex != nil {
+		m.mutex.Unlock()
+	}
+
+	if d != nil {
+		d.close()
+	}
+}
+
+// notify runs the callback right away or queues it with AsyncCallbacks
+func (m *TtlMap) notify(fn func()) {
+	if m.logger != nil {
+		fn = m.recovering(fn)
+	}
+	if m.dispatcher != nil {
+		m.dispatcher.dispatch(fn)
+		return
+	}
+	fn()
+}
+
+// dispatcher runs queued functions on a fixed number of workers
+type dispatcher struct {
+	mutex sync.Mutex
+	cond  *sync.Cond
+	queue []func()
+	// running is the number of functions being run by the workers
+	running int
+	closed  bool
+	done    sync.WaitGroup
+}
+
+func newDispatcher(workers int) *dispatcher {
+	d := &dispatcher{}
+	d.cond = sync.NewCond(&d.mutex)
+	d.done.Add(workers)
+	for i := 0; i < workers; i += 1 {
+		go d.work()
+	}
+	return d
+}
+
+// dispatch queues fn, it never blocks on running functions
+func (d *dispatcher) dispatch(fn func()) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	d.queue = append(d.queue, fn)
+	d.cond.Broadcast()
+}
+
+func (d *dispatcher) work() {
+	defer d.done.Done()
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	for {
+		for len(d.queue) == 0 && !d.closed {
+			d.cond.Wait()
+		}
+		if len(d.queue) == 0 {
+			return
+		}
+		fn := d.queue[0]
+		d.queue[0] = nil
+		d.queue = d.queue[1:]
+		d.running += 1
+
+		d.mutex.Unlock()
+		fn()
+		d.mutex.Lock()
+
+		d.running -= 1
+		if len(d.queue) == 0 && d.running == 0 {
+			d.cond.Broadcast()
+		}
+	}
+}
+
+// wait blocks until the queue is empty and no function is running
+func (d *dispatcher) wait() {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	for len(d.queue) > 0 || d.running > 0 {
+		d.cond.Wait()
+	}
+}
+
+// close stops the workers once they have run the queued functions
+func (d *dispatcher) close() {
+	d.mutex.Lock()
+	d.closed = true
+	d.cond.Broadcast()
+	d.mutex.Unlock()
+
+	d.done.Wait()
+}
@@ -0,0 +1,64 @@
+package ttlmap
+
+import (
+	"sync"
+
+	. "gopkg.in/check.v1"
+)
+
+func (s *TestSuite) TestAsyncCallbacksValidation(c *C) {
+	_, err := NewMap(1, AsyncCallbacks(0))
+	c.Assert(err, Not(Equals), nil)
+}
+
+func (s *TestSuite) TestAsyncCallbacks(c *C) {
+	var m *TtlMap
+	var mutex sync.Mutex
+	var expired []interface{}
+	var removed []RemovalReason
+	m = s.newMap(1, AsyncCallbacks(1), CallOnExpire(func(key string, value interface{}) {
+		// Callbacks run outside of the map lock, so they can use the map
+		m.Len()
+		mutex.Lock()
+		expired = append(expired, value)
+		mutex.Unlock()
+	}), OnRemove(func(key string, value interface{}, reason RemovalReason) {
+		mutex.Lock()
+		removed = append(removed, reason)
+		mutex.Unlock()
+	}))
+	defer m.Close()
+
+	m.Set("a", 1, 1)
+	s.advanceSeconds(1)
+	_, exists := m.Get("a")
+	c.Assert(exists, Equals, false)
+
+	m.Set("b", 2, 5)
+	m.Set("c", 3, 5)
+
+	m.WaitCallbacks()
+	mutex.Lock()
+	c.Assert(expired, DeepEquals, []interface{}{1})
+	c.Assert(removed, DeepEquals, []RemovalReason{Expired, EvictedCapacity})
+	mutex.Unlock()
+}
+
+func (s *TestSuite) TestAsyncCallbacksClose(c *C) {
+	count := 0
+	m := s.newMap(10, AsyncCallbacks(2), OnRemove(func(key string, value interface{}, reason RemovalReason) {
+		count += 1
+	}))
+
+	m.Set("a", 1, 1)
+	m.Delete("a")
+	m.Close()
+	c.Assert(count, Equals, 1)
+	c.Assert(m.dispatcher, IsNil)
+
+	// Callbacks are synchronous after Close
+	m.Set("b", 1, 1)
+	m.Delete("b")
+	c.Assert(count, Equals, 2)
+	m.WaitCallbacks()
+}
@@ -0,0 +1,135 @@
+package ttlmap
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+)
+
+// Dump writes a human readable listing of the internal state of the map to
+// w: the elements in key order with their expiry times, the expiry index in
+// its internal order and the inconsistencies found between the elements and
+// the index, which should never be there. It is meant for debugging, the map
+// is locked for reading while the whole listing is written.
+func (m *TtlMap) Dump(w io.Writer) error {
+	if m.mutex != nil {
+		m.mutex.RLock()
+		defer m.mutex.RUnlock()
+	}
+
+	b := bufio.NewWriter(w)
+	now := m.now()
+	fmt.Fprintf(b, "ttlmap: %d elements, capacity %d, %d in %T, now %v\n",
+		len(m.elements), m.capacity, m.expiryTimes.Len(), m.expiryTimes, m.fromExpiryTime(now).Format(time.RFC3339Nano))
+
+	keys := make([]string, 0, len(m.elements))
+	for key := range m.elements {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	fmt.Fprintln(b, "elements:")
+	for _, key := range keys {
+		mapEl := m.elements[key]
+		fmt.Fprintf(b, "  %q = %v, %s\n", key, mapEl.value, m.describeExpiry(mapEl.heapEl.Priority, now))
+	}
+
+	fmt.Fprintln(b, "expiry index:")
+	position := 0
+	m.expiryTimes.ForEach(func(el *heapElement) bool {
+		mapEl := el.Value.(*mapElement)
+		fmt.Fprintf(b, "  %d %q %s\n", position, mapEl.key, m.describeExpiry(el.Priority, now))
+		position += 1
+		return true
+	})
+
+	fmt.Fprintln(b, "inconsistencies:")
+	problems := m.inconsistencies()
+	if len(problems) == 0 {
+		fmt.Fprintln(b, "  none")
+	}
+	for _, problem := range problems {
+		fmt.Fprintf(b, "  %s\n", problem)
+		if m.logger != nil {
+			m.logger.Warnf("ttlmap: inconsistency, %s", problem)
+		}
+	}
+	return b.Flush()
+}
+
+func (m *TtlMap) describeExpiry(expiryTime, now int64) string {
+	if expiryTime == neverExpires {
+		return "never expires"
+	}
+	at := m.fromExpiryTime(expiryTime).Format(time.RFC3339Nano)
+	if expiryTime <= now {
+		return fmt.Sprintf("expired at %s (%v ago)", at, time.Duration(now-expiryTime))
+	}
+	return fmt.Sprintf("expires at %s (in %v)", at, time.Duration(expiryTime-now))
+}
+
+// inconsistencies checks that the elements and the expiry index hold the
+// same elements, that the heap is ordered and that the totals add up
+func (m *TtlMap) inconsistencies() []string {
+	var problems []string
+	for key, mapEl := range m.elements {
+		if mapEl.key != key {
+			problems = append(problems, fmt.Sprintf("element stored under %q has key %q", key, mapEl.key))
+		}
+	}
+
+	indexed := make(map[*mapElement]bool, len(m.elements))
+	m.expiryTimes.ForEach(func(el *heapElement) bool {
+		mapEl := el.Value.(*mapElement)
+		switch {
+		case indexed[mapEl]:
+			problems = append(problems, fmt.Sprintf("%q is in the expiry index more than once", mapEl.key))
+		case m.elements[mapEl.key] != mapEl:
+			problems = append(problems, fmt.Sprintf("%q is in the expiry index but not in the elements", mapEl.key))
+		}
+		indexed[mapEl] = true
+		return true
+	})
+	for key, mapEl := range m.elements {
+		if !indexed[mapEl] {
+			problems = append(problems, fmt.Sprintf("%q is in the elements but not in the expiry index", key))
+		}
+	}
+
+	if heap := heapOf(m.expiryTimes); heap != nil {
+		h := *heap
+		for i := 1; i < len(h); i += 1 {
+			if parent := (i - 1) / 2; h[parent].Priority > h[i].Priority {
+				problems = append(problems, fmt.Sprintf("heap position %d expires after its child at %d", parent, i))
+			}
+		}
+	}
+
+	if m.insertions.Len() != len(m.elements) {
+		problems = append(problems, fmt.Sprintf("%d elements in insertion order, expected %d", m.insertions.Len(), len(m.elements)))
+	}
+	var cost int64
+	for _, mapEl := range m.elements {
+		cost += mapEl.cost
+	}
+	if cost != m.cost {
+		problems = append(problems, fmt.Sprintf("total cost is %d, elements cost %d", m.cost, cost))
+	}
+	sort.Strings(problems)
+	return problems
+}
+
+// heapOf returns the binary heap of a heap backed expiry index, nil for the
+// timing wheel
+func heapOf(index expiryIndex) *minHeap {
+	switch index := index.(type) {
+	case *heapIndex:
+		return index.minHeap
+	case *tombstoneHeap:
+		return index.minHeap
+	case *deferredIndex:
+		return heapOf(index.expiryIndex)
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package ttlmap
+
+import (
+	"bytes"
+	"strings"
+
+	. "gopkg.in/check.v1"
+)
+
+func (s *TestSuite) TestDump(c *C) {
+	m := s.newMap(10)
+	m.Set("b", 2, 10)
+	m.Set("a", "one", 5)
+	m.Set("c", 3, NoExpiration)
+	m.Set("d", 4, 1)
+	s.advanceSeconds(2)
+
+	var buf bytes.Buffer
+	c.Assert(m.Dump(&buf), IsNil)
+	c.Assert(buf.String(), Equals, `ttlmap: 4 elements, capacity 10, 4 in *ttlmap.heapIndex, now 2012-03-04T05:06:09Z
+elements:
+  "a" = one, expires at 2012-03-04T05:06:12Z (in 3s)
+  "b" = 2, expires at 2012-03-04T05:06:17Z (in 8s)
+  "c" = 3, never expires
+  "d" = 4, expired at 2012-03-04T05:06:08Z (1s ago)
+expiry index:
+  0 "d" expired at 2012-03-04T05:06:08Z (1s ago)
+  1 "a" expires at 2012-03-04T05:06:12Z (in 3s)
+  2 "c" never expires
+  3 "b" expires at 2012-03-04T05:06:17Z (in 8s)
+inconsistencies:
+  none
+`)
+}
+
+func (s *TestSuite) TestDumpInconsistencies(c *C) {
+	m := s.newMap(10)
+	m.Set("a", 1, 10)
+	m.Set("b", 2, 5)
+	m.Set("c", 3, 1)
+
+	// Break the invariants behind the back of the map
+	orphan := m.elements["c"]
+	delete(m.elements, "c")
+	heap := *heapOf(m.expiryTimes)
+	heap[0].Priority = heap[len(heap)-1].Priority + 1
+	m.cost = 7
+
+	var buf bytes.Buffer
+	c.Assert(m.Dump(&buf), IsNil)
+	c.Assert(strings.SplitAfter(buf.String(), "inconsistencies:\n")[1], Equals,
+		`  "c" is in the expiry index but not in the elements
+  3 elements in insertion order, expected 2
+  heap position 0 expires after its child at 2
+  total cost is 7, elements cost 2
+`)
+	c.Assert(orphan.key, Equals, "c")
+}
@@ -0,0 +1,70 @@
+package ttlmap
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// TrackAccess makes the map count the reads of every element and remember
+// the last one, as reported by EntryInfo. Reads update the counters
+// atomically, so they still share the read lock, at the cost of a clock read
+// per read. Can not be combined with LockFreeReads and HotKeyCache, which
+// serve reads without looking at the elements.
+func TrackAccess() TtlMapOption {
+	return func(m *TtlMap) error {
+		m.trackAccess = true
+		return nil
+	}
+}
+
+// EntryInfo is the bookkeeping of an element
+type EntryInfo struct {
+	// CreatedAt is when the element was inserted, overwriting an expired
+	// element counts as an insertion
+	CreatedAt time.Time
+	// UpdatedAt is when the value was last written
+	UpdatedAt time.Time
+	// ExpiresAt is the zero time for elements that never expire
+	ExpiresAt time.Time
+	// LastAccessedAt and AccessCount report the reads of the element since
+	// it was created with TrackAccess, they are zero without it
+	LastAccessedAt time.Time
+	AccessCount    uint64
+}
+
+// EntryInfo returns the bookkeeping of the live element with the given key,
+// looking it up does not count as an access
+func (m *TtlMap) EntryInfo(key string) (EntryInfo, bool) {
+	if m.mutex != nil {
+		m.mutex.RLock()
+		defer m.mutex.RUnlock()
+	}
+
+	mapEl, expired := m.get(key)
+	if mapEl == nil || expired {
+		return EntryInfo{}, false
+	}
+	info := EntryInfo{
+		CreatedAt:   mapEl.createdAt,
+		UpdatedAt:   m.fromExpiryTime(mapEl.updatedAt),
+		ExpiresAt:   m.fromExpiryTime(mapEl.heapEl.Priority),
+		AccessCount: atomic.LoadUint64(&mapEl.accessCount),
+	}
+	if info.AccessCount > 0 {
+		info.LastAccessedAt = m.fromExpiryTime(atomic.LoadInt64(&mapEl.lastAccess))
+	}
+	return info, true
+}
+
+// accessed counts a read of the element, it may be called with the map
+// locked for reading only
+func (m *TtlMap) accessed(mapEl *mapElement) {
+	atomic.AddUint64(&mapEl.accessCount, 1)
+	atomic.StoreInt64(&mapEl.lastAccess, m.now())
+}
+
+// resetAccess forgets the reads of an element that is inserted anew
+func (m *TtlMap) resetAccess(mapEl *mapElement) {
+	atomic.StoreUint64(&mapEl.accessCount, 0)
+	atomic.StoreInt64(&mapEl.lastAccess, 0)
+}
@@ -0,0 +1,74 @@
+package ttlmap
+
+import (
+	"sync"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+func (s *TestSuite) TestEntryInfo(c *C) {
+	m := s.newMap(10, TrackAccess())
+	start := s.timeProvider.CurrentTime
+
+	m.Set("a", 1, 10)
+	s.advanceSeconds(1)
+	m.Set("a", 2, 10)
+	s.advanceSeconds(1)
+	m.Get("a")
+	m.GetMany([]string{"a", "b"})
+	s.advanceSeconds(1)
+
+	info, ok := m.EntryInfo("a")
+	c.Assert(ok, Equals, true)
+	c.Assert(info, DeepEquals, EntryInfo{
+		CreatedAt:      start,
+		UpdatedAt:      start.Add(time.Second),
+		ExpiresAt:      start.Add(11 * time.Second),
+		LastAccessedAt: start.Add(2 * time.Second),
+		AccessCount:    2,
+	})
+
+	// Overwriting an expired element starts over
+	s.advanceSeconds(10)
+	m.Set("a", 3, 10)
+	info, _ = m.EntryInfo("a")
+	c.Assert(info.CreatedAt, Equals, s.timeProvider.CurrentTime)
+	c.Assert(info.AccessCount, Equals, uint64(0))
+	c.Assert(info.LastAccessedAt.IsZero(), Equals, true)
+
+	m.Set("b", 1, NoExpiration)
+	info, _ = m.EntryInfo("b")
+	c.Assert(info.ExpiresAt.IsZero(), Equals, true)
+	_, ok = m.EntryInfo("missing")
+	c.Assert(ok, Equals, false)
+
+	// Without TrackAccess reads are not counted
+	plain := s.newMap(10)
+	plain.Set("a", 1, 10)
+	plain.Get("a")
+	info, _ = plain.EntryInfo("a")
+	c.Assert(info.AccessCount, Equals, uint64(0))
+	c.Assert(info.UpdatedAt, Equals, s.timeProvider.CurrentTime)
+
+	_, err := NewConcurrent(10, TrackAccess(), HotKeyCache(1))
+	c.Assert(err, NotNil)
+}
+
+func (s *TestSuite) TestEntryInfoConcurrentReads(c *C) {
+	m, _ := NewConcurrent(10, TrackAccess())
+	m.Set("a", 1, 10)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i += 1 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 1000; j += 1 {
+				m.Get("a")
+			}
+		}()
+	}
+	wg.Wait()
+	info, _ := m.EntryInfo("a")
+	c.Assert(info.AccessCount, Equals, uint64(8000))
+}
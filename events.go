@@ -0,0 +1,133 @@
+package ttlmap
+
+import (
+	"fmt"
+	"time"
+)
+
+// EventType tells what happened to an element
+type EventType int
+
+const (
+	// SetEvent is a value written for a key without a live element
+	SetEvent EventType = iota + 1
+	// UpdateEvent is a value overwriting the value of a live element
+	UpdateEvent
+	// DeleteEvent is an element removed with Delete, Pop or Clear, or moved
+	// away from its key by Rename
+	DeleteEvent
+	// ExpireEvent is an element removed because it expired
+	ExpireEvent
+	// EvictEvent is a live element evicted to make room for other elements
+	EvictEvent
+)
+
+func (t EventType) String() string {
+	switch t {
+	case SetEvent:
+		return "set"
+	case UpdateEvent:
+		return "update"
+	case DeleteEvent:
+		return "delete"
+	case ExpireEvent:
+		return "expire"
+	case EvictEvent:
+		return "evict"
+	}
+	return fmt.Sprintf("EventType(%d)", int(t))
+}
+
+// Event is a change of the map. OldValue is the value of the element before
+// an update or a removal, NewValue the value of a set or an update.
+type Event struct {
+	Type     EventType
+	Key      string
+	OldValue interface{}
+	NewValue interface{}
+	At       time.Time
+}
+
+// EventChannel makes the map deliver the changes of its elements on the
+// channel returned by Events, buffered for size events. Like with
+// EvictionChannel, events are sent without blocking and dropped while the
+// buffer is full. Events are sent with the map locked, in the order of the
+// changes.
+func EventChannel(size int) TtlMapOption {
+	return func(m *TtlMap) error {
+		if size <= 0 {
+			return fmt.Errorf("Event channel size should be > 0, got %d", size)
+		}
+		m.events = make(chan Event, size)
+		return nil
+	}
+}
+
+// Events returns the channel set up by the EventChannel option, nil if the
+// option was not used
+func (m *TtlMap) Events() <-chan Event {
+	return m.events
+}
+
+// DroppedEvents returns the number of events that could not be delivered
+// because the event channel was full
+func (m *TtlMap) DroppedEvents() int {
+	if m.mutex != nil {
+		m.mutex.RLock()
+		defer m.mutex.RUnlock()
+	}
+	return m.droppedEvents
+}
+
+// removalEvent sends the event of a removal. Replaced values are sent as
+// part of the update event of the write that follows, so they are kept until
+// then.
+func (m *TtlMap) removalEvent(mapEl *mapElement, reason RemovalReason) {
+	if reason == Replaced {
+		m.replacing = true
+		m.replacedKey = mapEl.key
+		m.replacedValue = mapEl.value
+		return
+	}
+	// Evictions may happen between the replacement and the write, but a
+	// removal of the key itself means no write follows
+	if m.replacing && m.replacedKey == mapEl.key {
+		m.replacing = false
+		m.replacedValue = nil
+	}
+
+	var eventType EventType
+	switch reason {
+	case Deleted:
+		eventType = DeleteEvent
+	case Expired:
+		eventType = ExpireEvent
+	case EvictedCapacity:
+		eventType = EvictEvent
+	default:
+		return
+	}
+	m.sendEvent(Event{Type: eventType, Key: mapEl.key, OldValue: mapEl.value})
+}
+
+// writeEvent sends the event of a value written
+func (m *TtlMap) writeEvent(mapEl *mapElement) {
+	event := Event{Type: SetEvent, Key: mapEl.key, NewValue: mapEl.value}
+	if m.replacing && m.replacedKey == mapEl.key {
+		event.Type = UpdateEvent
+		event.OldValue = m.replacedValue
+	}
+	m.replacing = false
+	m.replacedValue = nil
+	m.sendEvent(event)
+}
+
+func (m *TtlMap) sendEvent(event Event) {
+	event.At = m.currentTime().UTC()
+	select {
+	case m.events <- event:
+	default:
+		m.droppedEvents += 1
+		m.warnDropped("EventChannel", m.droppedEvents)
+	}
+}
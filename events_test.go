@@ -0,0 +1,106 @@
+package ttlmap
+
+import (
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+func drainEvents(m *TtlMap) []Event {
+	var events []Event
+	for {
+		select {
+		case event := <-m.Events():
+			events = append(events, event)
+		default:
+			return events
+		}
+	}
+}
+
+func (s *TestSuite) TestEvents(c *C) {
+	m := s.newMap(2, EventChannel(16))
+	at := s.timeProvider.CurrentTime
+
+	m.Set("a", 1, 1)
+	m.Set("a", 2, 1)
+	m.Update("a", 1, func(current interface{}, exists bool) (interface{}, error) {
+		return current.(int) + 1, nil
+	})
+	m.Set("b", 1, 10)
+	m.Set("c", 1, 10)
+	m.Delete("c")
+	c.Assert(drainEvents(m), DeepEquals, []Event{
+		{Type: SetEvent, Key: "a", NewValue: 1, At: at},
+		{Type: UpdateEvent, Key: "a", OldValue: 1, NewValue: 2, At: at},
+		{Type: UpdateEvent, Key: "a", OldValue: 2, NewValue: 3, At: at},
+		{Type: SetEvent, Key: "b", NewValue: 1, At: at},
+		{Type: EvictEvent, Key: "a", OldValue: 3, At: at},
+		{Type: SetEvent, Key: "c", NewValue: 1, At: at},
+		{Type: DeleteEvent, Key: "c", OldValue: 1, At: at},
+	})
+
+	s.advanceSeconds(10)
+	m.Set("b", 2, 10)
+	c.Assert(drainEvents(m), DeepEquals, []Event{
+		{Type: ExpireEvent, Key: "b", OldValue: 1, At: at.Add(10 * time.Second)},
+		{Type: SetEvent, Key: "b", NewValue: 2, At: at.Add(10 * time.Second)},
+	})
+	c.Assert(SetEvent.String(), Equals, "set")
+}
+
+func (s *TestSuite) TestEventsReplacedByRename(c *C) {
+	m := s.newMap(10, EventChannel(16))
+	m.Set("a", 1, 10)
+	m.Set("b", 2, 10)
+	m.Rename("a", "b")
+	m.Delete("b")
+	m.Set("b", 3, 10)
+	events := drainEvents(m)
+	c.Assert(events[len(events)-1].Type, Equals, SetEvent)
+	c.Assert(events[len(events)-1].OldValue, IsNil)
+}
+
+func (s *TestSuite) TestEventsRename(c *C) {
+	m := s.newMap(10, EventChannel(16))
+	at := s.timeProvider.CurrentTime
+	m.Set("a", 1, 10)
+	m.Set("b", 2, 10)
+	drainEvents(m)
+
+	m.Rename("a", "c")
+	m.Rename("c", "b")
+	c.Assert(drainEvents(m), DeepEquals, []Event{
+		{Type: DeleteEvent, Key: "a", OldValue: 1, At: at},
+		{Type: SetEvent, Key: "c", NewValue: 1, At: at},
+		{Type: DeleteEvent, Key: "c", OldValue: 1, At: at},
+		{Type: UpdateEvent, Key: "b", OldValue: 2, NewValue: 1, At: at},
+	})
+
+	// An expired element under the new key expires rather than being updated
+	m.Set("x", 3, 1)
+	drainEvents(m)
+	s.advanceSeconds(1)
+	m.Rename("b", "x")
+	at = at.Add(time.Second)
+	c.Assert(drainEvents(m), DeepEquals, []Event{
+		{Type: ExpireEvent, Key: "x", OldValue: 3, At: at},
+		{Type: DeleteEvent, Key: "b", OldValue: 1, At: at},
+		{Type: SetEvent, Key: "x", NewValue: 1, At: at},
+	})
+
+	// Renaming a key to itself changes nothing
+	m.Rename("x", "x")
+	c.Assert(drainEvents(m), HasLen, 0)
+}
+
+func (s *TestSuite) TestDroppedEvents(c *C) {
+	m := s.newMap(10, EventChannel(1))
+	m.Set("a", 1, 10)
+	m.Set("b", 1, 10)
+	c.Assert(m.DroppedEvents(), Equals, 1)
+	c.Assert(drainEvents(m), HasLen, 1)
+
+	_, err := NewMap(10, EventChannel(0))
+	c.Assert(err, NotNil)
+}
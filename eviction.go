@@ -0,0 +1,355 @@
+package ttlmap
+
+import (
+	"container/list"
+	"errors"
+	"fmt"
+	"math/rand"
+	"time"
+)
+
+// EvictionPolicy selects the live element evicted when the map is full.
+// Expired elements are always removed first regardless of the policy.
+type EvictionPolicy int
+
+const (
+	// EvictSoonestExpiring evicts the element that expires first. This is
+	// the default policy.
+	EvictSoonestExpiring EvictionPolicy = iota + 1
+	// EvictLRU evicts the least recently used element, both reads and writes
+	// count as a use. Reads take the write lock of a concurrent map to record
+	// the access.
+	EvictLRU
+	// EvictLFU evicts the least frequently used element. Access counters are
+	// halved periodically, so elements that used to be hot but are no longer
+	// accessed eventually become eviction candidates. Like EvictLRU it takes
+	// the write lock on reads.
+	EvictLFU
+	// EvictARC evicts using the adaptive replacement cache algorithm, which
+	// balances between recency and frequency depending on the workload. It
+	// remembers the keys of up to capacity recently evicted elements to
+	// tune itself. Like EvictLRU it takes the write lock on reads.
+	EvictARC
+	// EvictRandom evicts a randomly chosen element. It does not track
+	// accesses at all, so reads keep taking the read lock and writes skip
+	// any bookkeeping beyond an O(1) slice update.
+	EvictRandom
+	// EvictSLRU evicts using a segmented LRU: new elements start in a
+	// probation segment and are promoted to a protected segment, holding up
+	// to 80% of the capacity, once accessed again. Elements only seen once
+	// are evicted before the working set. Like EvictLRU it takes the write
+	// lock on reads.
+	EvictSLRU
+)
+
+// Eviction sets the eviction policy of the map
+func Eviction(policy EvictionPolicy) TtlMapOption {
+	return func(m *TtlMap) error {
+		if policy < EvictSoonestExpiring || policy > EvictSLRU {
+			return fmt.Errorf("Unknown eviction policy %d", policy)
+		}
+		m.evictionPolicy = policy
+		m.evictor = m.newEvictor()
+		return nil
+	}
+}
+
+// newEvictor returns an empty evictor for the eviction policy, nil for the
+// default policy
+func (m *TtlMap) newEvictor() evictor {
+	switch m.evictionPolicy {
+	case EvictLRU:
+		return newLRU()
+	case EvictLFU:
+		return newLFU()
+	case EvictARC:
+		return newARC(&m.capacity)
+	case EvictRandom:
+		return &randomEvictor{}
+	case EvictSLRU:
+		return newSLRU(&m.capacity)
+	}
+	return nil
+}
+
+// ErrFull is returned by writes to a map created with RejectWhenFull when
+// there is no room left for a new element
+var ErrFull = errors.New("Map is full")
+
+// RejectWhenFull makes a full map refuse new elements with ErrFull instead
+// of evicting live elements. Expired elements are still removed to make
+// room. Overwriting existing elements is always allowed unless it exceeds
+// MaxCost.
+func RejectWhenFull() TtlMapOption {
+	return func(m *TtlMap) error {
+		m.rejectFull = true
+		return nil
+	}
+}
+
+// EvictionBatch makes a full map evict the given fraction of its capacity at
+// once instead of a single element per insert, so the following inserts do
+// not pay for an eviction each. Expired elements are still removed first.
+func EvictionBatch(fraction float64) TtlMapOption {
+	return func(m *TtlMap) error {
+		if fraction <= 0 || fraction > 1 {
+			return fmt.Errorf("Eviction batch fraction should be in (0, 1], got %v", fraction)
+		}
+		m.evictBatch = fraction
+		return nil
+	}
+}
+
+// evictBatchSize returns the number of elements to evict when the map is full
+func (m *TtlMap) evictBatchSize() int {
+	size := int(m.evictBatch * float64(m.capacity))
+	if size < 1 {
+		return 1
+	}
+	return size
+}
+
+// Watermarks makes the map evict elements down to low x capacity as soon as
+// it holds high x capacity elements, instead of evicting one element per
+// insert once it is full. When the reaper is running it does the eviction
+// off the write path, writes then only evict when the map is completely full.
+func Watermarks(high, low float64) TtlMapOption {
+	return func(m *TtlMap) error {
+		if low <= 0 || low >= high || high > 1 {
+			return fmt.Errorf("Watermarks should satisfy 0 < low < high <= 1, got %v and %v", high, low)
+		}
+		m.highWatermark = high
+		m.lowWatermark = low
+		return nil
+	}
+}
+
+func (m *TtlMap) aboveHighWatermark() bool {
+	return m.highWatermark > 0 && len(m.elements) >= int(m.highWatermark*float64(m.capacity))
+}
+
+func (m *TtlMap) trimToLowWatermark() {
+	low := int(m.lowWatermark * float64(m.capacity))
+	if len(m.elements) > low {
+		m.freeSpace(len(m.elements) - low)
+	}
+}
+
+func (m *TtlMap) lockNTrim() {
+	if m.mutex != nil {
+		m.mutex.Lock()
+		defer m.mutex.Unlock()
+	}
+	if m.aboveHighWatermark() {
+		m.trimToLowWatermark()
+	}
+}
+
+// EvictedEntry is a live element evicted to make room for other elements
+type EvictedEntry struct {
+	Key       string
+	Value     interface{}
+	EvictedAt time.Time
+}
+
+// EvictionChannel makes the map deliver evicted live elements on the
+// channel returned by Evictions, buffered for size entries. Entries are sent
+// without blocking, they are dropped while the buffer is full, so consumers
+// should keep up with the eviction rate.
+func EvictionChannel(size int) TtlMapOption {
+	return func(m *TtlMap) error {
+		if size <= 0 {
+			return fmt.Errorf("Eviction channel size should be > 0, got %d", size)
+		}
+		m.evictions = make(chan EvictedEntry, size)
+		return nil
+	}
+}
+
+// Evictions returns the channel set up by the EvictionChannel option, nil
+// if the option was not used
+func (m *TtlMap) Evictions() <-chan EvictedEntry {
+	return m.evictions
+}
+
+// DroppedEvictions returns the number of evicted entries that could not be
+// delivered because the eviction channel was full
+func (m *TtlMap) DroppedEvictions() int {
+	if m.mutex != nil {
+		m.mutex.RLock()
+		defer m.mutex.RUnlock()
+	}
+	return m.droppedEvictions
+}
+
+func (m *TtlMap) sendEviction(mapEl *mapElement) {
+	select {
+	case m.evictions <- EvictedEntry{Key: mapEl.key, Value: mapEl.value, EvictedAt: m.currentTime().UTC()}:
+	default:
+		m.droppedEvictions += 1
+		m.warnDropped("EvictionChannel", m.droppedEvictions)
+	}
+}
+
+// evictor tracks the elements of the map to pick eviction victims. Without
+// an evictor the soonest expiring element is evicted.
+type evictor interface {
+	// add is called when a new element is inserted
+	add(mapEl *mapElement)
+	// access is called when a live element is read or overwritten
+	access(mapEl *mapElement)
+	// remove is called when an element leaves the map for any reason
+	remove(mapEl *mapElement)
+	// victim returns the element to evict without changing any state
+	victim() *mapElement
+	// evicting is called right before the victim is removed
+	evicting(mapEl *mapElement)
+	// clear forgets all elements
+	clear()
+	// tracksAccess reports whether access needs to be called on reads
+	tracksAccess() bool
+}
+
+// lru keeps elements ordered by their last use, most recent at the front
+type lru struct {
+	order *list.List
+}
+
+func newLRU() *lru {
+	return &lru{order: list.New()}
+}
+
+func (l *lru) add(mapEl *mapElement) {
+	mapEl.evictEl = l.order.PushFront(mapEl)
+}
+
+func (l *lru) access(mapEl *mapElement) {
+	l.order.MoveToFront(mapEl.evictEl)
+}
+
+func (l *lru) remove(mapEl *mapElement) {
+	l.order.Remove(mapEl.evictEl)
+	mapEl.evictEl = nil
+}
+
+func (l *lru) victim() *mapElement {
+	if e := l.order.Back(); e != nil {
+		return e.Value.(*mapElement)
+	}
+	return nil
+}
+
+func (l *lru) evicting(mapEl *mapElement) {
+}
+
+func (l *lru) clear() {
+	l.order.Init()
+}
+
+func (l *lru) tracksAccess() bool {
+	return true
+}
+
+// lfuDecayPeriod is the number of accesses per tracked element after which
+// the lfu counters are halved
+const lfuDecayPeriod = 10
+
+// lfu keeps elements in a min heap ordered by their access counters
+type lfu struct {
+	counters *minHeap
+	// accesses since the counters were last halved
+	accesses int
+}
+
+func newLFU() *lfu {
+	return &lfu{counters: newMinHeap()}
+}
+
+func (l *lfu) add(mapEl *mapElement) {
+	mapEl.counterEl = &heapElement{Value: mapEl, Priority: 1}
+	l.counters.PushEl(mapEl.counterEl)
+	l.tick()
+}
+
+func (l *lfu) access(mapEl *mapElement) {
+	l.counters.UpdateEl(mapEl.counterEl, mapEl.counterEl.Priority+1)
+	l.tick()
+}
+
+// tick counts an access and decays the counters once per period
+func (l *lfu) tick() {
+	l.accesses += 1
+	if l.accesses < lfuDecayPeriod*l.counters.Len() {
+		return
+	}
+	l.accesses = 0
+	// Halving every counter keeps their relative order, so the heap
+	// invariant still holds
+	for _, el := range *l.counters {
+		el.Priority /= 2
+	}
+}
+
+func (l *lfu) remove(mapEl *mapElement) {
+	l.counters.RemoveEl(mapEl.counterEl)
+	mapEl.counterEl = nil
+}
+
+func (l *lfu) victim() *mapElement {
+	if l.counters.Len() == 0 {
+		return nil
+	}
+	return l.counters.PeekEl().Value.(*mapElement)
+}
+
+func (l *lfu) evicting(mapEl *mapElement) {
+}
+
+func (l *lfu) clear() {
+	l.counters = newMinHeap()
+	l.accesses = 0
+}
+
+func (l *lfu) tracksAccess() bool {
+	return true
+}
+
+// randomEvictor keeps the elements in a slice to pick victims in O(1)
+type randomEvictor struct {
+	elements []*mapElement
+}
+
+func (r *randomEvictor) add(mapEl *mapElement) {
+	mapEl.evictIndex = len(r.elements)
+	r.elements = append(r.elements, mapEl)
+}
+
+func (r *randomEvictor) access(mapEl *mapElement) {
+}
+
+func (r *randomEvictor) remove(mapEl *mapElement) {
+	last := len(r.elements) - 1
+	moved := r.elements[last]
+	r.elements[mapEl.evictIndex] = moved
+	moved.evictIndex = mapEl.evictIndex
+	r.elements[last] = nil
+	r.elements = r.elements[:last]
+}
+
+func (r *randomEvictor) victim() *mapElement {
+	if len(r.elements) == 0 {
+		return nil
+	}
+	return r.elements[rand.Intn(len(r.elements))]
+}
+
+func (r *randomEvictor) evicting(mapEl *mapElement) {
+}
+
+func (r *randomEvictor) clear() {
+	r.elements = nil
+}
+
+func (r *randomEvictor) tracksAccess() bool {
+	return false
+}
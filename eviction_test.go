@@ -0,0 +1,278 @@
+package ttlmap
+
+import (
+	"fmt"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+func (s *TestSuite) TestEvictionValidation(c *C) {
+	_, err := NewMap(1, Eviction(0))
+	c.Assert(err, Not(Equals), nil)
+
+	_, err = NewMap(1, Eviction(EvictSoonestExpiring))
+	c.Assert(err, Equals, nil)
+}
+
+func (s *TestSuite) TestEvictLRU(c *C) {
+	m := s.newMap(3, Eviction(EvictLRU))
+
+	m.Set("a", 1, 1)
+	m.Set("b", 2, 10)
+	m.Set("c", 3, 10)
+
+	// Reading a makes b the least recently used, although a expires first
+	_, exists := m.Get("a")
+	c.Assert(exists, Equals, true)
+
+	m.Set("d", 4, 10)
+	c.Assert(m.Contains("a"), Equals, true)
+	c.Assert(m.Contains("b"), Equals, false)
+
+	// Overwriting counts as a use as well
+	m.Set("c", 3, 10)
+	m.Set("e", 5, 10)
+	c.Assert(m.Contains("a"), Equals, false)
+	c.Assert(m.Contains("c"), Equals, true)
+	c.Assert(m.Contains("d"), Equals, true)
+}
+
+func (s *TestSuite) TestEvictLRUExpiredFirst(c *C) {
+	m := s.newMap(2, Eviction(EvictLRU))
+
+	m.Set("a", 1, 10)
+	m.Set("b", 2, 1)
+	s.advanceSeconds(1)
+
+	m.Set("c", 3, 10)
+	c.Assert(m.Contains("a"), Equals, true)
+	c.Assert(m.Len(), Equals, 2)
+
+	m.Delete("a")
+	m.Set("d", 4, 10)
+	c.Assert(m.Len(), Equals, 2)
+	c.Assert(m.evictor.(*lru).order.Len(), Equals, 2)
+
+	m.Clear()
+	c.Assert(m.evictor.(*lru).order.Len(), Equals, 0)
+}
+
+func (s *TestSuite) TestEvictLFU(c *C) {
+	m := s.newMap(3, Eviction(EvictLFU))
+
+	m.Set("a", 1, 10)
+	m.Set("b", 2, 10)
+	for i := 0; i < 3; i += 1 {
+		m.Get("a")
+		m.Get("b")
+	}
+	m.Get("a")
+
+	// One hit keys keep evicting each other, the hot set stays
+	m.Set("c", 3, 10)
+	m.Set("d", 4, 10)
+	m.Set("e", 5, 10)
+	c.Assert(m.Contains("a"), Equals, true)
+	c.Assert(m.Contains("b"), Equals, true)
+	c.Assert(m.Contains("c"), Equals, false)
+	c.Assert(m.Contains("d"), Equals, false)
+
+	// Once e is accessed more often than b, b is evicted
+	for i := 0; i < 4; i += 1 {
+		m.Get("e")
+	}
+	m.Set("f", 6, 10)
+	c.Assert(m.Contains("b"), Equals, false)
+	c.Assert(m.Contains("a"), Equals, true)
+}
+
+func (s *TestSuite) TestEvictLFUDecay(c *C) {
+	m := s.newMap(2, Eviction(EvictLFU))
+	l := m.evictor.(*lfu)
+
+	m.Set("a", 1, 10)
+	for i := 0; i < 7; i += 1 {
+		m.Get("a")
+	}
+	c.Assert(m.elements["a"].counterEl.Priority, Equals, int64(8))
+
+	m.Set("b", 2, 10)
+	for i := 0; i < 11; i += 1 {
+		m.Get("b")
+	}
+	// 20 accesses with 2 elements halved the counters
+	c.Assert(l.accesses, Equals, 0)
+	c.Assert(m.elements["a"].counterEl.Priority, Equals, int64(4))
+	c.Assert(m.elements["b"].counterEl.Priority, Equals, int64(6))
+
+	m.Clear()
+	c.Assert(l.counters.Len(), Equals, 0)
+}
+
+func (s *TestSuite) TestEvictRandom(c *C) {
+	m := s.newMap(3, Eviction(EvictRandom))
+	r := m.evictor.(*randomEvictor)
+	c.Assert(m.writesOnRead(), Equals, false)
+
+	for i := 0; i < 20; i += 1 {
+		m.Set(fmt.Sprintf("k%d", i), i, 10)
+	}
+	c.Assert(m.Len(), Equals, 3)
+	c.Assert(r.elements, HasLen, 3)
+
+	// The expired element is removed before a random one
+	m.Set("a", 1, 1)
+	live := m.Keys()
+	s.advanceSeconds(1)
+	m.Set("b", 2, 10)
+	for _, key := range live {
+		c.Assert(m.Contains(key), Equals, key != "a")
+	}
+
+	for i, mapEl := range r.elements {
+		c.Assert(mapEl.evictIndex, Equals, i)
+		c.Assert(m.elements[mapEl.key], Equals, mapEl)
+	}
+
+	m.Delete("b")
+	c.Assert(r.elements, HasLen, 2)
+}
+
+func (s *TestSuite) TestEvictionBatch(c *C) {
+	_, err := NewMap(1, EvictionBatch(0))
+	c.Assert(err, Not(Equals), nil)
+	_, err = NewMap(1, EvictionBatch(1.5))
+	c.Assert(err, Not(Equals), nil)
+
+	m := s.newMap(10, EvictionBatch(0.3))
+	for i := 0; i < 10; i += 1 {
+		m.Set(fmt.Sprintf("k%d", i), i, i+1)
+	}
+
+	// A full map evicts three elements at once
+	m.Set("a", 1, 20)
+	c.Assert(m.Len(), Equals, 8)
+	c.Assert(m.Contains("k2"), Equals, false)
+	c.Assert(m.Contains("k3"), Equals, true)
+
+	m.Set("b", 2, 20)
+	m.Set("c", 3, 20)
+	c.Assert(m.Len(), Equals, 10)
+
+	// Expired elements are removed one at a time
+	s.advanceSeconds(4)
+	m.Set("d", 4, 20)
+	c.Assert(m.Len(), Equals, 10)
+
+	// The batch is at least one element
+	m = s.newMap(2, EvictionBatch(0.1))
+	m.Set("a", 1, 1)
+	m.Set("b", 2, 2)
+	m.Set("c", 3, 3)
+	c.Assert(m.Len(), Equals, 2)
+}
+
+func (s *TestSuite) TestRejectWhenFull(c *C) {
+	m := s.newMap(2, RejectWhenFull())
+
+	m.Set("a", 1, 1)
+	m.Set("b", 2, 5)
+	c.Assert(m.Set("c", 3, 5), Equals, ErrFull)
+	c.Assert(m.Contains("a"), Equals, true)
+
+	// Overwriting is allowed
+	c.Assert(m.Set("a", 4, 1), Equals, nil)
+
+	_, err := m.Increment("c", 1, 5)
+	c.Assert(err, Equals, ErrFull)
+
+	// Expired elements still make room
+	s.advanceSeconds(1)
+	c.Assert(m.Set("c", 3, 5), Equals, nil)
+	c.Assert(m.Len(), Equals, 2)
+
+	c.Assert(m.SetCapacity(1), Equals, ErrFull)
+	c.Assert(m.Capacity(), Equals, 2)
+}
+
+func (s *TestSuite) TestRejectWhenFullMaxCost(c *C) {
+	m := s.newMap(10, RejectWhenFull(), WithSizer(byteSizer), MaxCost(10))
+
+	m.Set("a", make([]byte, 4), 1)
+	m.Set("b", make([]byte, 4), 5)
+	c.Assert(m.Set("c", make([]byte, 4), 5), Equals, ErrFull)
+
+	// Growing a live element is rejected rather than evicting another
+	c.Assert(m.Set("b", make([]byte, 7), 5), Equals, ErrFull)
+	c.Assert(m.SetKeepTTL("b", make([]byte, 7)), Equals, false)
+	valI, _ := m.Get("b")
+	c.Assert(valI, HasLen, 4)
+
+	s.advanceSeconds(1)
+	c.Assert(m.Set("b", make([]byte, 7), 5), Equals, nil)
+	c.Assert(m.Contains("a"), Equals, false)
+	c.Assert(m.Cost(), Equals, int64(7))
+}
+
+func (s *TestSuite) TestWatermarks(c *C) {
+	_, err := NewMap(1, Watermarks(0.5, 0.8))
+	c.Assert(err, Not(Equals), nil)
+	_, err = NewMap(1, Watermarks(0.8, 0.5), RejectWhenFull())
+	c.Assert(err, Not(Equals), nil)
+
+	m := s.newMap(10, Watermarks(0.8, 0.5))
+	for i := 0; i < 8; i += 1 {
+		m.Set(fmt.Sprintf("k%d", i), i, i+1)
+	}
+	c.Assert(m.Len(), Equals, 8)
+
+	// Reaching the high watermark evicts down to the low watermark
+	m.Set("a", 1, 20)
+	c.Assert(m.Len(), Equals, 6)
+	c.Assert(m.Contains("k2"), Equals, false)
+	c.Assert(m.Contains("k3"), Equals, true)
+	c.Assert(m.Contains("a"), Equals, true)
+}
+
+func (s *TestSuite) TestWatermarksReaper(c *C) {
+	m := s.newMap(10, Watermarks(0.8, 0.5), ReapInterval(time.Hour))
+	defer m.StopReaper()
+
+	for i := 0; i < 10; i += 1 {
+		m.Set(fmt.Sprintf("k%d", i), i, i+1)
+	}
+	// Writes leave the trimming to the reaper
+	c.Assert(m.Len(), Equals, 10)
+
+	m.lockNTrim()
+	c.Assert(m.Len(), Equals, 5)
+	c.Assert(m.Contains("k5"), Equals, true)
+}
+
+func (s *TestSuite) TestEvictionChannel(c *C) {
+	_, err := NewMap(1, EvictionChannel(0))
+	c.Assert(err, Not(Equals), nil)
+
+	m := s.newMap(1)
+	c.Assert(m.Evictions(), IsNil)
+
+	m = s.newMap(1, EvictionChannel(1))
+	m.Set("a", 1, 1)
+	m.Set("b", 2, 5)
+
+	evicted := <-m.Evictions()
+	c.Assert(evicted, Equals, EvictedEntry{Key: "a", Value: 1, EvictedAt: s.timeProvider.UtcNow()})
+
+	// Expired elements are not delivered
+	s.advanceSeconds(5)
+	m.Set("c", 3, 5)
+	c.Assert(len(m.Evictions()), Equals, 0)
+
+	// Entries are dropped while the buffer is full
+	m.Set("d", 4, 5)
+	m.Set("e", 5, 5)
+	c.Assert(len(m.Evictions()), Equals, 1)
+	c.Assert(m.DroppedEvictions(), Equals, 1)
+	c.Assert((<-m.Evictions()).Key, Equals, "c")
+}
@@ -0,0 +1,40 @@
+package ttlmap
+
+import (
+	"errors"
+	"expvar"
+	"fmt"
+	"sync"
+)
+
+// PublishExpvar publishes the Stats of the map under the given expvar name,
+// so they show up in /debug/vars. The stats are read whenever the variable
+// is. expvar can not unpublish variables, the name stays taken, and the map
+// referenced, for the life of the process. A ShardedMap publishes the totals
+// of its shards.
+func PublishExpvar(name string) TtlMapOption {
+	return func(m *TtlMap) error {
+		if name == "" {
+			return errors.New("Expvar name should not be empty")
+		}
+		m.expvarName = name
+		return nil
+	}
+}
+
+// expvarMutex makes checking for and publishing a name atomic, expvar panics
+// on names published twice
+var expvarMutex sync.Mutex
+
+func publishExpvar(name string, stats func() Stats) error {
+	expvarMutex.Lock()
+	defer expvarMutex.Unlock()
+
+	if expvar.Get(name) != nil {
+		return fmt.Errorf("Expvar %q is already published", name)
+	}
+	expvar.Publish(name, expvar.Func(func() interface{} {
+		return stats()
+	}))
+	return nil
+}
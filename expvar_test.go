@@ -0,0 +1,38 @@
+package ttlmap
+
+import (
+	"encoding/json"
+	"expvar"
+	"fmt"
+
+	. "gopkg.in/check.v1"
+)
+
+// expvarRuns keeps the names unique when the tests run more than once
+var expvarRuns int
+
+func (s *TestSuite) TestPublishExpvar(c *C) {
+	expvarRuns += 1
+	name := fmt.Sprintf("ttlmap_test_map_%d", expvarRuns)
+	shardedName := fmt.Sprintf("ttlmap_test_sharded_%d", expvarRuns)
+
+	m := s.newMap(10, PublishExpvar(name))
+	m.Set("a", 1, 10)
+	m.Get("a")
+	m.Get("b")
+
+	var stats Stats
+	c.Assert(json.Unmarshal([]byte(expvar.Get(name).String()), &stats), IsNil)
+	c.Assert(stats, DeepEquals, Stats{Hits: 1, Misses: 1, Sets: 1, Len: 1})
+
+	_, err := NewMap(10, PublishExpvar(name))
+	c.Assert(err, ErrorMatches, `Expvar "ttlmap_test_map_.*" is already published`)
+	_, err = NewMap(10, PublishExpvar(""))
+	c.Assert(err, NotNil)
+
+	sm := s.newShardedMap(16, Shards(4), PublishExpvar(shardedName))
+	sm.Set("a", 1, 10)
+	sm.Set("b", 1, 10)
+	c.Assert(json.Unmarshal([]byte(expvar.Get(shardedName).String()), &stats), IsNil)
+	c.Assert(stats.Len, Equals, 2)
+}
@@ -0,0 +1,67 @@
+package ttlmap
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// FlushAt schedules the invalidation of all elements at the given time.
+// Every element present at that time expires at once, elements set after it
+// are not affected. Rather than running a timer, elements are scheduled to
+// expire no later than the pending flush, so the regular expiration
+// machinery, including the expiration callback, takes care of them.
+func (m *TtlMap) FlushAt(t time.Time) error {
+	if m.mutex != nil {
+		m.mutex.Lock()
+		defer m.mutex.Unlock()
+	}
+
+	now := m.currentTime()
+	if !t.After(now) {
+		return fmt.Errorf("Flush time should be in the future, got %v", t)
+	}
+	flushAt := m.sinceBase(t)
+
+	// Drop the flushes that already happened
+	nowNano := m.sinceBase(now)
+	for len(m.flushes) > 0 && m.flushes[0] <= nowNano {
+		m.flushes = m.flushes[1:]
+	}
+	i := sort.Search(len(m.flushes), func(i int) bool { return m.flushes[i] >= flushAt })
+	if i < len(m.flushes) && m.flushes[i] == flushAt {
+		return nil
+	}
+	m.flushes = append(m.flushes, 0)
+	copy(m.flushes[i+1:], m.flushes[i:])
+	m.flushes[i] = flushAt
+
+	// Only the earliest pending flush affects the elements present now
+	if i == 0 {
+		var flushed []*mapElement
+		m.expiryTimes.ForEach(func(heapEl *heapElement) bool {
+			if heapEl.Priority > flushAt {
+				flushed = append(flushed, heapEl.Value.(*mapElement))
+			}
+			return true
+		})
+		for _, mapEl := range flushed {
+			m.expiryTimes.UpdateEl(&mapEl.heapEl, flushAt)
+			m.rescheduled(mapEl)
+		}
+	}
+	return nil
+}
+
+// clampToFlush caps the expiry time at the first flush pending after now
+func (m *TtlMap) clampToFlush(expiryTime, now int64) int64 {
+	for _, flushAt := range m.flushes {
+		if flushAt > now {
+			if expiryTime > flushAt {
+				return flushAt
+			}
+			return expiryTime
+		}
+	}
+	return expiryTime
+}
@@ -0,0 +1,85 @@
+package ttlmap
+
+import (
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+func (s *TestSuite) TestFlushAt(c *C) {
+	var expired []string
+	m := s.newMap(4, CallOnExpire(func(k string, el interface{}) {
+		expired = append(expired, k)
+	}))
+	start := s.timeProvider.UtcNow()
+
+	c.Assert(m.FlushAt(start), Not(Equals), nil)
+
+	m.Set("a", 1, 1)
+	m.Set("b", 2, 10)
+	m.Set("c", 3, NoExpiration)
+
+	c.Assert(m.FlushAt(start.Add(5*time.Second)), Equals, nil)
+
+	// Elements set before the flush are capped as well
+	m.Set("d", 4, 10)
+	expiresAt, _ := m.ExpiresAt("d")
+	c.Assert(expiresAt, Equals, start.Add(5*time.Second))
+
+	expiresAt, _ = m.ExpiresAt("a")
+	c.Assert(expiresAt, Equals, start.Add(time.Second))
+
+	s.advanceSeconds(4)
+	c.Assert(m.LiveLen(), Equals, 3)
+
+	s.advanceSeconds(1)
+	c.Assert(m.LiveLen(), Equals, 0)
+	c.Assert(m.RemoveExpired(0), HasLen, 4)
+
+	// Elements set after the flush are not affected
+	m.Set("e", 5, 10)
+	expiresAt, _ = m.ExpiresAt("e")
+	c.Assert(expiresAt, Equals, start.Add(15*time.Second))
+}
+
+func (s *TestSuite) TestFlushAtMultiple(c *C) {
+	m := s.newMap(2)
+	start := s.timeProvider.UtcNow()
+
+	c.Assert(m.FlushAt(start.Add(10*time.Second)), Equals, nil)
+	c.Assert(m.FlushAt(start.Add(5*time.Second)), Equals, nil)
+	c.Assert(m.FlushAt(start.Add(5*time.Second)), Equals, nil)
+	c.Assert(m.flushes, HasLen, 2)
+
+	m.Set("a", 1, 20)
+	expiresAt, _ := m.ExpiresAt("a")
+	c.Assert(expiresAt, Equals, start.Add(5*time.Second))
+
+	s.advanceSeconds(5)
+
+	m.Set("a", 1, 20)
+	expiresAt, _ = m.ExpiresAt("a")
+	c.Assert(expiresAt, Equals, start.Add(10*time.Second))
+
+	s.advanceSeconds(5)
+
+	m.Set("a", 1, 20)
+	expiresAt, _ = m.ExpiresAt("a")
+	c.Assert(expiresAt, Equals, start.Add(30*time.Second))
+}
+
+func (s *TestSuite) TestFlushAtSlidingExpiration(c *C) {
+	m := s.newMap(1, SlidingExpiration())
+	start := s.timeProvider.UtcNow()
+
+	m.Set("a", 1, 3)
+	c.Assert(m.FlushAt(start.Add(4*time.Second)), Equals, nil)
+
+	s.advanceSeconds(2)
+	_, exists := m.Get("a")
+	c.Assert(exists, Equals, true)
+
+	s.advanceSeconds(2)
+	_, exists = m.Get("a")
+	c.Assert(exists, Equals, false)
+}
@@ -0,0 +1,51 @@
+//go:build go1.18
+// +build go1.18
+
+package generic
+
+import "github.com/mailgun/ttlmap"
+
+// Number is satisfied by the integer and floating point types and the types
+// defined over them
+type Number interface {
+	~int | ~int8 | ~int16 | ~int32 | ~int64 |
+		~uint | ~uint8 | ~uint16 | ~uint32 | ~uint64 | ~uintptr |
+		~float32 | ~float64
+}
+
+// Counters is a Map of numbers that can be added to atomically, whatever
+// their type. Unlike TtlMap.Increment, which only adds to int values, the
+// values can not be of another type.
+type Counters[K comparable, N Number] struct {
+	*Map[K, N]
+}
+
+// NewCounters creates counters that are not safe for concurrent use
+func NewCounters[K comparable, N Number](capacity int, opts ...ttlmap.TtlMapOption) (*Counters[K, N], error) {
+	m, err := New[K, N](capacity, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &Counters[K, N]{m}, nil
+}
+
+// NewConcurrentCounters creates counters that are safe for concurrent use
+func NewConcurrentCounters[K comparable, N Number](capacity int, opts ...ttlmap.TtlMapOption) (*Counters[K, N], error) {
+	m, err := NewConcurrent[K, N](capacity, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &Counters[K, N]{m}, nil
+}
+
+// Add adds delta to the live counter with the given key, or sets it to delta
+// if there is none, and returns the result. Like Increment, the ttl is reset
+// to the given one. Integers wrap around on overflow.
+func (c *Counters[K, N]) Add(key K, delta N, ttlSeconds int) (N, error) {
+	var sum N
+	err := c.Update(key, ttlSeconds, func(current N, exists bool) (N, error) {
+		sum = current + delta
+		return sum, nil
+	})
+	return sum, err
+}
@@ -0,0 +1,60 @@
+//go:build go1.18
+// +build go1.18
+
+package generic
+
+import (
+	"sync"
+	"time"
+
+	"github.com/mailgun/ttlmap"
+	. "gopkg.in/check.v1"
+)
+
+type hits uint32
+
+func (s *TestSuite) TestCounters(c *C) {
+	ints, err := NewCounters[string, int64](10, ttlmap.Clock(s.timeProvider))
+	c.Assert(err, IsNil)
+	value, err := ints.Add("a", 1<<40, 1)
+	c.Assert(err, IsNil)
+	c.Assert(value, Equals, int64(1<<40))
+	value, _ = ints.Add("a", -1, 1)
+	c.Assert(value, Equals, int64(1<<40-1))
+
+	s.advanceSeconds(1)
+	value, _ = ints.Add("a", 5, 1)
+	c.Assert(value, Equals, int64(5))
+
+	floats, _ := NewCounters[string, float64](10, ttlmap.Clock(s.timeProvider))
+	floats.Add("a", 0.5, 10)
+	sum, _ := floats.Add("a", 0.25, 10)
+	c.Assert(sum, Equals, 0.75)
+
+	defined, _ := NewCounters[int, hits](10, ttlmap.Clock(s.timeProvider))
+	defined.Add(1, 1<<32-1, 10)
+	wrapped, _ := defined.Add(1, 2, 10)
+	c.Assert(wrapped, Equals, hits(1))
+
+	_, err = ints.Add("b", 1, 0)
+	c.Assert(err, NotNil)
+	c.Assert(ints.Contains("b"), Equals, false)
+}
+
+func (s *TestSuite) TestCountersConcurrent(c *C) {
+	counters, _ := NewConcurrentCounters[string, uint64](10)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i += 1 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 1000; j += 1 {
+				counters.Add("a", 1, 10)
+			}
+		}()
+	}
+	wg.Wait()
+	value, ttl, _ := counters.GetWithTTL("a")
+	c.Assert(value, Equals, uint64(8000))
+	c.Assert(ttl > 9*time.Second, Equals, true)
+}
@@ -0,0 +1,246 @@
+//go:build go1.18
+// +build go1.18
+
+package generic
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"reflect"
+	"sync"
+	"unsafe"
+)
+
+// keyCodec maps the keys of a Map to the keys of the underlying map and
+// back. String keys are used as they are. Keys made of numbers, bools and
+// strings, also within arrays and structs, are encoded from their memory
+// without reflection or allocations and decoded again by Keys, Range and the
+// callbacks. Keys holding pointers, channels or interfaces can not be
+// decoded, they are encoded with reflection and stored next to the values.
+type keyCodec struct {
+	kind   keyKind
+	fields []keyField
+}
+
+type keyKind int
+
+const (
+	stringKey keyKind = iota
+	flatKey
+	boxedKey
+)
+
+// keyField is a number, bool or string within a flat key
+type keyField struct {
+	offset uintptr
+	size   uintptr
+	kind   reflect.Kind
+}
+
+// flatKeyBuffer is the size of the buffers flat keys are encoded in without
+// allocating
+const flatKeyBuffer = 64
+
+func newKeyCodec[K comparable]() *keyCodec {
+	t := reflect.TypeOf((*K)(nil)).Elem()
+	if t.Kind() == reflect.String {
+		return &keyCodec{kind: stringKey}
+	}
+	if fields, ok := flatten(nil, t, 0); ok {
+		return &keyCodec{kind: flatKey, fields: fields}
+	}
+	return &keyCodec{kind: boxedKey}
+}
+
+// flatten appends the fields of a value of type t at the given offset, ok is
+// false if it holds anything else than numbers, bools and strings
+func flatten(fields []keyField, t reflect.Type, offset uintptr) ([]keyField, bool) {
+	switch t.Kind() {
+	case reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64, reflect.Complex64, reflect.Complex128, reflect.String:
+		return append(fields, keyField{offset: offset, size: t.Size(), kind: t.Kind()}), true
+	case reflect.Array:
+		for i := 0; i < t.Len(); i += 1 {
+			var ok bool
+			if fields, ok = flatten(fields, t.Elem(), offset+uintptr(i)*t.Elem().Size()); !ok {
+				return nil, false
+			}
+		}
+		return fields, true
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i += 1 {
+			f := t.Field(i)
+			// == ignores blank fields
+			if f.Name == "_" {
+				continue
+			}
+			var ok bool
+			if fields, ok = flatten(fields, f.Type, offset+f.Offset); !ok {
+				return nil, false
+			}
+		}
+		return fields, true
+	}
+	return nil, false
+}
+
+// encode appends the encoding of the flat key at p. Strings are prefixed
+// with their length, everything else is copied as it is in memory but for
+// negative zeros, which == equal to zeros.
+func (c *keyCodec) encode(b []byte, p unsafe.Pointer) []byte {
+	for _, f := range c.fields {
+		q := unsafe.Add(p, f.offset)
+		switch f.kind {
+		case reflect.String:
+			s := *(*string)(q)
+			b = appendUvarint(b, uint64(len(s)))
+			b = append(b, s...)
+		case reflect.Float32:
+			b = appendFloat32(b, *(*float32)(q))
+		case reflect.Float64:
+			b = appendFloat64(b, *(*float64)(q))
+		case reflect.Complex64:
+			v := *(*complex64)(q)
+			b = appendFloat32(appendFloat32(b, real(v)), imag(v))
+		case reflect.Complex128:
+			v := *(*complex128)(q)
+			b = appendFloat64(appendFloat64(b, real(v)), imag(v))
+		default:
+			b = append(b, unsafe.Slice((*byte)(q), f.size)...)
+		}
+	}
+	return b
+}
+
+// decode sets the flat key at p from its encoding
+func (c *keyCodec) decode(key string, p unsafe.Pointer) {
+	for _, f := range c.fields {
+		q := unsafe.Add(p, f.offset)
+		if f.kind == reflect.String {
+			n, read := uvarint(key)
+			*(*string)(q) = key[read : read+n]
+			key = key[read+n:]
+			continue
+		}
+		key = key[copy(unsafe.Slice((*byte)(q), f.size), key):]
+	}
+}
+
+// uvarint is binary.Uvarint for a string
+func uvarint(s string) (value int, read int) {
+	shift := 0
+	for s[read] >= 0x80 {
+		value |= int(s[read]&0x7f) << shift
+		shift += 7
+		read += 1
+	}
+	value |= int(s[read]) << shift
+	return value, read + 1
+}
+
+func appendFloat32(b []byte, f float32) []byte {
+	if f == 0 {
+		f = 0
+	}
+	return append(b, unsafe.Slice((*byte)(unsafe.Pointer(&f)), 4)...)
+}
+
+func appendFloat64(b []byte, f float64) []byte {
+	if f == 0 {
+		f = 0
+	}
+	return append(b, unsafe.Slice((*byte)(unsafe.Pointer(&f)), 8)...)
+}
+
+// boxedKeyOf encodes a key that can not be decoded with appendKey
+func boxedKeyOf[K comparable](key K) string {
+	var buf [flatKeyBuffer]byte
+	return string(appendKey(buf[:0], reflect.ValueOf(&key).Elem()))
+}
+
+// appendKey appends the encoding of a comparable value. The values behind
+// interfaces are prefixed with the id of their dynamic type, strings with
+// their length and the rest has a fixed layout or a self delimiting varint,
+// so every encoding tells apart the values of its type.
+func appendKey(b []byte, v reflect.Value) []byte {
+	switch v.Kind() {
+	case reflect.Interface:
+		if v.IsNil() {
+			return append(b, 0)
+		}
+		b = appendUvarint(b, typeID(v.Elem().Type()))
+		return appendKey(b, v.Elem())
+	case reflect.String:
+		b = appendUvarint(b, uint64(v.Len()))
+		return append(b, v.String()...)
+	case reflect.Bool:
+		if v.Bool() {
+			return append(b, 1)
+		}
+		return append(b, 0)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return appendUvarint(b, uint64(v.Int()))
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return appendUvarint(b, v.Uint())
+	case reflect.Float32, reflect.Float64:
+		return appendFloat(b, v.Float())
+	case reflect.Complex64, reflect.Complex128:
+		c := v.Complex()
+		return appendFloat(appendFloat(b, real(c)), imag(c))
+	case reflect.Ptr, reflect.Chan, reflect.UnsafePointer:
+		return appendUvarint(b, uint64(v.Pointer()))
+	case reflect.Array:
+		for i := 0; i < v.Len(); i += 1 {
+			b = appendKey(b, v.Index(i))
+		}
+		return b
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i += 1 {
+			if v.Type().Field(i).Name == "_" {
+				continue
+			}
+			b = appendKey(b, v.Field(i))
+		}
+		return b
+	}
+	panic(fmt.Sprintf("Key of unhashable type %v", v.Type()))
+}
+
+func appendUvarint(b []byte, x uint64) []byte {
+	var buf [binary.MaxVarintLen64]byte
+	return append(b, buf[:binary.PutUvarint(buf[:], x)]...)
+}
+
+func appendFloat(b []byte, f float64) []byte {
+	// -0 == 0
+	if f == 0 {
+		f = 0
+	}
+	var buf [8]byte
+	binary.LittleEndian.PutUint64(buf[:], math.Float64bits(f))
+	return append(b, buf[:]...)
+}
+
+var (
+	// typeIDs numbers the dynamic types of interface keys, from 1 on
+	typeIDs     sync.Map
+	typeIDMutex sync.Mutex
+	lastTypeID  uint64
+)
+
+func typeID(t reflect.Type) uint64 {
+	if id, ok := typeIDs.Load(t); ok {
+		return id.(uint64)
+	}
+	typeIDMutex.Lock()
+	defer typeIDMutex.Unlock()
+
+	if id, ok := typeIDs.Load(t); ok {
+		return id.(uint64)
+	}
+	lastTypeID += 1
+	typeIDs.Store(t, lastTypeID)
+	return lastTypeID
+}
@@ -0,0 +1,259 @@
+//go:build go1.18
+// +build go1.18
+
+// Package generic provides type safe wrappers over ttlmap.TtlMap. Expiry,
+// eviction and all the options are those of the underlying map, the
+// wrappers only take care of the keys and values, so callers no longer
+// assert types on every read.
+package generic
+
+import (
+	"time"
+	"unsafe"
+
+	"github.com/mailgun/ttlmap"
+)
+
+// Map is a TtlMap with keys of type K and values of type V. Values are
+// stored as they are, the keys are encoded into the keys of the underlying
+// map, see keyCodec. Keys of strings, numbers and bools, and of arrays and
+// structs of them, are looked up without allocating.
+type Map[K comparable, V any] struct {
+	m     *ttlmap.TtlMap
+	codec *keyCodec
+}
+
+// entry is what Map stores in the underlying map for keys that can not be
+// decoded, the key is kept along with the value so Keys and Range can
+// return it
+type entry[K comparable, V any] struct {
+	key   K
+	value V
+}
+
+// New creates a map that is not safe for concurrent use, see ttlmap.NewMap
+func New[K comparable, V any](capacity int, opts ...ttlmap.TtlMapOption) (*Map[K, V], error) {
+	m, err := ttlmap.NewMap(capacity, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &Map[K, V]{m: m, codec: newKeyCodec[K]()}, nil
+}
+
+// NewConcurrent creates a map that is safe for concurrent use, see
+// ttlmap.NewConcurrent
+func NewConcurrent[K comparable, V any](capacity int, opts ...ttlmap.TtlMapOption) (*Map[K, V], error) {
+	m, err := ttlmap.NewConcurrent(capacity, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &Map[K, V]{m: m, codec: newKeyCodec[K]()}, nil
+}
+
+// OnExpire is ttlmap.CallOnExpire for a Map with keys of type K and values
+// of type V
+func OnExpire[K comparable, V any](cb func(key K, value V)) ttlmap.TtlMapOption {
+	codec := newKeyCodec[K]()
+	return ttlmap.CallOnExpire(func(key string, value interface{}) {
+		cb(decodeKey[K, V](codec, key, value), unwrapValue[K, V](codec, value))
+	})
+}
+
+// OnRemove is ttlmap.OnRemove for a Map with keys of type K and values of
+// type V
+func OnRemove[K comparable, V any](cb func(key K, value V, reason ttlmap.RemovalReason)) ttlmap.TtlMapOption {
+	codec := newKeyCodec[K]()
+	return ttlmap.OnRemove(func(key string, value interface{}, reason ttlmap.RemovalReason) {
+		cb(decodeKey[K, V](codec, key, value), unwrapValue[K, V](codec, value), reason)
+	})
+}
+
+// key returns the key of the underlying map
+func (m *Map[K, V]) key(key K) string {
+	switch m.codec.kind {
+	case stringKey:
+		return *(*string)(unsafe.Pointer(&key))
+	case flatKey:
+		var buf [flatKeyBuffer]byte
+		return string(m.codec.encode(buf[:0], unsafe.Pointer(&key)))
+	}
+	return boxedKeyOf(key)
+}
+
+// wrap returns what is stored in the underlying map for the value
+func (m *Map[K, V]) wrap(key K, value V) interface{} {
+	if m.codec.kind == boxedKey {
+		return entry[K, V]{key, value}
+	}
+	return value
+}
+
+func (m *Map[K, V]) unwrap(value interface{}, ok bool) (V, bool) {
+	if !ok {
+		var zero V
+		return zero, false
+	}
+	return unwrapValue[K, V](m.codec, value), true
+}
+
+func unwrapValue[K comparable, V any](codec *keyCodec, value interface{}) V {
+	if codec.kind == boxedKey {
+		return value.(entry[K, V]).value
+	}
+	// A nil interface{} is the zero V of interface types
+	v, _ := value.(V)
+	return v
+}
+
+// decodeKey returns the key of an element of the underlying map
+func decodeKey[K comparable, V any](codec *keyCodec, key string, value interface{}) K {
+	var k K
+	switch codec.kind {
+	case stringKey:
+		*(*string)(unsafe.Pointer(&k)) = key
+	case flatKey:
+		codec.decode(key, unsafe.Pointer(&k))
+	default:
+		k = value.(entry[K, V]).key
+	}
+	return k
+}
+
+func (m *Map[K, V]) Set(key K, value V, ttlSeconds int) error {
+	if m.codec.kind == flatKey {
+		// The key is only copied if it is new
+		var buf [flatKeyBuffer]byte
+		return m.m.SetByBytes(m.codec.encode(buf[:0], unsafe.Pointer(&key)), value, ttlSeconds)
+	}
+	return m.m.Set(m.key(key), m.wrap(key, value), ttlSeconds)
+}
+
+func (m *Map[K, V]) SetWithDuration(key K, value V, ttl time.Duration) error {
+	return m.m.SetWithDuration(m.key(key), m.wrap(key, value), ttl)
+}
+
+func (m *Map[K, V]) Get(key K) (V, bool) {
+	if m.codec.kind == flatKey {
+		var buf [flatKeyBuffer]byte
+		return m.unwrap(m.m.GetByBytes(m.codec.encode(buf[:0], unsafe.Pointer(&key))))
+	}
+	return m.unwrap(m.m.Get(m.key(key)))
+}
+
+func (m *Map[K, V]) GetWithTTL(key K) (V, time.Duration, bool) {
+	value, ttl, ok := m.m.GetWithTTL(m.key(key))
+	v, ok := m.unwrap(value, ok)
+	return v, ttl, ok
+}
+
+// GetOrSet returns the value of the live element with the given key if there
+// is one, otherwise sets and returns the given value. loaded is true if the
+// value was already present.
+func (m *Map[K, V]) GetOrSet(key K, value V, ttlSeconds int) (actual V, loaded bool, err error) {
+	a, loaded, err := m.m.GetOrSet(m.key(key), m.wrap(key, value), ttlSeconds)
+	if err != nil {
+		return actual, false, err
+	}
+	return unwrapValue[K, V](m.codec, a), loaded, nil
+}
+
+// GetOrCompute is ttlmap.TtlMap.GetOrCompute with a typed fn
+func (m *Map[K, V]) GetOrCompute(key K, ttlSeconds int, fn func() (V, error)) (V, error) {
+	value, err := m.m.GetOrCompute(m.key(key), ttlSeconds, func() (interface{}, error) {
+		v, err := fn()
+		return m.wrap(key, v), err
+	})
+	if err != nil {
+		var zero V
+		return zero, err
+	}
+	return unwrapValue[K, V](m.codec, value), nil
+}
+
+// Update is ttlmap.TtlMap.Update with a typed fn
+func (m *Map[K, V]) Update(key K, ttlSeconds int, fn func(current V, exists bool) (V, error)) error {
+	return m.m.Update(m.key(key), ttlSeconds, func(current interface{}, exists bool) (interface{}, error) {
+		v, err := fn(m.unwrap(current, exists))
+		return m.wrap(key, v), err
+	})
+}
+
+func (m *Map[K, V]) Contains(key K) bool {
+	if m.codec.kind == flatKey {
+		var buf [flatKeyBuffer]byte
+		return m.m.ContainsByBytes(m.codec.encode(buf[:0], unsafe.Pointer(&key)))
+	}
+	return m.m.Contains(m.key(key))
+}
+
+func (m *Map[K, V]) Delete(key K) bool {
+	if m.codec.kind == flatKey {
+		var buf [flatKeyBuffer]byte
+		return m.m.DeleteByBytes(m.codec.encode(buf[:0], unsafe.Pointer(&key)))
+	}
+	return m.m.Delete(m.key(key))
+}
+
+func (m *Map[K, V]) Pop(key K) (V, bool) {
+	return m.unwrap(m.m.Pop(m.key(key)))
+}
+
+func (m *Map[K, V]) Touch(key K, ttlSeconds int) bool {
+	return m.m.Touch(m.key(key), ttlSeconds)
+}
+
+func (m *Map[K, V]) ExpiresAt(key K) (time.Time, bool) {
+	return m.m.ExpiresAt(m.key(key))
+}
+
+// Keys returns the keys of the live elements in no particular order
+func (m *Map[K, V]) Keys() []K {
+	keys := make([]K, 0, m.m.Len())
+	m.m.Range(func(key string, value interface{}, _ time.Time) bool {
+		keys = append(keys, decodeKey[K, V](m.codec, key, value))
+		return true
+	})
+	return keys
+}
+
+// Range calls fn for every live element, see ttlmap.TtlMap.Range
+func (m *Map[K, V]) Range(fn func(key K, value V, expiresAt time.Time) bool) {
+	m.m.Range(func(key string, value interface{}, expiresAt time.Time) bool {
+		return fn(decodeKey[K, V](m.codec, key, value), unwrapValue[K, V](m.codec, value), expiresAt)
+	})
+}
+
+func (m *Map[K, V]) Len() int {
+	return m.m.Len()
+}
+
+// LiveLen returns the number of elements that have not expired
+func (m *Map[K, V]) LiveLen() int {
+	return m.m.LiveLen()
+}
+
+func (m *Map[K, V]) Capacity() int {
+	return m.m.Capacity()
+}
+
+func (m *Map[K, V]) SetCapacity(capacity int) error {
+	return m.m.SetCapacity(capacity)
+}
+
+func (m *Map[K, V]) Clear() {
+	m.m.Clear()
+}
+
+// RemoveExpired removes up to max expired elements, see
+// ttlmap.TtlMap.RemoveExpired, and returns their number
+func (m *Map[K, V]) RemoveExpired(max int) int {
+	return len(m.m.RemoveExpired(max))
+}
+
+func (m *Map[K, V]) StopReaper() {
+	m.m.StopReaper()
+}
+
+func (m *Map[K, V]) Close() {
+	m.m.Close()
+}
@@ -0,0 +1,186 @@
+//go:build go1.18
+// +build go1.18
+
+package generic
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/mailgun/timetools"
+	"github.com/mailgun/ttlmap"
+	. "gopkg.in/check.v1"
+)
+
+func Test(t *testing.T) { TestingT(t) }
+
+type TestSuite struct {
+	timeProvider *timetools.FreezedTime
+}
+
+var _ = Suite(&TestSuite{})
+
+func (s *TestSuite) SetUpTest(c *C) {
+	start := time.Date(2012, 3, 4, 5, 6, 7, 0, time.UTC)
+	s.timeProvider = &timetools.FreezedTime{CurrentTime: start}
+}
+
+func (s *TestSuite) advanceSeconds(seconds int) {
+	s.timeProvider.CurrentTime = s.timeProvider.CurrentTime.Add(time.Second * time.Duration(seconds))
+}
+
+type point struct {
+	x, y int
+}
+
+func (s *TestSuite) TestMap(c *C) {
+	m, err := NewConcurrent[string, int](10, ttlmap.Clock(s.timeProvider))
+	c.Assert(err, IsNil)
+
+	c.Assert(m.Set("a", 1, 1), IsNil)
+	c.Assert(m.Set("b", 2, 5), IsNil)
+	value, exists := m.Get("a")
+	c.Assert(exists, Equals, true)
+	c.Assert(value, Equals, 1)
+
+	value, exists = m.Get("c")
+	c.Assert(exists, Equals, false)
+	c.Assert(value, Equals, 0)
+
+	value, ttl, exists := m.GetWithTTL("b")
+	c.Assert(value, Equals, 2)
+	c.Assert(ttl, Equals, 5*time.Second)
+
+	actual, loaded, err := m.GetOrSet("a", 10, 1)
+	c.Assert(err, IsNil)
+	c.Assert(loaded, Equals, true)
+	c.Assert(actual, Equals, 1)
+
+	s.advanceSeconds(1)
+	c.Assert(m.Contains("a"), Equals, false)
+	keys := m.Keys()
+	c.Assert(keys, DeepEquals, []string{"b"})
+
+	c.Assert(m.Update("b", 5, func(current int, exists bool) (int, error) {
+		return current + 1, nil
+	}), IsNil)
+	value, _ = m.Get("b")
+	c.Assert(value, Equals, 3)
+
+	failed := errors.New("failed")
+	_, err = m.GetOrCompute("c", 5, func() (int, error) {
+		return 0, failed
+	})
+	c.Assert(err, Equals, failed)
+	value, err = m.GetOrCompute("c", 5, func() (int, error) {
+		return 7, nil
+	})
+	c.Assert(err, IsNil)
+	c.Assert(value, Equals, 7)
+
+	value, exists = m.Pop("c")
+	c.Assert(exists, Equals, true)
+	c.Assert(value, Equals, 7)
+	c.Assert(m.LiveLen(), Equals, 1)
+}
+
+func (s *TestSuite) TestMapKeys(c *C) {
+	m, err := New[point, string](10, ttlmap.Clock(s.timeProvider))
+	c.Assert(err, IsNil)
+
+	m.Set(point{1, 2}, "a", 10)
+	m.Set(point{2, 1}, "b", 10)
+	value, _ := m.Get(point{1, 2})
+	c.Assert(value, Equals, "a")
+
+	var found []point
+	m.Range(func(key point, value string, expiresAt time.Time) bool {
+		found = append(found, key)
+		return true
+	})
+	sort.Slice(found, func(i, j int) bool { return found[i].x < found[j].x })
+	c.Assert(found, DeepEquals, []point{{1, 2}, {2, 1}})
+
+	// Keys of different dynamic types do not collide
+	mixed, _ := New[interface{}, int](10, ttlmap.Clock(s.timeProvider))
+	mixed.Set("1", 1, 10)
+	mixed.Set(1, 2, 10)
+	c.Assert(mixed.Len(), Equals, 2)
+	value2, _ := mixed.Get("1")
+	c.Assert(value2, Equals, 1)
+
+	ints, _ := New[int, int](10, ttlmap.Clock(s.timeProvider))
+	ints.Set(-5, 5, 10)
+	c.Assert(ints.Keys(), DeepEquals, []int{-5})
+}
+
+type (
+	celsius    int
+	fahrenheit int
+)
+
+func (s *TestSuite) TestMapKeyCollisions(c *C) {
+	m, err := New[interface{}, string](20, ttlmap.Clock(s.timeProvider))
+	c.Assert(err, IsNil)
+
+	// Keys that are not == never share an element
+	keys := []interface{}{
+		1, int64(1), uint8(1), 1.0, float32(1), "1", true, nil,
+		celsius(1), fahrenheit(1), point{1, 2}, [2]int{1, 2},
+		struct{ A interface{} }{1}, struct{ A interface{} }{int64(1)},
+		"a", "a\x00", [2]string{"a", ""}, [2]string{"", "a"},
+	}
+	for i, key := range keys {
+		c.Assert(m.Set(key, fmt.Sprint(i), 10), IsNil)
+	}
+	c.Assert(m.Len(), Equals, len(keys))
+	for i, key := range keys {
+		value, ok := m.Get(key)
+		c.Assert(ok, Equals, true)
+		c.Assert(value, Equals, fmt.Sprint(i))
+	}
+
+	// Keys that are == do
+	m.Set(math.Copysign(0, -1), "negative", 10)
+	value, _ := m.Get(0.0)
+	c.Assert(value, Equals, "negative")
+}
+
+func (s *TestSuite) TestMapAllocations(c *C) {
+	strings, _ := New[string, *point](10)
+	strings.Set("a", &point{}, 10)
+	value := &point{1, 2}
+	c.Assert(testing.AllocsPerRun(100, func() { strings.Set("a", value, 10) }), Equals, 0.0)
+	c.Assert(testing.AllocsPerRun(100, func() { strings.Get("a") }), Equals, 0.0)
+
+	points, _ := New[point, *point](10)
+	points.Set(point{1, 2}, value, 10)
+	c.Assert(testing.AllocsPerRun(100, func() { points.Set(point{1, 2}, value, 10) }), Equals, 0.0)
+	c.Assert(testing.AllocsPerRun(100, func() { points.Get(point{1, 2}) }), Equals, 0.0)
+	c.Assert(testing.AllocsPerRun(100, func() { points.Contains(point{1, 2}) }), Equals, 0.0)
+	c.Assert(testing.AllocsPerRun(100, func() { points.Get(point{3, 4}) }), Equals, 0.0)
+}
+
+func (s *TestSuite) TestMapCallbacks(c *C) {
+	var expired []point
+	var removed []ttlmap.RemovalReason
+	m, _ := New[point, int](10, ttlmap.Clock(s.timeProvider),
+		OnExpire(func(key point, value int) {
+			expired = append(expired, key)
+		}),
+		OnRemove(func(key point, value int, reason ttlmap.RemovalReason) {
+			removed = append(removed, reason)
+		}))
+
+	m.Set(point{1, 1}, 1, 1)
+	m.Set(point{2, 2}, 2, 5)
+	m.Delete(point{2, 2})
+	s.advanceSeconds(1)
+	c.Assert(m.RemoveExpired(0), Equals, 1)
+	c.Assert(expired, DeepEquals, []point{{1, 1}})
+	c.Assert(removed, DeepEquals, []ttlmap.RemovalReason{ttlmap.Deleted, ttlmap.Expired})
+}
@@ -0,0 +1,76 @@
+//go:build go1.18
+// +build go1.18
+
+package generic
+
+import (
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/mailgun/ttlmap"
+)
+
+// View gives typed access to the values of an existing TtlMap, for code that
+// shares the map with untyped callers and can not move to Map yet. The keys
+// and values are stored as they are, so other users of the map see them
+// unchanged. Reading a value of another type returns an error instead of
+// panicking.
+type View[V any] struct {
+	m *ttlmap.TtlMap
+}
+
+// NewView returns a view of m with values of type V
+func NewView[V any](m *ttlmap.TtlMap) *View[V] {
+	return &View[V]{m: m}
+}
+
+// Map returns the underlying map
+func (v *View[V]) Map() *ttlmap.TtlMap {
+	return v.m
+}
+
+// as asserts value to V, it is the only place where views check types
+func (v *View[V]) as(value interface{}) (V, error) {
+	typed, ok := value.(V)
+	if !ok {
+		return typed, fmt.Errorf("Expected existing value to be %v, got %T",
+			reflect.TypeOf((*V)(nil)).Elem(), value)
+	}
+	return typed, nil
+}
+
+func (v *View[V]) Set(key string, value V, ttlSeconds int) error {
+	return v.m.Set(key, value, ttlSeconds)
+}
+
+func (v *View[V]) SetWithDuration(key string, value V, ttl time.Duration) error {
+	return v.m.SetWithDuration(key, value, ttl)
+}
+
+// Get returns the value of the live element with the given key, or an error
+// if the value is not of type V
+func (v *View[V]) Get(key string) (V, bool, error) {
+	value, exists := v.m.Get(key)
+	if !exists {
+		var zero V
+		return zero, false, nil
+	}
+	typed, err := v.as(value)
+	if err != nil {
+		return typed, false, err
+	}
+	return typed, true, nil
+}
+
+// GetOrSet returns the value of the live element with the given key if there
+// is one, otherwise sets and returns the given value. loaded is true if the
+// value was already present, an error is returned if it is not of type V.
+func (v *View[V]) GetOrSet(key string, value V, ttlSeconds int) (actual V, loaded bool, err error) {
+	a, loaded, err := v.m.GetOrSet(key, value, ttlSeconds)
+	if err != nil {
+		return actual, false, err
+	}
+	actual, err = v.as(a)
+	return actual, loaded, err
+}
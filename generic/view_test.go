@@ -0,0 +1,52 @@
+//go:build go1.18
+// +build go1.18
+
+package generic
+
+import (
+	"github.com/mailgun/ttlmap"
+	. "gopkg.in/check.v1"
+)
+
+func (s *TestSuite) TestView(c *C) {
+	m, err := ttlmap.NewMap(10, ttlmap.Clock(s.timeProvider))
+	c.Assert(err, IsNil)
+	v := NewView[int](m)
+	c.Assert(v.Map(), Equals, m)
+
+	c.Assert(v.Set("a", 1, 10), IsNil)
+	value, exists, err := v.Get("a")
+	c.Assert(err, IsNil)
+	c.Assert(exists, Equals, true)
+	c.Assert(value, Equals, 1)
+
+	// The value is stored as it is
+	raw, _ := m.Get("a")
+	c.Assert(raw, Equals, 1)
+
+	value, exists, err = v.Get("missing")
+	c.Assert(err, IsNil)
+	c.Assert(exists, Equals, false)
+
+	m.Set("b", "two", 10)
+	_, exists, err = v.Get("b")
+	c.Assert(err, ErrorMatches, "Expected existing value to be int, got string")
+	c.Assert(exists, Equals, false)
+
+	actual, loaded, err := v.GetOrSet("c", 3, 10)
+	c.Assert(err, IsNil)
+	c.Assert(loaded, Equals, false)
+	c.Assert(actual, Equals, 3)
+	actual, loaded, err = v.GetOrSet("c", 4, 10)
+	c.Assert(err, IsNil)
+	c.Assert(loaded, Equals, true)
+	c.Assert(actual, Equals, 3)
+
+	_, loaded, err = v.GetOrSet("b", 5, 10)
+	c.Assert(err, NotNil)
+	c.Assert(loaded, Equals, true)
+
+	errs := NewView[error](m)
+	_, _, err = errs.Get("a")
+	c.Assert(err, ErrorMatches, "Expected existing value to be error, got int")
+}
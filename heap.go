@@ -0,0 +1,67 @@
+package ttlmap
+
+import (
+	"container/heap"
+)
+
+// heapElement is an element of a minHeap. Priorities are int64, expiry times
+// are nanoseconds and would overflow an int on 32 bit platforms.
+type heapElement struct {
+	Value    interface{}
+	Priority int64
+	index    int
+}
+
+// minHeap is a binary min heap of elements ordered by priority
+type minHeap []*heapElement
+
+func newMinHeap() *minHeap {
+	return &minHeap{}
+}
+
+func (h minHeap) Len() int { return len(h) }
+
+func (h minHeap) Less(i, j int) bool { return h[i].Priority < h[j].Priority }
+
+func (h minHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *minHeap) Push(x interface{}) {
+	el := x.(*heapElement)
+	el.index = len(*h)
+	*h = append(*h, el)
+}
+
+func (h *minHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	el := old[n-1]
+	old[n-1] = nil
+	el.index = -1
+	*h = old[:n-1]
+	return el
+}
+
+func (h *minHeap) PushEl(el *heapElement) {
+	heap.Push(h, el)
+}
+
+func (h *minHeap) PopEl() *heapElement {
+	return heap.Pop(h).(*heapElement)
+}
+
+func (h *minHeap) PeekEl() *heapElement {
+	return (*h)[0]
+}
+
+func (h *minHeap) UpdateEl(el *heapElement, priority int64) {
+	el.Priority = priority
+	heap.Fix(h, el.index)
+}
+
+func (h *minHeap) RemoveEl(el *heapElement) {
+	heap.Remove(h, el.index)
+}
@@ -0,0 +1,25 @@
+package ttlmap
+
+import (
+	"math"
+
+	. "gopkg.in/check.v1"
+)
+
+func (s *TestSuite) TestMinHeap(c *C) {
+	h := newMinHeap()
+	els := map[int64]*heapElement{}
+	for _, priority := range []int64{5, math.MaxInt64, 1, 1 << 40, 3} {
+		els[priority] = &heapElement{Value: priority, Priority: priority}
+		h.PushEl(els[priority])
+	}
+	c.Assert(h.PeekEl(), Equals, els[1])
+
+	h.UpdateEl(els[5], 0)
+	h.RemoveEl(els[3])
+	var order []int64
+	for h.Len() > 0 {
+		order = append(order, h.PopEl().Value.(int64))
+	}
+	c.Assert(order, DeepEquals, []int64{5, 1, 1 << 40, math.MaxInt64})
+}
@@ -0,0 +1,131 @@
+package ttlmap
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// HotKeyCache puts a front cache for the given number of most read keys in
+// front of Get. Hits are served from an immutable snapshot without taking
+// the map lock or writing any shared memory, so a handful of extremely hot
+// keys no longer funnel all their reads through the lock. A sample of the
+// reads is counted to find the hottest keys, the cache is rebuilt every
+// hotWindow samples. Writes to cached keys replace the snapshot, so the cache
+// suits small sizes and keys read far more often than written. Can not be
+// combined with options that modify the map on reads: SlidingExpiration,
+// access tracking eviction policies and TinyLFUAdmission.
+func HotKeyCache(size int) TtlMapOption {
+	return func(m *TtlMap) error {
+		if size <= 0 {
+			return fmt.Errorf("Hot key cache size should be > 0, got %d", size)
+		}
+		m.hot = &hotCache{size: size, counts: make(map[string]int)}
+		m.hot.entries.Store(map[string]*readEntry{})
+		return nil
+	}
+}
+
+const (
+	// hotSampleRate is the share of reads counted, it is a power of two
+	hotSampleRate = 16
+	// hotWindow is the number of counted reads between rebuilds
+	hotWindow = 512
+)
+
+type hotCache struct {
+	size int
+	// entries maps the hot keys to snapshots of their elements, nil if the
+	// key has no element. The map is replaced rather than modified.
+	entries atomic.Value
+	// counts are the sampled reads by key since the last rebuild
+	mutex   sync.Mutex
+	counts  map[string]int
+	samples int
+}
+
+// load returns the snapshot of a hot key, hot is false if the key is not
+// cached
+func (h *hotCache) load(key string) (entry *readEntry, hot bool) {
+	entry, hot = h.entries.Load().(map[string]*readEntry)[key]
+	return entry, hot
+}
+
+// update replaces the snapshot of the key if it is hot, it must be called
+// with the map locked for writing
+func (h *hotCache) update(key string, entry *readEntry) {
+	entries := h.entries.Load().(map[string]*readEntry)
+	if _, hot := entries[key]; !hot {
+		return
+	}
+	updated := make(map[string]*readEntry, len(entries))
+	for k, e := range entries {
+		updated[k] = e
+	}
+	updated[key] = entry
+	h.entries.Store(updated)
+}
+
+// record counts a sampled read and returns the hottest keys once the window
+// is full
+func (h *hotCache) record(key string) []string {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	h.counts[key] += 1
+	h.samples += 1
+	if h.samples < hotWindow {
+		return nil
+	}
+	keys := make([]string, 0, len(h.counts))
+	for k := range h.counts {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if h.counts[keys[i]] != h.counts[keys[j]] {
+			return h.counts[keys[i]] > h.counts[keys[j]]
+		}
+		return keys[i] < keys[j]
+	})
+	if len(keys) > h.size {
+		keys = keys[:h.size]
+	}
+	h.counts = make(map[string]int)
+	h.samples = 0
+	return keys
+}
+
+// hotGet serves Get from the hot key cache, hit is false if the key has to be
+// looked up in the map. The low bits of the current time decide whether the
+// read is sampled, which unlike a shared counter costs the readers nothing.
+func (m *TtlMap) hotGet(key string) (value interface{}, hit bool) {
+	now := m.now()
+	if now&(hotSampleRate-1) == 0 {
+		if keys := m.hot.record(key); keys != nil {
+			m.promote(keys)
+		}
+	}
+	entry, hot := m.hot.load(key)
+	if !hot || entry == nil || entry.expiryTime <= now {
+		return nil, false
+	}
+	return entry.value, true
+}
+
+// promote makes the given keys the cached ones
+func (m *TtlMap) promote(keys []string) {
+	if m.mutex != nil {
+		m.mutex.RLock()
+		defer m.mutex.RUnlock()
+	}
+
+	entries := make(map[string]*readEntry, len(keys))
+	for _, key := range keys {
+		entries[key] = nil
+		if mapEl, ok := m.elements[key]; ok {
+			entries[key] = &readEntry{value: mapEl.value, expiryTime: mapEl.heapEl.Priority}
+		}
+	}
+	m.hot.entries.Store(entries)
+}
@@ -0,0 +1,113 @@
+package ttlmap
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	. "gopkg.in/check.v1"
+)
+
+func (s *TestSuite) TestHotKeyCacheValidation(c *C) {
+	_, err := NewConcurrent(1, HotKeyCache(0))
+	c.Assert(err, Not(Equals), nil)
+
+	_, err = NewConcurrent(1, HotKeyCache(2), Eviction(EvictLRU))
+	c.Assert(err, Not(Equals), nil)
+}
+
+func (s *TestSuite) TestHotKeyCache(c *C) {
+	m := s.newMap(10, HotKeyCache(2))
+	for _, key := range []string{"a", "b", "c", "d"} {
+		m.Set(key, key, 10)
+	}
+
+	// The frozen clock samples every read, a full window promotes the
+	// most read keys
+	for i := 0; i < hotWindow; i += 1 {
+		switch {
+		case i%2 == 0:
+			m.Get("a")
+		case i%4 == 1:
+			m.Get("b")
+		default:
+			m.Get(fmt.Sprintf("%c", 'c'+i%8/4))
+		}
+	}
+	_, hot := m.hot.load("a")
+	c.Assert(hot, Equals, true)
+	_, hot = m.hot.load("c")
+	c.Assert(hot, Equals, false)
+	c.Assert(len(m.hot.entries.Load().(map[string]*readEntry)), Equals, 2)
+
+	// Hits are served while the map is locked
+	m.mutex.Lock()
+	value, exists := m.Get("a")
+	m.mutex.Unlock()
+	c.Assert(exists, Equals, true)
+	c.Assert(value, Equals, "a")
+
+	// Writes go through to the cache
+	m.Set("a", "A", 10)
+	value, _ = m.Get("a")
+	c.Assert(value, Equals, "A")
+	m.Delete("b")
+	_, exists = m.Get("b")
+	c.Assert(exists, Equals, false)
+	m.Set("b", "B", 1)
+	entry, _ := m.hot.load("b")
+	c.Assert(entry.value, Equals, "B")
+
+	// Expired cached elements are removed by the map
+	s.advanceSeconds(1)
+	_, exists = m.Get("b")
+	c.Assert(exists, Equals, false)
+	c.Assert(m.Len(), Equals, 3)
+}
+
+func (s *TestSuite) TestHotKeyCacheConcurrent(c *C) {
+	m := s.newMap(100, HotKeyCache(4))
+
+	var wg sync.WaitGroup
+	for g := 0; g < 4; g += 1 {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 2000; i += 1 {
+				m.Set(fmt.Sprintf("k%d", i%10), i, 10)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 2000; i += 1 {
+				m.Get(fmt.Sprintf("k%d", i%3))
+			}
+		}()
+	}
+	wg.Wait()
+	c.Assert(m.Len(), Equals, 10)
+}
+
+func benchmarkParallelGetHot(b *testing.B, opts ...TtlMapOption) {
+	m, _ := NewConcurrent(1000, opts...)
+	for i := 0; i < 1000; i += 1 {
+		m.Set(fmt.Sprintf("k%d", i), i, 3600)
+	}
+	keys := []string{"k1", "k2", "k3"}
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			m.Get(keys[i%len(keys)])
+			i += 1
+		}
+	})
+}
+
+func BenchmarkGetHot(b *testing.B) {
+	benchmarkParallelGetHot(b)
+}
+
+func BenchmarkGetHotKeyCache(b *testing.B) {
+	benchmarkParallelGetHot(b, HotKeyCache(8))
+}
@@ -0,0 +1,58 @@
+package ttlmap
+
+// expiryIndex orders elements by expiry time. PeekEl and PopEl return the
+// element that expires first, implementations may trade precision of that
+// order for cheaper updates.
+type expiryIndex interface {
+	Len() int
+	PushEl(el *heapElement)
+	PopEl() *heapElement
+	PeekEl() *heapElement
+	UpdateEl(el *heapElement, priority int64)
+	RemoveEl(el *heapElement)
+	// ForEach calls fn for every element in no particular order, stopping
+	// early if fn returns false
+	ForEach(fn func(el *heapElement) bool)
+	// CountExpired returns the number of elements with priority <= now
+	CountExpired(now int64) int
+}
+
+// heapIndex is the default expiry index backed by a binary min heap
+type heapIndex struct {
+	*minHeap
+}
+
+// newHeapIndex returns an empty heap with room for size elements
+func newHeapIndex(size int) *heapIndex {
+	h := make(minHeap, 0, size)
+	return &heapIndex{&h}
+}
+
+func (h *heapIndex) ForEach(fn func(el *heapElement) bool) {
+	for _, el := range *h.minHeap {
+		if !fn(el) {
+			return
+		}
+	}
+}
+
+// CountExpired walks the heap from the root, descending only into expired
+// elements, so it costs O(expired) rather than O(len)
+func (h *heapIndex) CountExpired(now int64) int {
+	heap := *h.minHeap
+	if len(heap) == 0 {
+		return 0
+	}
+	count := 0
+	stack := []int{0}
+	for len(stack) > 0 {
+		i := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if i >= len(heap) || heap[i].Priority > now {
+			continue
+		}
+		count += 1
+		stack = append(stack, 2*i+1, 2*i+2)
+	}
+	return count
+}
@@ -0,0 +1,172 @@
+package ttlmap
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// KeyCodec maps structured keys to the string keys of a map and back. Encode
+// must return distinct strings for distinct keys and Decode(Encode(key))
+// must equal key.
+type KeyCodec interface {
+	Encode(key interface{}) string
+	Decode(key string) interface{}
+}
+
+// WithKeyCodec sets the codec of the keys passed to SetKey, GetKey,
+// ContainsKey and DeleteKey
+func WithKeyCodec(codec KeyCodec) TtlMapOption {
+	return func(m *TtlMap) error {
+		if codec == nil {
+			return errors.New("Please pass key codec")
+		}
+		m.keyCodec = codec
+		return nil
+	}
+}
+
+// KeyCodec returns the codec set with WithKeyCodec, e.g. to decode the keys
+// passed to callbacks, or nil
+func (m *TtlMap) KeyCodec() KeyCodec {
+	return m.keyCodec
+}
+
+// SetKey is Set with a key encoded by the codec set with WithKeyCodec
+func (m *TtlMap) SetKey(key interface{}, value interface{}, ttlSeconds int) error {
+	if m.keyCodec == nil {
+		return errors.New("Key codec is not configured")
+	}
+	return m.Set(m.keyCodec.Encode(key), value, ttlSeconds)
+}
+
+// GetKey is Get with a key encoded by the codec set with WithKeyCodec, maps
+// without a codec hold no such keys
+func (m *TtlMap) GetKey(key interface{}) (interface{}, bool) {
+	if m.keyCodec == nil {
+		return nil, false
+	}
+	return m.Get(m.keyCodec.Encode(key))
+}
+
+// ContainsKey is Contains with a key encoded by the codec set with
+// WithKeyCodec
+func (m *TtlMap) ContainsKey(key interface{}) bool {
+	if m.keyCodec == nil {
+		return false
+	}
+	return m.Contains(m.keyCodec.Encode(key))
+}
+
+// DeleteKey is Delete with a key encoded by the codec set with WithKeyCodec
+func (m *TtlMap) DeleteKey(key interface{}) bool {
+	if m.keyCodec == nil {
+		return false
+	}
+	return m.Delete(m.keyCodec.Encode(key))
+}
+
+// structKeyCodec encodes the fields of a struct in order, each as the length
+// of its text followed by a colon and the text, so no field value can run
+// into the next one. Encoded keys sort like the structs they encode only for
+// fields of equal length.
+type structKeyCodec struct {
+	t reflect.Type
+}
+
+// NewStructKeyCodec returns a codec for keys of the struct type of
+// prototype, e.g. struct{ TenantID int; Route string }. The fields must be
+// exported and of boolean, integer or string kinds. Encode panics if passed
+// a key of another type, like a type assertion would.
+func NewStructKeyCodec(prototype interface{}) (KeyCodec, error) {
+	t := reflect.TypeOf(prototype)
+	if t == nil || t.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("Expected struct, got %T", prototype)
+	}
+	for i := 0; i < t.NumField(); i += 1 {
+		field := t.Field(i)
+		if field.PkgPath != "" {
+			return nil, fmt.Errorf("Expected exported fields, got %v.%v", t, field.Name)
+		}
+		switch field.Type.Kind() {
+		case reflect.Bool, reflect.String,
+			reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		default:
+			return nil, fmt.Errorf("Expected boolean, integer or string fields, got %v.%v of type %v", t, field.Name, field.Type)
+		}
+	}
+	return &structKeyCodec{t: t}, nil
+}
+
+func (c *structKeyCodec) Encode(key interface{}) string {
+	v := reflect.ValueOf(key)
+	if v.Type() != c.t {
+		panic(fmt.Sprintf("ttlmap: expected key of type %v, got %T", c.t, key))
+	}
+	var b strings.Builder
+	for i := 0; i < v.NumField(); i += 1 {
+		var text string
+		switch field := v.Field(i); field.Kind() {
+		case reflect.Bool:
+			text = strconv.FormatBool(field.Bool())
+		case reflect.String:
+			text = field.String()
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			text = strconv.FormatInt(field.Int(), 10)
+		default:
+			text = strconv.FormatUint(field.Uint(), 10)
+		}
+		b.WriteString(strconv.Itoa(len(text)))
+		b.WriteByte(':')
+		b.WriteString(text)
+	}
+	return b.String()
+}
+
+// Decode returns the struct encoded in key, or nil if key was not encoded by
+// the codec
+func (c *structKeyCodec) Decode(key string) interface{} {
+	v := reflect.New(c.t).Elem()
+	for i := 0; i < v.NumField(); i += 1 {
+		colon := strings.IndexByte(key, ':')
+		if colon < 0 {
+			return nil
+		}
+		n, err := strconv.Atoi(key[:colon])
+		if err != nil || n < 0 || colon+1+n > len(key) {
+			return nil
+		}
+		text := key[colon+1 : colon+1+n]
+		key = key[colon+1+n:]
+
+		switch field := v.Field(i); field.Kind() {
+		case reflect.Bool:
+			b, err := strconv.ParseBool(text)
+			if err != nil {
+				return nil
+			}
+			field.SetBool(b)
+		case reflect.String:
+			field.SetString(text)
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			n, err := strconv.ParseInt(text, 10, field.Type().Bits())
+			if err != nil {
+				return nil
+			}
+			field.SetInt(n)
+		default:
+			n, err := strconv.ParseUint(text, 10, field.Type().Bits())
+			if err != nil {
+				return nil
+			}
+			field.SetUint(n)
+		}
+	}
+	if key != "" {
+		return nil
+	}
+	return v.Interface()
+}
@@ -0,0 +1,70 @@
+package ttlmap
+
+import (
+	. "gopkg.in/check.v1"
+)
+
+type routeKey struct {
+	TenantID int
+	Route    string
+	Internal bool
+}
+
+func (s *TestSuite) TestStructKeyCodec(c *C) {
+	codec, err := NewStructKeyCodec(routeKey{})
+	c.Assert(err, IsNil)
+
+	key := routeKey{TenantID: -12, Route: "/login:2", Internal: true}
+	encoded := codec.Encode(key)
+	c.Assert(encoded, Equals, "3:-128:/login:24:true")
+	c.Assert(codec.Decode(encoded), Equals, key)
+
+	// Fields can not run into each other
+	a := struct{ A, B string }{"a:", "b"}
+	b := struct{ A, B string }{"a", ":b"}
+	pairs, _ := NewStructKeyCodec(a)
+	c.Assert(pairs.Encode(a), Not(Equals), pairs.Encode(b))
+
+	c.Assert(codec.Decode("garbage"), IsNil)
+	c.Assert(codec.Decode(encoded+"1:x"), IsNil)
+	c.Assert(codec.Decode("3:abc8:/login:24:true"), IsNil)
+	c.Assert(func() { codec.Encode("key") }, PanicMatches, "ttlmap: expected key of type ttlmap.routeKey, got string")
+
+	_, err = NewStructKeyCodec("key")
+	c.Assert(err, NotNil)
+	_, err = NewStructKeyCodec(struct{ hidden int }{})
+	c.Assert(err, NotNil)
+	_, err = NewStructKeyCodec(struct{ F float64 }{})
+	c.Assert(err, NotNil)
+}
+
+func (s *TestSuite) TestKeyCodec(c *C) {
+	codec, _ := NewStructKeyCodec(routeKey{})
+	var expired []interface{}
+	m := s.newMap(10, WithKeyCodec(codec), CallOnExpire(func(key string, el interface{}) {
+		expired = append(expired, codec.Decode(key))
+	}))
+	c.Assert(m.KeyCodec(), Equals, codec)
+
+	key := routeKey{TenantID: 1, Route: "/"}
+	c.Assert(m.SetKey(key, 1, 1), IsNil)
+	value, exists := m.GetKey(key)
+	c.Assert(exists, Equals, true)
+	c.Assert(value, Equals, 1)
+	c.Assert(m.ContainsKey(routeKey{TenantID: 2, Route: "/"}), Equals, false)
+
+	s.advanceSeconds(1)
+	m.RemoveExpired(0)
+	c.Assert(expired, DeepEquals, []interface{}{key})
+
+	m.SetKey(key, 2, 10)
+	c.Assert(m.DeleteKey(key), Equals, true)
+	c.Assert(m.ContainsKey(key), Equals, false)
+
+	plain := s.newMap(10)
+	c.Assert(plain.SetKey(key, 1, 10), ErrorMatches, "Key codec is not configured")
+	_, exists = plain.GetKey(key)
+	c.Assert(exists, Equals, false)
+	_, err := NewMap(10, WithKeyCodec(nil))
+	c.Assert(err, NotNil)
+}
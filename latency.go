@@ -0,0 +1,178 @@
+package ttlmap
+
+import (
+	"math/bits"
+	"sync/atomic"
+	"time"
+)
+
+// RecordLatencies makes the map record how long reads, writes and the reaper
+// cycles take into histograms reported by Stats. Get latencies are those of
+// Get and GetByBytes calls, including the time spent waiting for the lock.
+// Set latencies are those of every value written, by Set, SetWithDuration,
+// SetIfAbsent, GetOrSet, Increment, Update, Restore and the other writing
+// methods alike, measured while the lock is held, so they leave out the wait
+// for it. Like HDR histograms the buckets grow with the values, so every
+// latency is known within 12.5%. Recording costs two clock reads and a few
+// atomic additions per operation.
+func RecordLatencies() TtlMapOption {
+	return func(m *TtlMap) error {
+		m.latencies = &latencies{}
+		return nil
+	}
+}
+
+// Latencies are the latency histograms of a map
+type Latencies struct {
+	Get   LatencyHistogram
+	Set   LatencyHistogram
+	Sweep LatencyHistogram
+}
+
+// LatencyHistogram is a copy of a latency distribution
+type LatencyHistogram struct {
+	Count uint64
+	Sum   time.Duration
+	Max   time.Duration
+	// counts holds the number of values in each bucket
+	counts []uint64
+}
+
+// Mean returns the average latency, 0 if nothing was recorded
+func (h LatencyHistogram) Mean() time.Duration {
+	if h.Count == 0 {
+		return 0
+	}
+	return h.Sum / time.Duration(h.Count)
+}
+
+// Quantile returns the latency q (0 to 1) of the values are at or below,
+// e.g. Quantile(0.99) is the 99th percentile. It is rounded up to the upper
+// bound of its bucket, but never beyond Max.
+func (h LatencyHistogram) Quantile(q float64) time.Duration {
+	if h.Count == 0 {
+		return 0
+	}
+	rank := uint64(q*float64(h.Count) + 0.5)
+	if rank < 1 {
+		rank = 1
+	}
+	seen := uint64(0)
+	for i, count := range h.counts {
+		seen += count
+		if seen >= rank {
+			upper := time.Duration(bucketLowerBound(i+1) - 1)
+			if upper > h.Max {
+				return h.Max
+			}
+			return upper
+		}
+	}
+	return h.Max
+}
+
+func (h *LatencyHistogram) merge(other LatencyHistogram) {
+	if h.counts == nil {
+		h.counts = make([]uint64, latencyBuckets)
+	}
+	for i, count := range other.counts {
+		h.counts[i] += count
+	}
+	h.Count += other.Count
+	h.Sum += other.Sum
+	if other.Max > h.Max {
+		h.Max = other.Max
+	}
+}
+
+const (
+	// latencySubBuckets splits every power of two into as many buckets
+	latencySubBits    = 3
+	latencySubBuckets = 1 << latencySubBits
+	latencyBuckets    = (64 - latencySubBits + 1) * latencySubBuckets
+)
+
+// bucketOf returns the bucket of a value in nanoseconds
+func bucketOf(v uint64) int {
+	if v < latencySubBuckets {
+		return int(v)
+	}
+	exp := bits.Len64(v) - 1
+	sub := int(v>>uint(exp-latencySubBits)) & (latencySubBuckets - 1)
+	return (exp-latencySubBits+1)*latencySubBuckets + sub
+}
+
+// bucketLowerBound returns the smallest value of a bucket
+func bucketLowerBound(i int) uint64 {
+	if i < latencySubBuckets {
+		return uint64(i)
+	}
+	exp := i/latencySubBuckets + latencySubBits - 1
+	sub := uint64(i % latencySubBuckets)
+	return (latencySubBuckets + sub) << uint(exp-latencySubBits)
+}
+
+// getStarted returns when a Get call started if its latency is recorded
+func (m *TtlMap) getStarted() time.Time {
+	if m.latencies == nil {
+		return time.Time{}
+	}
+	return time.Now()
+}
+
+// gotten counts the lookup of a Get call started at start and records its
+// latency, Get and GetByBytes share it so they are counted alike
+func (m *TtlMap) gotten(start time.Time, hit bool) {
+	m.lookedUp(hit)
+	if m.latencies != nil {
+		m.latencies.get.record(start)
+	}
+}
+
+type latencies struct {
+	get, set, sweep histogram
+}
+
+// histogram records values atomically, so it takes no lock
+type histogram struct {
+	count  uint64
+	sum    uint64
+	max    uint64
+	counts [latencyBuckets]uint64
+}
+
+func (h *histogram) record(start time.Time) {
+	v := uint64(time.Since(start))
+	atomic.AddUint64(&h.counts[bucketOf(v)], 1)
+	atomic.AddUint64(&h.count, 1)
+	atomic.AddUint64(&h.sum, v)
+	for {
+		max := atomic.LoadUint64(&h.max)
+		if v <= max || atomic.CompareAndSwapUint64(&h.max, max, v) {
+			return
+		}
+	}
+}
+
+// snapshot copies the histogram, values recorded meanwhile may be counted in
+// some fields and not in others
+func (h *histogram) snapshot() LatencyHistogram {
+	s := LatencyHistogram{
+		Count:  atomic.LoadUint64(&h.count),
+		Sum:    time.Duration(atomic.LoadUint64(&h.sum)),
+		Max:    time.Duration(atomic.LoadUint64(&h.max)),
+		counts: make([]uint64, latencyBuckets),
+	}
+	for i := range h.counts {
+		s.counts[i] = atomic.LoadUint64(&h.counts[i])
+	}
+	return s
+}
+
+func (l *latencies) snapshot() *Latencies {
+	return &Latencies{
+		Get:   l.get.snapshot(),
+		Set:   l.set.snapshot(),
+		Sweep: l.sweep.snapshot(),
+	}
+}
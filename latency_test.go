@@ -0,0 +1,88 @@
+package ttlmap
+
+import (
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+func (s *TestSuite) TestRecordLatencies(c *C) {
+	m := s.newMap(10, RecordLatencies())
+	m.Set("a", 1, 10)
+	m.SetWithDuration("b", 2, time.Second)
+	m.Get("a")
+	m.Get("c")
+	m.Get("b")
+	m.GetByBytes([]byte("a"))
+
+	latencies := m.Stats().Latencies
+	c.Assert(latencies, NotNil)
+	c.Assert(latencies.Get.Count, Equals, uint64(4))
+	c.Assert(latencies.Set.Count, Equals, uint64(2))
+	c.Assert(latencies.Sweep.Count, Equals, uint64(0))
+	c.Assert(latencies.Get.Quantile(1), Equals, latencies.Get.Max)
+	c.Assert(latencies.Get.Quantile(0.5) <= latencies.Get.Max, Equals, true)
+	c.Assert(latencies.Get.Mean() <= latencies.Get.Max, Equals, true)
+
+	// Every method writing values counts as a set
+	m.SetIfAbsent("c", 3, 10)
+	m.GetOrSet("d", 4, 10)
+	m.Increment("e", 1, 10)
+	c.Assert(m.Stats().Latencies.Set.Count, Equals, uint64(5))
+
+	plain := s.newMap(10)
+	plain.Get("a")
+	c.Assert(plain.Stats().Latencies, IsNil)
+}
+
+func (s *TestSuite) TestRecordSweepLatencies(c *C) {
+	m, err := NewConcurrent(10, RecordLatencies(), ReapInterval(time.Millisecond))
+	c.Assert(err, IsNil)
+	defer m.Close()
+
+	deadline := time.Now().Add(time.Second)
+	for m.Stats().Latencies.Sweep.Count == 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	c.Assert(m.Stats().Latencies.Sweep.Count > 0, Equals, true)
+}
+
+func (s *TestSuite) TestLatencyQuantiles(c *C) {
+	var h histogram
+	for i := 1; i <= 100; i += 1 {
+		h.counts[bucketOf(uint64(i*1000))] += 1
+		h.count += 1
+		h.sum += uint64(i * 1000)
+		h.max = uint64(i * 1000)
+	}
+	latencies := h.snapshot()
+	c.Assert(latencies.Mean(), Equals, 50500*time.Nanosecond)
+	c.Assert(latencies.Quantile(1), Equals, 100*time.Microsecond)
+	for _, q := range []float64{0.5, 0.9, 0.99} {
+		want := time.Duration(q*100) * time.Microsecond
+		got := latencies.Quantile(q)
+		c.Assert(got >= want && got <= want+want/8, Equals, true, Commentf("q %v got %v", q, got))
+	}
+	c.Assert(LatencyHistogram{}.Quantile(0.5), Equals, time.Duration(0))
+}
+
+func (s *TestSuite) TestLatencyBuckets(c *C) {
+	for _, v := range []uint64{0, 1, 7, 8, 15, 16, 17, 1000, 123456789, 1 << 62, 1<<64 - 1} {
+		i := bucketOf(v)
+		c.Assert(i < latencyBuckets, Equals, true)
+		c.Assert(bucketLowerBound(i) <= v, Equals, true, Commentf("value %v", v))
+		if i+1 < latencyBuckets {
+			c.Assert(bucketLowerBound(i+1) > v, Equals, true, Commentf("value %v", v))
+		}
+	}
+}
+
+func (s *TestSuite) TestShardedLatencies(c *C) {
+	sm := s.newShardedMap(16, Shards(4), RecordLatencies())
+	sm.Set("a", 1, 10)
+	sm.Get("a")
+	sm.Get("b")
+	latencies := sm.Stats().Latencies
+	c.Assert(latencies.Get.Count, Equals, uint64(2))
+	c.Assert(latencies.Set.Count, Equals, uint64(1))
+}
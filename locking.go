@@ -0,0 +1,67 @@
+package ttlmap
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// LockingMode selects the lock guarding a concurrent map
+type LockingMode int
+
+const (
+	// RWMutexLocking lets reads that do not modify the map run in parallel,
+	// it is the default
+	RWMutexLocking LockingMode = iota + 1
+	// MutexLocking serializes all operations on a plain mutex, which is
+	// cheaper to take and release and tends to win for write heavy maps
+	MutexLocking
+)
+
+// WithLocking sets the lock of a map created with NewConcurrent, or of each
+// shard of a map created with NewSharded. For sharded locking create the map
+// with NewSharded.
+func WithLocking(mode LockingMode) TtlMapOption {
+	return func(m *TtlMap) error {
+		if mode < RWMutexLocking || mode > MutexLocking {
+			return fmt.Errorf("Unknown locking mode %d", mode)
+		}
+		m.lockingMode = mode
+		return nil
+	}
+}
+
+// locker is the lock of a concurrent map
+type locker interface {
+	Lock()
+	Unlock()
+	RLock()
+	RUnlock()
+}
+
+// mutexLocker takes the exclusive lock for reads as well
+type mutexLocker struct {
+	sync.Mutex
+}
+
+func (l *mutexLocker) RLock() {
+	l.Lock()
+}
+
+func (l *mutexLocker) RUnlock() {
+	l.Unlock()
+}
+
+// newLocker returns the lock of a concurrent map for the locking mode
+func (m *TtlMap) newLocker(concurrent bool) (locker, error) {
+	if !concurrent {
+		if m.lockingMode != 0 {
+			return nil, errors.New("Locking mode requires a map created with NewConcurrent")
+		}
+		return nil, nil
+	}
+	if m.lockingMode == MutexLocking {
+		return &mutexLocker{}, nil
+	}
+	return new(sync.RWMutex), nil
+}
@@ -0,0 +1,66 @@
+package ttlmap
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	. "gopkg.in/check.v1"
+)
+
+func (s *TestSuite) TestWithLockingValidation(c *C) {
+	_, err := NewConcurrent(1, WithLocking(0))
+	c.Assert(err, Not(Equals), nil)
+
+	_, err = NewMap(1, WithLocking(MutexLocking))
+	c.Assert(err, Not(Equals), nil)
+}
+
+func (s *TestSuite) TestWithLocking(c *C) {
+	m := s.newMap(10)
+	_, ok := m.mutex.(*sync.RWMutex)
+	c.Assert(ok, Equals, true)
+
+	m = s.newMap(10, WithLocking(MutexLocking))
+	_, ok = m.mutex.(*mutexLocker)
+	c.Assert(ok, Equals, true)
+
+	var wg sync.WaitGroup
+	for g := 0; g < 4; g += 1 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 100; i += 1 {
+				m.Increment(fmt.Sprintf("k%d", i%5), 1, 10)
+				m.Get(fmt.Sprintf("k%d", i%5))
+			}
+		}()
+	}
+	wg.Wait()
+	value, _ := m.Get("k0")
+	c.Assert(value, Equals, 80)
+
+	sm := s.newShardedMap(10, Shards(2), WithLocking(MutexLocking))
+	_, ok = sm.shards[0].mutex.(*mutexLocker)
+	c.Assert(ok, Equals, true)
+}
+
+func benchmarkParallelIncrement(b *testing.B, opts ...TtlMapOption) {
+	m, _ := NewConcurrent(1000, opts...)
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			m.Increment(fmt.Sprintf("k%d", i%100), 1, 3600)
+			i += 1
+		}
+	})
+}
+
+func BenchmarkIncrementRWMutex(b *testing.B) {
+	benchmarkParallelIncrement(b)
+}
+
+func BenchmarkIncrementMutex(b *testing.B) {
+	benchmarkParallelIncrement(b, WithLocking(MutexLocking))
+}
@@ -0,0 +1,65 @@
+package ttlmap
+
+import (
+	"errors"
+	"runtime/debug"
+	"time"
+)
+
+// Logger receives the anomalies the map otherwise handles silently
+type Logger interface {
+	Debugf(format string, args ...interface{})
+	Warnf(format string, args ...interface{})
+}
+
+// WithLogger makes the map report internal anomalies to l as warnings:
+// panics of the expiration and removal callbacks, which are then recovered
+// instead of unwinding through the map, inconsistencies of the expiry index,
+// eviction storms, events and evictions dropped because their channel is
+// full, and failed restores. The elements removed by each reaper cycle are
+// reported at the debug level.
+func WithLogger(l Logger) TtlMapOption {
+	return func(m *TtlMap) error {
+		if l == nil {
+			return errors.New("Please pass logger")
+		}
+		m.logger = l
+		return nil
+	}
+}
+
+// recovering wraps a callback so its panics are logged instead of unwinding
+// through the map
+func (m *TtlMap) recovering(fn func()) func() {
+	return func() {
+		defer func() {
+			if r := recover(); r != nil {
+				m.logger.Warnf("ttlmap: callback panicked: %v\n%s", r, debug.Stack())
+			}
+		}()
+		fn()
+	}
+}
+
+// evictedForCapacity watches for eviction storms: as many capacity
+// evictions within a second as the map holds elements, which means the
+// working set does not fit in the map. A storm is reported once per second.
+func (m *TtlMap) evictedForCapacity() {
+	now := m.now()
+	if now-m.stormStart >= int64(time.Second) {
+		m.stormStart = now
+		m.stormEvictions = 0
+	}
+	m.stormEvictions += 1
+	if m.stormEvictions == m.capacity {
+		m.logger.Warnf("ttlmap: eviction storm, %d elements evicted for capacity within a second", m.stormEvictions)
+	}
+}
+
+// warnDropped reports the first dropped event or eviction and then every
+// power of two of them, so a stalled reader does not flood the log
+func (m *TtlMap) warnDropped(channel string, dropped int) {
+	if m.logger != nil && dropped&(dropped-1) == 0 {
+		m.logger.Warnf("ttlmap: %s is full, %d dropped so far", channel, dropped)
+	}
+}
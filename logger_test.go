@@ -0,0 +1,152 @@
+package ttlmap
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+// testLogger records the messages logged
+type testLogger struct {
+	mutex sync.Mutex
+	debug []string
+	warn  []string
+}
+
+func (l *testLogger) Debugf(format string, args ...interface{}) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.debug = append(l.debug, fmt.Sprintf(format, args...))
+}
+
+func (l *testLogger) Warnf(format string, args ...interface{}) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.warn = append(l.warn, fmt.Sprintf(format, args...))
+}
+
+func (s *TestSuite) TestLoggerValidation(c *C) {
+	_, err := NewMap(10, WithLogger(nil))
+	c.Assert(err, NotNil)
+}
+
+func (s *TestSuite) TestLoggerCallbackPanics(c *C) {
+	logger := &testLogger{}
+	m := s.newMap(10, WithLogger(logger), CallOnExpire(func(key string, el interface{}) {
+		panic("expire " + key)
+	}))
+	m.Set("a", 1, 1)
+	m.Set("b", 2, 1)
+	s.advanceSeconds(2)
+
+	c.Assert(m.RemoveExpired(0), HasLen, 2)
+	c.Assert(logger.warn, HasLen, 2)
+	c.Assert(strings.HasPrefix(logger.warn[0], "ttlmap: callback panicked: expire a\n"), Equals, true)
+	c.Assert(strings.HasPrefix(logger.warn[1], "ttlmap: callback panicked: expire b\n"), Equals, true)
+
+	// Without a logger the panic unwinds as before
+	plain := s.newMap(10, CallOnExpire(func(key string, el interface{}) {
+		panic("expire " + key)
+	}))
+	plain.Set("a", 1, 1)
+	s.advanceSeconds(2)
+	c.Assert(func() { plain.RemoveExpired(0) }, PanicMatches, "expire a")
+}
+
+func (s *TestSuite) TestLoggerEvictionStorm(c *C) {
+	logger := &testLogger{}
+	m := s.newMap(2, WithLogger(logger))
+	for i := 0; i < 6; i += 1 {
+		m.Set(fmt.Sprint(i), i, 10)
+	}
+	c.Assert(logger.warn, DeepEquals, []string{"ttlmap: eviction storm, 2 elements evicted for capacity within a second"})
+
+	// Evictions spread over seconds are no storm
+	logger.warn = nil
+	s.advanceSeconds(1)
+	m.Set("a", 1, 10)
+	s.advanceSeconds(1)
+	m.Set("b", 1, 10)
+	c.Assert(logger.warn, HasLen, 0)
+}
+
+func (s *TestSuite) TestLoggerDroppedEvictions(c *C) {
+	logger := &testLogger{}
+	m := s.newMap(1, WithLogger(logger), EvictionChannel(1))
+	for i := 0; i < 6; i += 1 {
+		m.Set(fmt.Sprint(i), i, 10)
+	}
+	c.Assert(m.DroppedEvictions(), Equals, 4)
+	c.Assert(logger.warn, DeepEquals, []string{
+		"ttlmap: eviction storm, 1 elements evicted for capacity within a second",
+		"ttlmap: EvictionChannel is full, 1 dropped so far",
+		"ttlmap: EvictionChannel is full, 2 dropped so far",
+		"ttlmap: EvictionChannel is full, 4 dropped so far",
+	})
+}
+
+func (s *TestSuite) TestLoggerInconsistencies(c *C) {
+	logger := &testLogger{}
+	m := s.newMap(10, WithLogger(logger))
+	m.Set("a", 1, 1)
+	m.Set("b", 2, 10)
+
+	// Replace the element behind the back of the index
+	stale := m.elements["a"]
+	replacement := *stale
+	m.elements["a"] = &replacement
+
+	var buf bytes.Buffer
+	c.Assert(m.Dump(&buf), IsNil)
+	c.Assert(len(logger.warn) > 0, Equals, true)
+	c.Assert(strings.HasPrefix(logger.warn[0], "ttlmap: inconsistency, "), Equals, true)
+
+	logger.warn = nil
+	s.advanceSeconds(2)
+	c.Assert(m.RemoveExpired(0), HasLen, 0)
+	c.Assert(logger.warn, DeepEquals, []string{`ttlmap: expiry index holds "a", which is not in the map`})
+	c.Assert(m.elements["a"], Equals, &replacement)
+}
+
+func (s *TestSuite) TestLoggerRestoreFailure(c *C) {
+	src := s.newMap(10)
+	src.Set("a", 1, 10)
+	src.Set("b", 2, 10)
+
+	logger := &testLogger{}
+	m := s.newMap(10, WithLogger(logger), WithSizer(func(key string, value interface{}) int64 {
+		return int64(value.(int)) * 10
+	}), MaxCost(15))
+	c.Assert(m.Restore(src.Snapshot()), NotNil)
+	c.Assert(logger.warn, HasLen, 1)
+	c.Assert(strings.HasPrefix(logger.warn[0], `ttlmap: failed to restore "b" from snapshot: `), Equals, true)
+}
+
+func (s *TestSuite) TestLoggerReaper(c *C) {
+	logger := &testLogger{}
+	m := s.newMap(10, WithLogger(logger))
+	defer m.Close()
+	m.Set("a", 1, 1)
+	s.advanceSeconds(2)
+	c.Assert(m.StartReaper(time.Millisecond), IsNil)
+
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		logger.mutex.Lock()
+		logged := len(logger.debug)
+		logger.mutex.Unlock()
+		if logged > 0 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	logger.mutex.Lock()
+	defer logger.mutex.Unlock()
+	c.Assert(logger.debug, HasLen, 1)
+	c.Assert(strings.HasPrefix(logger.debug[0], "ttlmap: reaper removed 1 expired elements in "), Equals, true)
+	c.Assert(logger.warn, HasLen, 0)
+}
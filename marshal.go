@@ -0,0 +1,180 @@
+package ttlmap
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/gob"
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+)
+
+// valueTypes are the value types registered with RegisterValue
+var valueTypes = struct {
+	sync.RWMutex
+	byName map[string]reflect.Type
+	byType map[reflect.Type]string
+}{
+	byName: make(map[string]reflect.Type),
+	byType: make(map[reflect.Type]string),
+}
+
+// RegisterValue registers the type of value under name, so snapshots
+// serialize values of that type with its MarshalBinary method and restore
+// them with UnmarshalBinary, which must be implemented by the type or by a
+// pointer to it. The name is stored along with the data and must not change
+// while serialized snapshots are around. Values of types that are not
+// registered, BinaryMarshalers included, are serialized with gob, which
+// requires registering them with gob.Register. Like gob.Register, it panics if the name or the type is
+// registered twice, it is meant to be called from init functions.
+func RegisterValue(name string, value encoding.BinaryMarshaler) {
+	t := reflect.TypeOf(value)
+	target := t
+	if t.Kind() != reflect.Ptr {
+		target = reflect.PtrTo(t)
+	}
+	if !target.Implements(reflect.TypeOf((*encoding.BinaryUnmarshaler)(nil)).Elem()) {
+		panic(fmt.Sprintf("ttlmap: %v does not implement encoding.BinaryUnmarshaler", target))
+	}
+
+	valueTypes.Lock()
+	defer valueTypes.Unlock()
+	if _, ok := valueTypes.byName[name]; ok {
+		panic(fmt.Sprintf("ttlmap: value name %q is registered twice", name))
+	}
+	if _, ok := valueTypes.byType[t]; ok {
+		panic(fmt.Sprintf("ttlmap: value type %v is registered twice", t))
+	}
+	valueTypes.byName[name] = t
+	valueTypes.byType[t] = name
+}
+
+// snapshotRecord is the gob encoded form of a snapshot
+type snapshotRecord struct {
+	TakenAt time.Time
+	Entries []entryRecord
+}
+
+// entryRecord holds the value either as Data marshaled by the type
+// registered under Type or as Value encoded by gob
+type entryRecord struct {
+	Key       string
+	ExpiresAt time.Time
+	Type      string
+	Data      []byte
+	Value     interface{}
+}
+
+// MarshalBinary serializes the snapshot, e.g. to persist a map or to
+// replicate it to another process
+func (s *Snapshot) MarshalBinary() ([]byte, error) {
+	record := snapshotRecord{TakenAt: s.TakenAt}
+	for _, key := range s.Keys() {
+		entry := s.entries[key]
+		r, err := encodeValue(entry.value)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to marshal value of %q: %v", key, err)
+		}
+		r.Key = key
+		r.ExpiresAt = entry.expiresAt
+		record.Entries = append(record.Entries, r)
+	}
+
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(&record); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// UnmarshalBinary restores a snapshot serialized with MarshalBinary
+func (s *Snapshot) UnmarshalBinary(data []byte) error {
+	var record snapshotRecord
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&record); err != nil {
+		return err
+	}
+
+	entries := make(map[string]snapshotEntry, len(record.Entries))
+	for _, r := range record.Entries {
+		value, err := decodeValue(r)
+		if err != nil {
+			return fmt.Errorf("Failed to unmarshal value of %q: %v", r.Key, err)
+		}
+		entries[r.Key] = snapshotEntry{value: value, expiresAt: r.ExpiresAt}
+	}
+	s.TakenAt = record.TakenAt
+	s.entries = entries
+	return nil
+}
+
+func encodeValue(value interface{}) (entryRecord, error) {
+	marshaler, ok := value.(encoding.BinaryMarshaler)
+	if !ok {
+		return entryRecord{Value: value}, nil
+	}
+
+	valueTypes.RLock()
+	name, registered := valueTypes.byType[reflect.TypeOf(value)]
+	valueTypes.RUnlock()
+	// Marshalers that are not registered, e.g. time.Time, are left to gob
+	if !registered {
+		return entryRecord{Value: value}, nil
+	}
+	data, err := marshaler.MarshalBinary()
+	if err != nil {
+		return entryRecord{}, err
+	}
+	return entryRecord{Type: name, Data: data}, nil
+}
+
+func decodeValue(r entryRecord) (interface{}, error) {
+	if r.Type == "" {
+		return r.Value, nil
+	}
+
+	valueTypes.RLock()
+	t, registered := valueTypes.byName[r.Type]
+	valueTypes.RUnlock()
+	if !registered {
+		return nil, fmt.Errorf("Value name %q is not registered", r.Type)
+	}
+	if t.Kind() == reflect.Ptr {
+		value := reflect.New(t.Elem())
+		err := value.Interface().(encoding.BinaryUnmarshaler).UnmarshalBinary(r.Data)
+		return value.Interface(), err
+	}
+	value := reflect.New(t)
+	err := value.Interface().(encoding.BinaryUnmarshaler).UnmarshalBinary(r.Data)
+	return value.Elem().Interface(), err
+}
+
+// Restore sets the elements of the snapshot that have not expired yet by the
+// clock of the map, keeping their expiry times as they are: TTLJitter,
+// MinTTL, MaxTTL and ExpiryGranularity only apply to new ttls. Elements with
+// the same keys are replaced, the others are kept.
+func (m *TtlMap) Restore(snapshot *Snapshot) error {
+	if m.mutex != nil {
+		m.mutex.Lock()
+		defer m.mutex.Unlock()
+	}
+
+	now := m.now()
+	for _, key := range snapshot.Keys() {
+		entry := snapshot.entries[key]
+		expiryTime := neverExpires
+		if !entry.expiresAt.IsZero() {
+			expiryTime = m.sinceBase(entry.expiresAt)
+			if expiryTime <= now {
+				continue
+			}
+		}
+		if err := m.set(key, entry.value, expiryTime); err != nil {
+			if m.logger != nil {
+				m.logger.Warnf("ttlmap: failed to restore %q from snapshot: %v", key, err)
+			}
+			return err
+		}
+	}
+	return nil
+}
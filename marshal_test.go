@@ -0,0 +1,131 @@
+package ttlmap
+
+import (
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+// point is marshaled by value, session through a pointer
+type point struct {
+	x, y int32
+}
+
+func (p point) MarshalBinary() ([]byte, error) {
+	data := make([]byte, 8)
+	binary.BigEndian.PutUint32(data, uint32(p.x))
+	binary.BigEndian.PutUint32(data[4:], uint32(p.y))
+	return data, nil
+}
+
+func (p *point) UnmarshalBinary(data []byte) error {
+	if len(data) != 8 {
+		return errors.New("Expected 8 bytes")
+	}
+	p.x = int32(binary.BigEndian.Uint32(data))
+	p.y = int32(binary.BigEndian.Uint32(data[4:]))
+	return nil
+}
+
+type session struct {
+	user string
+}
+
+func (s *session) MarshalBinary() ([]byte, error) {
+	return []byte(s.user), nil
+}
+
+func (s *session) UnmarshalBinary(data []byte) error {
+	s.user = string(data)
+	return nil
+}
+
+type unregistered struct{}
+
+func (unregistered) MarshalBinary() ([]byte, error) {
+	return nil, nil
+}
+
+func init() {
+	RegisterValue("point", point{})
+	RegisterValue("session", &session{})
+	gob.Register(time.Time{})
+}
+
+func (s *TestSuite) TestMarshalSnapshot(c *C) {
+	m := s.newMap(10)
+	m.Set("point", point{1, -2}, 10)
+	m.Set("session", &session{user: "alice"}, 20)
+	m.Set("string", "value", NoExpiration)
+	m.Set("expired", "value", 1)
+	s.advanceSeconds(1)
+
+	data, err := m.Snapshot().MarshalBinary()
+	c.Assert(err, IsNil)
+
+	var snapshot Snapshot
+	c.Assert(snapshot.UnmarshalBinary(data), IsNil)
+	c.Assert(snapshot.TakenAt, Equals, s.timeProvider.CurrentTime)
+	c.Assert(snapshot.Keys(), DeepEquals, []string{"point", "session", "string"})
+	value, expiresAt, _ := snapshot.Get("point")
+	c.Assert(value, Equals, point{1, -2})
+	c.Assert(expiresAt, Equals, s.timeProvider.CurrentTime.Add(9*time.Second))
+	value, _, _ = snapshot.Get("session")
+	c.Assert(value, DeepEquals, &session{user: "alice"})
+	value, expiresAt, _ = snapshot.Get("string")
+	c.Assert(value, Equals, "value")
+	c.Assert(expiresAt.IsZero(), Equals, true)
+
+	// Restore keeps the expiry times and skips the elements expired since
+	s.advanceSeconds(10)
+	restored := s.newMap(10)
+	c.Assert(restored.Restore(&snapshot), IsNil)
+	c.Assert(restored.Keys(), HasLen, 2)
+	value, ttl, _ := restored.GetWithTTL("session")
+	c.Assert(value, DeepEquals, &session{user: "alice"})
+	c.Assert(ttl, Equals, 9*time.Second)
+	_, ttl, _ = restored.GetWithTTL("string")
+	c.Assert(ttl, Equals, time.Duration(0))
+
+}
+
+func (s *TestSuite) TestMarshalUnregisteredMarshaler(c *C) {
+	// time.Time is a BinaryMarshaler that is only registered with gob
+	at := time.Date(2016, 8, 1, 12, 30, 0, 0, time.UTC)
+	m := s.newMap(10)
+	m.Set("time", at, 10)
+
+	data, err := m.Snapshot().MarshalBinary()
+	c.Assert(err, IsNil)
+	var snapshot Snapshot
+	c.Assert(snapshot.UnmarshalBinary(data), IsNil)
+	value, _, _ := snapshot.Get("time")
+	c.Assert(value, FitsTypeOf, at)
+	c.Assert(value.(time.Time).Equal(at), Equals, true)
+}
+
+func (s *TestSuite) TestRestoreKeepsExpiryTimes(c *C) {
+	m := s.newMap(10)
+	m.Set("a", 1, 10)
+	m.Set("b", 2, 100)
+	m.Set("c", 3, NoExpiration)
+	snapshot := m.Snapshot()
+
+	// The ttls of the restoring map do not apply to restored elements
+	restored := s.newMap(10, TTLJitter(0.5), MinTTL(20*time.Second), MaxTTL(time.Minute))
+	c.Assert(restored.Restore(snapshot), IsNil)
+	for _, key := range []string{"a", "b", "c"} {
+		_, want, _ := snapshot.Get(key)
+		expiresAt, _ := restored.ExpiresAt(key)
+		c.Assert(expiresAt, Equals, want)
+	}
+}
+
+func (s *TestSuite) TestRegisterValue(c *C) {
+	c.Assert(func() { RegisterValue("point", &session{}) }, PanicMatches, `ttlmap: value name "point" is registered twice`)
+	c.Assert(func() { RegisterValue("other", point{}) }, PanicMatches, `ttlmap: value type ttlmap.point is registered twice`)
+	c.Assert(func() { RegisterValue("unregistered", unregistered{}) }, PanicMatches, `.*does not implement encoding.BinaryUnmarshaler`)
+}
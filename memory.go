@@ -0,0 +1,106 @@
+package ttlmap
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// elementOverhead approximates the memory the map spends on bookkeeping per
+// element: the map entry, the element struct and its heap and list entries
+const elementOverhead = 200
+
+// SizeHook estimates the size in bytes of values of custom types, it returns
+// false to fall back to the built in estimation
+type SizeHook func(value interface{}) (int64, bool)
+
+// MemoryBudget limits the approximate memory footprint of the elements to
+// the given number of bytes, evicting elements to stay under it. The size of
+// an element is estimated from its key and value by walking the value with
+// reflection: strings, slices, maps, pointers and structs of them are
+// followed, channels and functions count as pointers. The estimate is rough
+// and should be calibrated against real heap profiles. It replaces the
+// Sizer, MaxCost is set to the budget.
+func MemoryBudget(bytes int64, hook SizeHook) TtlMapOption {
+	return func(m *TtlMap) error {
+		if bytes <= 0 {
+			return fmt.Errorf("Memory budget should be > 0, got %d", bytes)
+		}
+		m.maxCost = bytes
+		m.sizer = func(key string, value interface{}) int64 {
+			return elementOverhead + int64(len(key)) + estimateSize(value, hook)
+		}
+		return nil
+	}
+}
+
+// estimateSize approximates the bytes referenced by value, including the
+// interface value itself
+func estimateSize(value interface{}, hook SizeHook) int64 {
+	if value == nil {
+		return 0
+	}
+	if hook != nil {
+		if size, ok := hook(value); ok {
+			return size
+		}
+	}
+	v := reflect.ValueOf(value)
+	return int64(v.Type().Size()) + indirectSize(v, make(map[uintptr]bool))
+}
+
+// indirectSize returns the bytes v references outside of its own inline
+// size, seen guards against counting shared or cyclic data twice
+func indirectSize(v reflect.Value, seen map[uintptr]bool) int64 {
+	switch v.Kind() {
+	case reflect.String:
+		return int64(v.Len())
+	case reflect.Ptr:
+		if v.IsNil() || seen[v.Pointer()] {
+			return 0
+		}
+		seen[v.Pointer()] = true
+		elem := v.Elem()
+		return int64(elem.Type().Size()) + indirectSize(elem, seen)
+	case reflect.Interface:
+		if v.IsNil() {
+			return 0
+		}
+		elem := v.Elem()
+		return int64(elem.Type().Size()) + indirectSize(elem, seen)
+	case reflect.Slice:
+		if v.IsNil() || seen[v.Pointer()] {
+			return 0
+		}
+		seen[v.Pointer()] = true
+		size := int64(v.Cap()) * int64(v.Type().Elem().Size())
+		for i := 0; i < v.Len(); i += 1 {
+			size += indirectSize(v.Index(i), seen)
+		}
+		return size
+	case reflect.Array:
+		var size int64
+		for i := 0; i < v.Len(); i += 1 {
+			size += indirectSize(v.Index(i), seen)
+		}
+		return size
+	case reflect.Map:
+		if v.IsNil() || seen[v.Pointer()] {
+			return 0
+		}
+		seen[v.Pointer()] = true
+		entrySize := int64(v.Type().Key().Size() + v.Type().Elem().Size())
+		size := int64(48)
+		iter := v.MapRange()
+		for iter.Next() {
+			size += entrySize + indirectSize(iter.Key(), seen) + indirectSize(iter.Value(), seen)
+		}
+		return size
+	case reflect.Struct:
+		var size int64
+		for i := 0; i < v.NumField(); i += 1 {
+			size += indirectSize(v.Field(i), seen)
+		}
+		return size
+	}
+	return 0
+}
@@ -0,0 +1,58 @@
+package ttlmap
+
+import (
+	"unsafe"
+
+	. "gopkg.in/check.v1"
+)
+
+type sizedValue struct {
+	name string
+	data []byte
+	next *sizedValue
+}
+
+type opaqueValue struct{}
+
+func (s *TestSuite) TestEstimateSize(c *C) {
+	// Headers are measured in words, 8 bytes on 64 bit platforms
+	word := int64(unsafe.Sizeof(uintptr(0)))
+	c.Assert(estimateSize(nil, nil), Equals, int64(0))
+	c.Assert(estimateSize(1, nil), Equals, word)
+	c.Assert(estimateSize("abc", nil), Equals, 2*word+3)
+	c.Assert(estimateSize(make([]byte, 10, 100), nil), Equals, 3*word+100)
+	c.Assert(estimateSize([]string{"ab", "c"}, nil), Equals, 3*word+2*2*word+3)
+	c.Assert(estimateSize(map[string]int{"ab": 1}, nil), Equals, word+48+2*word+word+2)
+
+	// Cycles are followed once
+	v := &sizedValue{name: "ab", data: make([]byte, 4)}
+	v.next = v
+	c.Assert(estimateSize(v, nil), Equals, word+2*word+3*word+word+2+4)
+
+	hook := func(value interface{}) (int64, bool) {
+		if _, ok := value.(opaqueValue); ok {
+			return 1000, true
+		}
+		return 0, false
+	}
+	c.Assert(estimateSize(opaqueValue{}, hook), Equals, int64(1000))
+	c.Assert(estimateSize("abc", hook), Equals, 2*word+3)
+}
+
+func (s *TestSuite) TestMemoryBudget(c *C) {
+	_, err := NewMap(1, MemoryBudget(0, nil))
+	c.Assert(err, Not(Equals), nil)
+
+	m := s.newMap(100, MemoryBudget(3*1024, nil))
+
+	c.Assert(m.Set("big", make([]byte, 4*1024), 10), Not(Equals), nil)
+
+	m.Set("a", make([]byte, 1024), 1)
+	m.Set("b", make([]byte, 1024), 2)
+	c.Assert(m.Cost(), Equals, int64(2*(elementOverhead+1+3*unsafe.Sizeof(uintptr(0))+1024)))
+
+	m.Set("c", make([]byte, 1024), 3)
+	c.Assert(m.Contains("a"), Equals, false)
+	c.Assert(m.Len(), Equals, 2)
+	c.Assert(m.Cost() <= 3*1024, Equals, true)
+}
@@ -0,0 +1,324 @@
+package ttlmap
+
+import (
+	"sort"
+	"time"
+)
+
+// OrderedKeys keeps the keys in a B-tree next to the hash map, so
+// KeysInRange, RangeOrdered and RangePrefix walk only the keys in the range
+// instead of sorting all of them. Every insertion and removal of a key
+// updates the tree in O(log n).
+func OrderedKeys() TtlMapOption {
+	return func(m *TtlMap) error {
+		m.ordered = &keyTree{}
+		return nil
+	}
+}
+
+// KeysInRange returns the keys of the live elements that are >= from and
+// < to in ascending order, an empty to means there is no upper bound
+func (m *TtlMap) KeysInRange(from, to string) []string {
+	var keys []string
+	m.RangeOrdered(from, to, func(key string, value interface{}, expiresAt time.Time) bool {
+		keys = append(keys, key)
+		return true
+	})
+	return keys
+}
+
+// RangeOrdered calls fn for the live elements with keys >= from and < to in
+// ascending key order, stopping early if fn returns false. An empty to means
+// there is no upper bound. Like Range, fn is called with the map locked and
+// must not access the map. Maps created without OrderedKeys sort the keys of
+// all elements on every call.
+func (m *TtlMap) RangeOrdered(from, to string, fn func(key string, value interface{}, expiresAt time.Time) bool) {
+	if m.mutex != nil {
+		m.mutex.RLock()
+		defer m.mutex.RUnlock()
+	}
+
+	now := m.now()
+	visit := func(key string) bool {
+		mapEl := m.elements[key]
+		if mapEl.heapEl.Priority <= now {
+			return true
+		}
+		return fn(key, mapEl.value, m.fromExpiryTime(mapEl.heapEl.Priority))
+	}
+
+	if m.ordered != nil {
+		m.ordered.ascend(from, to, visit)
+		return
+	}
+	var keys []string
+	for key := range m.elements {
+		if key >= from && (to == "" || key < to) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if !visit(key) {
+			return
+		}
+	}
+}
+
+// RangePrefix calls fn for the live elements with keys starting with prefix
+// in ascending key order, see RangeOrdered
+func (m *TtlMap) RangePrefix(prefix string, fn func(key string, value interface{}, expiresAt time.Time) bool) {
+	m.RangeOrdered(prefix, prefixEnd(prefix), fn)
+}
+
+// prefixEnd returns the smallest string greater than all strings starting
+// with prefix, or "" if there is none
+func prefixEnd(prefix string) string {
+	end := []byte(prefix)
+	for i := len(end) - 1; i >= 0; i -= 1 {
+		if end[i] < 0xff {
+			end[i] += 1
+			return string(end[:i+1])
+		}
+	}
+	return ""
+}
+
+// minDegree is the minimum number of children of the inner nodes of the key
+// tree but the root, nodes hold up to 2*minDegree-1 keys
+const minDegree = 32
+
+// keyTree is a B-tree of distinct keys
+type keyTree struct {
+	root *keyNode
+	size int
+}
+
+// keyNode holds sorted keys, inner nodes have one child more than keys,
+// leaves have none
+type keyNode struct {
+	keys     []string
+	children []*keyNode
+}
+
+func (t *keyTree) insert(key string) {
+	if t.root == nil {
+		t.root = &keyNode{}
+	}
+	if len(t.root.keys) == 2*minDegree-1 {
+		t.root = &keyNode{children: []*keyNode{t.root}}
+		t.root.split(0)
+	}
+	if t.root.insert(key) {
+		t.size += 1
+	}
+}
+
+func (t *keyTree) remove(key string) {
+	if t.root == nil {
+		return
+	}
+	if t.root.remove(key) {
+		t.size -= 1
+	}
+	if len(t.root.keys) == 0 {
+		if t.root.children != nil {
+			t.root = t.root.children[0]
+		} else {
+			t.root = nil
+		}
+	}
+}
+
+// ascend calls fn for the keys >= from and < to in ascending order until fn
+// returns false, an empty to means there is no upper bound
+func (t *keyTree) ascend(from, to string, fn func(key string) bool) {
+	if t.root != nil {
+		t.root.ascend(from, to, fn)
+	}
+}
+
+// find returns the position of the first key >= key and whether it is key
+func (n *keyNode) find(key string) (int, bool) {
+	i := sort.SearchStrings(n.keys, key)
+	return i, i < len(n.keys) && n.keys[i] == key
+}
+
+func (n *keyNode) leaf() bool {
+	return n.children == nil
+}
+
+// split moves the upper half of the full child i to a new sibling and its
+// median key up to n
+func (n *keyNode) split(i int) {
+	child := n.children[i]
+	median := child.keys[minDegree-1]
+	sibling := &keyNode{keys: append([]string(nil), child.keys[minDegree:]...)}
+	for j := minDegree - 1; j < len(child.keys); j += 1 {
+		child.keys[j] = ""
+	}
+	child.keys = child.keys[:minDegree-1]
+	if !child.leaf() {
+		sibling.children = append([]*keyNode(nil), child.children[minDegree:]...)
+		for j := minDegree; j < len(child.children); j += 1 {
+			child.children[j] = nil
+		}
+		child.children = child.children[:minDegree]
+	}
+	n.keys = insertKey(n.keys, i, median)
+	n.children = insertChild(n.children, i+1, sibling)
+}
+
+// insert adds key to the subtree of n, which is not full, and returns false
+// if it is already there
+func (n *keyNode) insert(key string) bool {
+	i, found := n.find(key)
+	if found {
+		return false
+	}
+	if n.leaf() {
+		n.keys = insertKey(n.keys, i, key)
+		return true
+	}
+	if len(n.children[i].keys) == 2*minDegree-1 {
+		n.split(i)
+		switch {
+		case key == n.keys[i]:
+			return false
+		case key > n.keys[i]:
+			i += 1
+		}
+	}
+	return n.children[i].insert(key)
+}
+
+// remove drops key from the subtree of n, which has at least minDegree keys
+// unless it is the root, and returns false if it is not there
+func (n *keyNode) remove(key string) bool {
+	i, found := n.find(key)
+	if n.leaf() {
+		if !found {
+			return false
+		}
+		n.keys = removeKey(n.keys, i)
+		return true
+	}
+	if found {
+		switch {
+		case len(n.children[i].keys) >= minDegree:
+			n.keys[i] = n.children[i].max()
+			return n.children[i].remove(n.keys[i])
+		case len(n.children[i+1].keys) >= minDegree:
+			n.keys[i] = n.children[i+1].min()
+			return n.children[i+1].remove(n.keys[i])
+		}
+		n.merge(i)
+		return n.children[i].remove(key)
+	}
+	if len(n.children[i].keys) < minDegree {
+		switch {
+		case i > 0 && len(n.children[i-1].keys) >= minDegree:
+			n.rotateRight(i - 1)
+		case i < len(n.keys) && len(n.children[i+1].keys) >= minDegree:
+			n.rotateLeft(i)
+		case i < len(n.keys):
+			n.merge(i)
+		default:
+			n.merge(i - 1)
+			i -= 1
+		}
+	}
+	return n.children[i].remove(key)
+}
+
+func (n *keyNode) min() string {
+	for !n.leaf() {
+		n = n.children[0]
+	}
+	return n.keys[0]
+}
+
+func (n *keyNode) max() string {
+	for !n.leaf() {
+		n = n.children[len(n.children)-1]
+	}
+	return n.keys[len(n.keys)-1]
+}
+
+// merge joins child i, key i and child i+1 into child i
+func (n *keyNode) merge(i int) {
+	left, right := n.children[i], n.children[i+1]
+	left.keys = append(append(left.keys, n.keys[i]), right.keys...)
+	left.children = append(left.children, right.children...)
+	n.keys = removeKey(n.keys, i)
+	n.children = removeChild(n.children, i+1)
+}
+
+// rotateRight moves key i down to child i+1 and the last key of child i up
+func (n *keyNode) rotateRight(i int) {
+	left, right := n.children[i], n.children[i+1]
+	right.keys = insertKey(right.keys, 0, n.keys[i])
+	n.keys[i] = left.keys[len(left.keys)-1]
+	left.keys = removeKey(left.keys, len(left.keys)-1)
+	if !left.leaf() {
+		right.children = insertChild(right.children, 0, left.children[len(left.children)-1])
+		left.children = removeChild(left.children, len(left.children)-1)
+	}
+}
+
+// rotateLeft moves key i down to child i and the first key of child i+1 up
+func (n *keyNode) rotateLeft(i int) {
+	left, right := n.children[i], n.children[i+1]
+	left.keys = append(left.keys, n.keys[i])
+	n.keys[i] = right.keys[0]
+	right.keys = removeKey(right.keys, 0)
+	if !right.leaf() {
+		left.children = append(left.children, right.children[0])
+		right.children = removeChild(right.children, 0)
+	}
+}
+
+func (n *keyNode) ascend(from, to string, fn func(key string) bool) bool {
+	i, _ := n.find(from)
+	for ; i < len(n.keys); i += 1 {
+		if !n.leaf() && !n.children[i].ascend(from, to, fn) {
+			return false
+		}
+		if to != "" && n.keys[i] >= to {
+			return false
+		}
+		if !fn(n.keys[i]) {
+			return false
+		}
+	}
+	if !n.leaf() {
+		return n.children[i].ascend(from, to, fn)
+	}
+	return true
+}
+
+func insertKey(keys []string, i int, key string) []string {
+	keys = append(keys, "")
+	copy(keys[i+1:], keys[i:])
+	keys[i] = key
+	return keys
+}
+
+func removeKey(keys []string, i int) []string {
+	copy(keys[i:], keys[i+1:])
+	keys[len(keys)-1] = ""
+	return keys[:len(keys)-1]
+}
+
+func insertChild(children []*keyNode, i int, child *keyNode) []*keyNode {
+	children = append(children, nil)
+	copy(children[i+1:], children[i:])
+	children[i] = child
+	return children
+}
+
+func removeChild(children []*keyNode, i int) []*keyNode {
+	copy(children[i:], children[i+1:])
+	children[len(children)-1] = nil
+	return children[:len(children)-1]
+}
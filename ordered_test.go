@@ -0,0 +1,147 @@
+package ttlmap
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"testing"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+func (s *TestSuite) TestOrderedKeys(c *C) {
+	for _, opts := range [][]TtlMapOption{{OrderedKeys()}, nil} {
+		m := s.newMap(100, opts...)
+		for _, minute := range []string{"10:07", "10:05", "10:06", "11:00", "09:59"} {
+			m.Set("counter:"+minute, minute, 10)
+		}
+		m.Set("counter:10:08", "10:08", 1)
+		m.Set("gauge:10:05", "gauge", 10)
+
+		c.Assert(m.KeysInRange("counter:10:05", "counter:10:07"), DeepEquals,
+			[]string{"counter:10:05", "counter:10:06"})
+		c.Assert(m.KeysInRange("counter:10:", ""), DeepEquals,
+			[]string{"counter:10:05", "counter:10:06", "counter:10:07", "counter:10:08", "counter:11:00", "gauge:10:05"})
+
+		// Expired elements are skipped
+		s.advanceSeconds(1)
+		var values []interface{}
+		m.RangePrefix("counter:10:", func(key string, value interface{}, expiresAt time.Time) bool {
+			values = append(values, value)
+			return true
+		})
+		c.Assert(values, DeepEquals, []interface{}{"10:05", "10:06", "10:07"})
+
+		// Iteration stops early
+		var keys []string
+		m.RangeOrdered("", "", func(key string, value interface{}, expiresAt time.Time) bool {
+			keys = append(keys, key)
+			return len(keys) < 2
+		})
+		c.Assert(keys, DeepEquals, []string{"counter:09:59", "counter:10:05"})
+
+		m.Delete("counter:10:05")
+		m.Rename("counter:10:06", "counter:12:00")
+		c.Assert(m.KeysInRange("counter:10:", "counter:13:"), DeepEquals,
+			[]string{"counter:10:07", "counter:11:00", "counter:12:00"})
+
+		m.Clear()
+		c.Assert(m.KeysInRange("", ""), IsNil)
+	}
+}
+
+func (s *TestSuite) TestShardedKeysInRange(c *C) {
+	sm := s.newShardedMap(16, Shards(4), OrderedKeys())
+	for i := 0; i < 10; i += 1 {
+		sm.Set(fmt.Sprintf("k%d", i), i, 10)
+	}
+	c.Assert(sm.KeysInRange("k3", "k6"), DeepEquals, []string{"k3", "k4", "k5"})
+}
+
+func (s *TestSuite) TestPrefixEnd(c *C) {
+	c.Assert(prefixEnd("abc"), Equals, "abd")
+	c.Assert(prefixEnd("ab\xff"), Equals, "ac")
+	c.Assert(prefixEnd("\xff\xff"), Equals, "")
+	c.Assert(prefixEnd(""), Equals, "")
+}
+
+func (s *TestSuite) TestKeyTree(c *C) {
+	tree := &keyTree{}
+	present := make(map[string]bool)
+	rnd := rand.New(rand.NewSource(1))
+	for i := 0; i < 20000; i += 1 {
+		key := fmt.Sprintf("%05d", rnd.Intn(5000))
+		if rnd.Intn(3) == 0 {
+			tree.remove(key)
+			delete(present, key)
+		} else {
+			tree.insert(key)
+			present[key] = true
+		}
+	}
+	c.Assert(tree.size, Equals, len(present))
+
+	var expected []string
+	for key := range present {
+		expected = append(expected, key)
+	}
+	sort.Strings(expected)
+	var keys []string
+	tree.ascend("", "", func(key string) bool {
+		keys = append(keys, key)
+		return true
+	})
+	c.Assert(keys, DeepEquals, expected)
+	checkKeyNode(c, tree.root, true)
+
+	var ranged []string
+	tree.ascend("01000", "01100", func(key string) bool {
+		ranged = append(ranged, key)
+		return true
+	})
+	from := sort.SearchStrings(expected, "01000")
+	to := sort.SearchStrings(expected, "01100")
+	c.Assert(ranged, DeepEquals, expected[from:to])
+
+	for _, key := range expected {
+		tree.remove(key)
+	}
+	c.Assert(tree.size, Equals, 0)
+	c.Assert(tree.root, IsNil)
+}
+
+// checkKeyNode checks the B-tree invariants and returns the subtree height
+func checkKeyNode(c *C, n *keyNode, root bool) int {
+	c.Assert(len(n.keys) <= 2*minDegree-1, Equals, true)
+	if !root {
+		c.Assert(len(n.keys) >= minDegree-1, Equals, true)
+	}
+	c.Assert(sort.StringsAreSorted(n.keys), Equals, true)
+	if n.leaf() {
+		return 1
+	}
+	c.Assert(len(n.children), Equals, len(n.keys)+1)
+	height := checkKeyNode(c, n.children[0], false)
+	for i, child := range n.children {
+		c.Assert(checkKeyNode(c, child, false), Equals, height)
+		if i > 0 {
+			c.Assert(child.min() > n.keys[i-1], Equals, true)
+		}
+		if i < len(n.keys) {
+			c.Assert(child.max() < n.keys[i], Equals, true)
+		}
+	}
+	return height + 1
+}
+
+func BenchmarkKeysInRange(b *testing.B) {
+	m, _ := NewMap(100000, OrderedKeys())
+	for i := 0; i < 100000; i += 1 {
+		m.Set(fmt.Sprintf("counter:%06d", i), i, 3600)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i += 1 {
+		m.KeysInRange("counter:050000", "counter:050100")
+	}
+}
@@ -0,0 +1,28 @@
+package ttlmap
+
+import (
+	"sync"
+)
+
+// elementPool recycles the elements of removed keys, so setting a new key
+// does not allocate one
+var elementPool = sync.Pool{
+	New: func() interface{} {
+		mapEl := &mapElement{}
+		mapEl.heapEl.Value = mapEl
+		return mapEl
+	},
+}
+
+// newElement returns a zeroed element linked to its expiry heap element
+func newElement() *mapElement {
+	return elementPool.Get().(*mapElement)
+}
+
+// recycle returns a removed element to the pool, it must not be used
+// afterwards
+func recycle(mapEl *mapElement) {
+	*mapEl = mapElement{}
+	mapEl.heapEl.Value = mapEl
+	elementPool.Put(mapEl)
+}
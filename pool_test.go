@@ -0,0 +1,103 @@
+package ttlmap
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+func (s *TestSuite) TestRecycledElements(c *C) {
+	m := s.newMap(2, Eviction(EvictLRU))
+
+	m.Set("a", 1, 1)
+	mapEl := m.elements["a"]
+	m.Delete("a")
+
+	// Removed elements are reset but stay linked to their heap element
+	c.Assert(mapEl.key, Equals, "")
+	c.Assert(mapEl.value, IsNil)
+	c.Assert(mapEl.insertEl, IsNil)
+	c.Assert(mapEl.heapEl.Value, Equals, mapEl)
+	c.Assert(mapEl.heapEl.Priority, Equals, int64(0))
+
+	// Churn through recycled elements
+	for i := 0; i < 10; i += 1 {
+		m.Set(strconv.Itoa(i), i, i%3+1)
+		if i%4 == 0 {
+			s.advanceSeconds(1)
+		}
+	}
+	c.Assert(m.Len(), Equals, 2)
+	for key, mapEl := range m.elements {
+		c.Assert(mapEl.key, Equals, key)
+		c.Assert(mapEl.heapEl.Value, Equals, mapEl)
+	}
+	value, exists := m.Get("9")
+	c.Assert(exists, Equals, true)
+	c.Assert(value, Equals, 9)
+}
+
+// Readers must not touch elements after unlocking, they may be recycled for
+// other keys by then, which the race detector reports
+func (s *TestSuite) TestGetManyWhileRecycling(c *C) {
+	m, err := NewConcurrent(100)
+	c.Assert(err, IsNil)
+	keys := make([]string, 50)
+	for i := range keys {
+		keys[i] = strconv.Itoa(i)
+	}
+
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	run := func(fn func()) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+					fn()
+				}
+			}
+		}()
+	}
+	run(func() {
+		for _, key := range keys {
+			m.SetWithDuration(key, key, time.Microsecond)
+		}
+	})
+	run(func() { m.RemoveExpired(0) })
+	run(func() {
+		for key, value := range m.GetMany(keys) {
+			c.Check(value, Equals, key)
+		}
+	})
+	run(func() {
+		for _, key := range keys {
+			if value, ok := m.Get(key); ok {
+				c.Check(value, Equals, key)
+			}
+		}
+	})
+	time.Sleep(200 * time.Millisecond)
+	close(stop)
+	wg.Wait()
+}
+
+func BenchmarkSetChurn(b *testing.B) {
+	m, _ := NewMap(1000)
+	keys := make([]string, 10000)
+	for i := range keys {
+		keys[i] = strconv.Itoa(i)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i += 1 {
+		m.Set(keys[i%len(keys)], i, 3600)
+	}
+}
@@ -0,0 +1,185 @@
+package ttlmap
+
+// SetWithPriority sets the element with an eviction priority. When the map
+// is full, live elements with a lower priority are evicted before elements
+// with a higher one, the eviction policy only decides between elements of
+// the same priority. Elements set with Set have priority 0, overwriting an
+// element with Set keeps its priority.
+func (m *TtlMap) SetWithPriority(key string, value interface{}, ttlSeconds int, priority int) error {
+	expiryTime, err := m.secondsToExpiryTime(ttlSeconds)
+	if err != nil {
+		return err
+	}
+	if m.mutex != nil {
+		m.mutex.Lock()
+		defer m.mutex.Unlock()
+	}
+
+	if priority != 0 && m.priorities == nil {
+		m.enablePriorities()
+	}
+	if err := m.set(key, value, expiryTime); err != nil {
+		return err
+	}
+	mapEl, ok := m.elements[key]
+	if !ok || mapEl.priority == priority {
+		return nil
+	}
+	m.priorities.remove(mapEl)
+	mapEl.priority = priority
+	m.priorities.add(mapEl)
+	return nil
+}
+
+// enablePriorities wraps the evictor with priority levels, the elements
+// stored so far make up level 0
+func (m *TtlMap) enablePriorities() {
+	base := m.evictor
+	if base == nil {
+		base = newExpiryEvictor()
+		for _, mapEl := range m.elements {
+			base.add(mapEl)
+		}
+	}
+	m.priorities = newPriorityEvictor(m.newLevelEvictor)
+	if len(m.elements) > 0 {
+		m.priorities.addLevel(0, base).len = len(m.elements)
+	}
+	m.evictor = m.priorities
+}
+
+func (m *TtlMap) newLevelEvictor() evictor {
+	if e := m.newEvictor(); e != nil {
+		return e
+	}
+	return newExpiryEvictor()
+}
+
+// priorityEvictor keeps an evictor per priority level and takes victims
+// from the lowest level
+type priorityEvictor struct {
+	newEvictor  func() evictor
+	trackAccess bool
+	levels      map[int]*priorityLevel
+	// order sorts the non-empty levels by priority
+	order *minHeap
+}
+
+type priorityLevel struct {
+	evictor evictor
+	heapEl  *heapElement
+	len     int
+}
+
+func newPriorityEvictor(newEvictor func() evictor) *priorityEvictor {
+	return &priorityEvictor{
+		newEvictor:  newEvictor,
+		trackAccess: newEvictor().tracksAccess(),
+		levels:      make(map[int]*priorityLevel),
+		order:       newMinHeap(),
+	}
+}
+
+func (p *priorityEvictor) addLevel(priority int, e evictor) *priorityLevel {
+	level := &priorityLevel{evictor: e}
+	level.heapEl = &heapElement{Value: level, Priority: int64(priority)}
+	p.levels[priority] = level
+	p.order.PushEl(level.heapEl)
+	return level
+}
+
+func (p *priorityEvictor) add(mapEl *mapElement) {
+	level, ok := p.levels[mapEl.priority]
+	if !ok {
+		level = p.addLevel(mapEl.priority, p.newEvictor())
+	}
+	level.evictor.add(mapEl)
+	level.len += 1
+}
+
+func (p *priorityEvictor) access(mapEl *mapElement) {
+	p.levels[mapEl.priority].evictor.access(mapEl)
+}
+
+func (p *priorityEvictor) remove(mapEl *mapElement) {
+	level := p.levels[mapEl.priority]
+	level.evictor.remove(mapEl)
+	level.len -= 1
+	if level.len == 0 {
+		delete(p.levels, mapEl.priority)
+		p.order.RemoveEl(level.heapEl)
+	}
+}
+
+func (p *priorityEvictor) victim() *mapElement {
+	if p.order.Len() == 0 {
+		return nil
+	}
+	return p.order.PeekEl().Value.(*priorityLevel).evictor.victim()
+}
+
+func (p *priorityEvictor) evicting(mapEl *mapElement) {
+	p.levels[mapEl.priority].evictor.evicting(mapEl)
+}
+
+func (p *priorityEvictor) clear() {
+	p.levels = make(map[int]*priorityLevel)
+	p.order = newMinHeap()
+}
+
+func (p *priorityEvictor) tracksAccess() bool {
+	return p.trackAccess
+}
+
+func (p *priorityEvictor) rescheduled(mapEl *mapElement) {
+	if e, ok := p.levels[mapEl.priority].evictor.(*expiryEvictor); ok {
+		e.rescheduled(mapEl)
+	}
+}
+
+// expiryEvictor picks the soonest expiring element of a priority level, it
+// mirrors the expiry times of the expiry index
+type expiryEvictor struct {
+	expiryTimes *minHeap
+}
+
+func newExpiryEvictor() *expiryEvictor {
+	return &expiryEvictor{expiryTimes: newMinHeap()}
+}
+
+func (e *expiryEvictor) add(mapEl *mapElement) {
+	mapEl.levelEl = &heapElement{Value: mapEl, Priority: mapEl.heapEl.Priority}
+	e.expiryTimes.PushEl(mapEl.levelEl)
+}
+
+func (e *expiryEvictor) access(mapEl *mapElement) {
+}
+
+func (e *expiryEvictor) rescheduled(mapEl *mapElement) {
+	if mapEl.levelEl.Priority != mapEl.heapEl.Priority {
+		e.expiryTimes.UpdateEl(mapEl.levelEl, mapEl.heapEl.Priority)
+	}
+}
+
+func (e *expiryEvictor) remove(mapEl *mapElement) {
+	e.expiryTimes.RemoveEl(mapEl.levelEl)
+	mapEl.levelEl = nil
+}
+
+func (e *expiryEvictor) victim() *mapElement {
+	if e.expiryTimes.Len() == 0 {
+		return nil
+	}
+	return e.expiryTimes.PeekEl().Value.(*mapElement)
+}
+
+func (e *expiryEvictor) evicting(mapEl *mapElement) {
+}
+
+func (e *expiryEvictor) clear() {
+	e.expiryTimes = newMinHeap()
+}
+
+func (e *expiryEvictor) tracksAccess() bool {
+	return false
+}
@@ -0,0 +1,70 @@
+package ttlmap
+
+import (
+	. "gopkg.in/check.v1"
+)
+
+func (s *TestSuite) TestSetWithPriority(c *C) {
+	m := s.newMap(3)
+
+	c.Assert(m.SetWithPriority("a", 1, 0, 1), Not(Equals), nil)
+
+	m.Set("cheap", 1, 10)
+	m.SetWithPriority("expensive", 2, 1, 10)
+	m.SetWithPriority("medium", 3, 2, 5)
+
+	// The lowest priority goes first regardless of expiry times
+	m.Set("d", 4, 20)
+	c.Assert(m.Contains("cheap"), Equals, false)
+
+	m.Set("e", 5, 20)
+	c.Assert(m.Contains("d"), Equals, false)
+
+	// Within a priority level the soonest expiring goes first
+	m.SetWithPriority("f", 6, 30, 5)
+	c.Assert(m.Contains("e"), Equals, false)
+	m.Set("g", 7, 30)
+	c.Assert(m.Contains("medium"), Equals, false)
+	c.Assert(m.Contains("f"), Equals, true)
+	c.Assert(m.Contains("expensive"), Equals, true)
+
+	// Overwriting with Set keeps the priority
+	m.Set("expensive", 8, 1)
+	c.Assert(m.elements["expensive"].priority, Equals, 10)
+}
+
+func (s *TestSuite) TestSetWithPriorityReschedule(c *C) {
+	m := s.newMap(2)
+
+	m.SetWithPriority("a", 1, 5, 1)
+	m.SetWithPriority("b", 2, 10, 1)
+	m.Touch("a", 20)
+
+	m.Set("c", 3, 1)
+	m.SetWithPriority("c", 3, 1, 1)
+	c.Assert(m.Contains("b"), Equals, false)
+	c.Assert(m.Contains("a"), Equals, true)
+
+	m.Delete("a")
+	m.Delete("c")
+	c.Assert(m.priorities.levels, HasLen, 0)
+	c.Assert(m.priorities.order.Len(), Equals, 0)
+}
+
+func (s *TestSuite) TestSetWithPriorityPolicy(c *C) {
+	m := s.newMap(3, Eviction(EvictLRU))
+
+	m.Set("a", 1, 10)
+	m.Set("b", 2, 10)
+	m.SetWithPriority("c", 3, 10, 1)
+	c.Assert(m.priorities.levels[0].len, Equals, 2)
+
+	m.Get("a")
+	m.Set("d", 4, 10)
+	c.Assert(m.Contains("b"), Equals, false)
+	c.Assert(m.Contains("c"), Equals, true)
+
+	m.Clear()
+	m.SetWithPriority("a", 1, 10, 2)
+	c.Assert(m.priorities.levels, HasLen, 1)
+}
@@ -0,0 +1,146 @@
+package ttlmap
+
+import (
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+// LockFreeReads backs the reads of live elements with a sync.Map so they
+// skip the map lock. Every write publishes the element's value and expiry
+// time into the sync.Map, expiry bookkeeping stays in the map, so writes get
+// somewhat more expensive in exchange. Get, GetMany, GetWithTTL, Contains and
+// ExpiresAt are served lock free, Get and friends still take the lock to
+// remove an expired element. It pays off for stable key sets read far more
+// often than written.
+//
+// The sync.Map holds the elements themselves, whose published value and
+// expiry time are updated in place under a sequence lock: a writer makes the
+// sequence number odd while it stores them, and a reader retries while the
+// number is odd or changed under it, so it never sees the new value with the
+// old expiry time or the other way round. Readers never block writers, they
+// only spin while a write to the very same key is in progress. Removed
+// elements are recycled through an epoch based reclaimer, so they are not
+// reused for other keys while a reader may still look at them.
+//
+// Can not be combined with options that modify the map on reads:
+// SlidingExpiration, access tracking eviction policies and TinyLFUAdmission.
+func LockFreeReads() TtlMapOption {
+	return func(m *TtlMap) error {
+		m.readIndex = new(sync.Map)
+		m.reclaimer = &reclaimer{}
+		return nil
+	}
+}
+
+// readEntry is a snapshot of a live element, it is never modified after it
+// is published
+type readEntry struct {
+	value      interface{}
+	expiryTime int64
+}
+
+// seqEntry is the published state of an element in the read index. Writers
+// update it holding the map lock, seq is odd while they do.
+type seqEntry struct {
+	seq        uint64
+	expiryTime int64
+	// value holds a valueBox, atomic.Value can not store nil
+	value atomic.Value
+}
+
+type valueBox struct {
+	value interface{}
+}
+
+// store replaces the value and expiry time, it must be called with the map
+// locked for writing
+func (e *seqEntry) store(value interface{}, expiryTime int64) {
+	atomic.AddUint64(&e.seq, 1)
+	e.value.Store(valueBox{value})
+	atomic.StoreInt64(&e.expiryTime, expiryTime)
+	atomic.AddUint64(&e.seq, 1)
+}
+
+// load returns the value and expiry time of a single write, it retries while
+// a write is in progress or happened during the read
+func (e *seqEntry) load() (value interface{}, expiryTime int64) {
+	for {
+		seq := atomic.LoadUint64(&e.seq)
+		if seq&1 == 0 {
+			value = e.value.Load().(valueBox).value
+			expiryTime = atomic.LoadInt64(&e.expiryTime)
+			if atomic.LoadUint64(&e.seq) == seq {
+				return value, expiryTime
+			}
+		}
+		runtime.Gosched()
+	}
+}
+
+// publish makes the current value and expiry time of the element visible to
+// lock free reads
+func (m *TtlMap) publish(mapEl *mapElement) {
+	if m.readIndex != nil {
+		mapEl.entry.store(mapEl.value, mapEl.heapEl.Priority)
+		if !mapEl.published {
+			m.readIndex.Store(mapEl.key, mapEl)
+			mapEl.published = true
+		}
+	}
+	if m.hot != nil {
+		m.hot.update(mapEl.key, &readEntry{value: mapEl.value, expiryTime: mapEl.heapEl.Priority})
+	}
+}
+
+// unpublish hides the element from lock free reads, it must be called before
+// the key of the element changes
+func (m *TtlMap) unpublish(mapEl *mapElement) {
+	if m.readIndex != nil {
+		m.readIndex.Delete(mapEl.key)
+		mapEl.published = false
+	}
+	if m.hot != nil {
+		m.hot.update(mapEl.key, nil)
+	}
+}
+
+// loadLive reads the published state of the element with the given key,
+// exists is false if there is no live element. found is false if the element
+// has expired, the caller then falls back to the locked path to remove it.
+func (m *TtlMap) loadLive(key string) (value interface{}, expiryTime int64, exists, found bool) {
+	epoch := m.reclaimer.enter()
+	v, ok := m.readIndex.Load(key)
+	if ok {
+		value, expiryTime = v.(*mapElement).entry.load()
+	}
+	m.reclaimer.exit(epoch)
+	if !ok {
+		return nil, 0, false, true
+	}
+	if expiryTime <= m.now() {
+		return nil, 0, false, false
+	}
+	return value, expiryTime, true, true
+}
+
+func (m *TtlMap) lockFreeGetMany(keys []string) map[string]interface{} {
+	values := make(map[string]interface{}, len(keys))
+	var expired []string
+	for _, key := range keys {
+		value, _, exists, found := m.loadLive(key)
+		if !found {
+			expired = append(expired, key)
+			continue
+		}
+		if exists {
+			values[key] = value
+		}
+	}
+	if len(expired) > 0 {
+		for key, value := range m.getMany(expired) {
+			values[key] = value
+		}
+	}
+	return values
+}
@@ -0,0 +1,222 @@
+package ttlmap
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+func (s *TestSuite) TestLockFreeReadsValidation(c *C) {
+	_, err := NewConcurrent(1, LockFreeReads(), SlidingExpiration())
+	c.Assert(err, Not(Equals), nil)
+
+	_, err = NewConcurrent(1, LockFreeReads(), Eviction(EvictLRU))
+	c.Assert(err, Not(Equals), nil)
+
+	_, err = NewConcurrent(1, LockFreeReads(), Eviction(EvictRandom))
+	c.Assert(err, Equals, nil)
+}
+
+func (s *TestSuite) TestLockFreeReads(c *C) {
+	m := s.newMap(2, LockFreeReads())
+
+	m.Set("a", 1, 1)
+	m.Set("b", 2, 5)
+
+	// Reads succeed while a writer holds the lock
+	m.mutex.Lock()
+	valI, exists := m.Get("a")
+	_, missing := m.Get("c")
+	m.mutex.Unlock()
+	c.Assert(exists, Equals, true)
+	c.Assert(valI, Equals, 1)
+	c.Assert(missing, Equals, false)
+
+	m.Set("a", 3, 1)
+	valI, _ = m.Get("a")
+	c.Assert(valI, Equals, 3)
+
+	// Expired elements are removed through the locked path
+	s.advanceSeconds(1)
+	_, exists = m.Get("a")
+	c.Assert(exists, Equals, false)
+	c.Assert(m.Len(), Equals, 1)
+
+	c.Assert(m.Touch("b", 1), Equals, true)
+	s.advanceSeconds(1)
+	_, exists = m.Get("b")
+	c.Assert(exists, Equals, false)
+
+	m.Set("c", 4, 5)
+	m.Rename("c", "d")
+	_, exists = m.Get("c")
+	c.Assert(exists, Equals, false)
+	valI, _ = m.Get("d")
+	c.Assert(valI, Equals, 4)
+
+	// Evicted and cleared elements are unpublished
+	m.Set("e", 5, 5)
+	m.Set("f", 6, 5)
+	_, exists = m.Get("d")
+	c.Assert(exists, Equals, false)
+
+	m.Clear()
+	_, exists = m.Get("e")
+	c.Assert(exists, Equals, false)
+}
+
+func (s *TestSuite) TestLockFreeReadsConcurrent(c *C) {
+	m := s.newMap(100, LockFreeReads())
+
+	var wg sync.WaitGroup
+	for g := 0; g < 4; g += 1 {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 200; i += 1 {
+				m.Set(fmt.Sprintf("k%d", i%50), i, 10)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 200; i += 1 {
+				m.Get(fmt.Sprintf("k%d", i%50))
+			}
+		}()
+	}
+	wg.Wait()
+	c.Assert(m.Len(), Equals, 50)
+}
+
+func (s *TestSuite) TestLockFreeReadsConsistent(c *C) {
+	m := s.newMap(10, LockFreeReads())
+	m.Set("k", [2]int{0, 0}, 1)
+
+	// Readers never see the value of one write with the ttl of another
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	for g := 0; g < 4; g += 1 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				valI, ttl, exists := m.GetWithTTL("k")
+				c.Assert(exists, Equals, true)
+				val := valI.([2]int)
+				c.Assert(val[0], Equals, val[1])
+				c.Assert(ttl, Equals, time.Duration(val[0]%5+1)*time.Second)
+			}
+		}()
+	}
+	for i := 1; i < 1000; i += 1 {
+		m.Set("k", [2]int{i, i}, i%5+1)
+	}
+	close(done)
+	wg.Wait()
+}
+
+func (s *TestSuite) TestLockFreeReadsUpdateInPlace(c *C) {
+	m := s.newMap(10, LockFreeReads())
+
+	m.Set("a", 1, 1)
+	mapEl := m.elements["a"]
+	m.Set("a", 2, 5)
+	m.Touch("a", 10)
+
+	// Writes update the published element and leave its sequence even
+	v, _ := m.readIndex.Load("a")
+	c.Assert(v, Equals, mapEl)
+	seq := atomic.LoadUint64(&mapEl.entry.seq)
+	c.Assert(seq > 0 && seq%2 == 0, Equals, true)
+	value, expiryTime := mapEl.entry.load()
+	c.Assert(value, Equals, 2)
+	c.Assert(expiryTime, Equals, mapEl.heapEl.Priority)
+
+	// A renamed element is published under its new key only
+	m.Rename("a", "b")
+	_, ok := m.readIndex.Load("a")
+	c.Assert(ok, Equals, false)
+	v, _ = m.readIndex.Load("b")
+	c.Assert(v, Equals, mapEl)
+}
+
+func (s *TestSuite) TestSeqEntryWaitsForWriter(c *C) {
+	entry := &seqEntry{expiryTime: 10}
+	entry.value.Store(valueBox{1})
+
+	// A write in progress holds the sequence odd
+	atomic.AddUint64(&entry.seq, 1)
+	loaded := make(chan [2]interface{})
+	go func() {
+		value, expiryTime := entry.load()
+		loaded <- [2]interface{}{value, expiryTime}
+	}()
+	select {
+	case <-loaded:
+		c.Fatal("read during a write")
+	case <-time.After(10 * time.Millisecond):
+	}
+	entry.value.Store(valueBox{2})
+	atomic.StoreInt64(&entry.expiryTime, 20)
+	atomic.AddUint64(&entry.seq, 1)
+
+	c.Assert(<-loaded, Equals, [2]interface{}{2, int64(20)})
+}
+
+func (s *TestSuite) TestLockFreeReadMethods(c *C) {
+	m := s.newMap(3, LockFreeReads())
+
+	m.Set("a", 1, 1)
+	m.Set("b", 2, 5)
+	m.Set("p", 3, NoExpiration)
+
+	m.mutex.Lock()
+	c.Assert(m.Contains("a"), Equals, true)
+	c.Assert(m.Contains("c"), Equals, false)
+	expiresAt, _ := m.ExpiresAt("b")
+	c.Assert(expiresAt, Equals, s.timeProvider.UtcNow().Add(5*time.Second))
+	_, ttl, _ := m.GetWithTTL("b")
+	c.Assert(ttl, Equals, 5*time.Second)
+	_, ttl, exists := m.GetWithTTL("p")
+	c.Assert(exists, Equals, true)
+	c.Assert(ttl, Equals, time.Duration(0))
+	c.Assert(m.GetMany([]string{"a", "b", "c"}), DeepEquals, map[string]interface{}{"a": 1, "b": 2})
+	m.mutex.Unlock()
+
+	s.advanceSeconds(1)
+	c.Assert(m.Contains("a"), Equals, false)
+	c.Assert(m.GetMany([]string{"a", "b"}), DeepEquals, map[string]interface{}{"b": 2})
+	c.Assert(m.Len(), Equals, 2)
+}
+
+func benchmarkParallelGet(b *testing.B, opts ...TtlMapOption) {
+	m, _ := NewConcurrent(1000, opts...)
+	for i := 0; i < 1000; i += 1 {
+		m.Set(fmt.Sprintf("k%d", i), i, 3600)
+	}
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			m.Get(fmt.Sprintf("k%d", i%1000))
+			i += 1
+		}
+	})
+}
+
+func BenchmarkGet(b *testing.B) {
+	benchmarkParallelGet(b)
+}
+
+func BenchmarkGetLockFree(b *testing.B) {
+	benchmarkParallelGet(b, LockFreeReads())
+}
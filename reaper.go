@@ -0,0 +1,222 @@
+package ttlmap
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ReapInterval starts a background reaper when the map is created, see
+// StartReaper. The map has to be created with NewConcurrent.
+func ReapInterval(interval time.Duration) TtlMapOption {
+	return func(m *TtlMap) error {
+		if interval <= 0 {
+			return fmt.Errorf("Reap interval should be > 0, got %v", interval)
+		}
+		m.reapInterval = interval
+		return nil
+	}
+}
+
+// ExpirationMode selects how expired elements are removed from the map
+type ExpirationMode int
+
+const (
+	// LazyExpiration removes expired elements when they are accessed or
+	// when the map runs out of capacity. This is the default when no reaper
+	// is configured.
+	LazyExpiration ExpirationMode = iota + 1
+	// EagerExpiration removes expired elements only in the background
+	// reaper, reads never take the write lock to remove them. Requires the
+	// ReapInterval option.
+	EagerExpiration
+	// LazyAndEagerExpiration combines both, it is the default when a reaper
+	// is configured. Requires the ReapInterval option.
+	LazyAndEagerExpiration
+)
+
+// Expiration sets the expiration mode of the map
+func Expiration(mode ExpirationMode) TtlMapOption {
+	return func(m *TtlMap) error {
+		if mode < LazyExpiration || mode > LazyAndEagerExpiration {
+			return fmt.Errorf("Unknown expiration mode %d", mode)
+		}
+		m.expirationMode = mode
+		return nil
+	}
+}
+
+func (m *TtlMap) validateExpirationMode() error {
+	switch m.expirationMode {
+	case LazyExpiration:
+		if m.reapInterval > 0 {
+			return errors.New("Lazy expiration can not be combined with ReapInterval")
+		}
+	case EagerExpiration, LazyAndEagerExpiration:
+		if m.reapInterval == 0 {
+			return errors.New("Eager expiration requires ReapInterval")
+		}
+	}
+	return nil
+}
+
+// ActiveExpiration makes the reaper expire elements in batches of up to
+// sampleSize soonest expiring elements, releasing the lock between batches.
+// A cycle keeps going while more than a quarter of the last batch was
+// expired, spending at most a quarter of the reap interval, similar to the
+// Redis active expire cycle. Expired elements left over are picked up by the
+// next cycle.
+func ActiveExpiration(sampleSize int) TtlMapOption {
+	return func(m *TtlMap) error {
+		if sampleSize <= 0 {
+			return fmt.Errorf("Sample size should be > 0, got %d", sampleSize)
+		}
+		m.sampleSize = sampleSize
+		return nil
+	}
+}
+
+// SweepBudget bounds the work a reaper cycle does while holding the lock to
+// at most maxEntries expired elements or maxDuration, whichever runs out
+// first, 0 leaves either unbounded. Expired elements over the budget are left
+// to the next cycle, which resumes with the soonest expired ones, so when a
+// lot of elements expire at once they are removed over several cycles rather
+// than in a single long pause. Can not be combined with ActiveExpiration,
+// which bounds its cycles on its own.
+func SweepBudget(maxEntries int, maxDuration time.Duration) TtlMapOption {
+	return func(m *TtlMap) error {
+		if maxEntries < 0 || maxDuration < 0 || maxEntries == 0 && maxDuration == 0 {
+			return fmt.Errorf("Sweep budget should be > 0, got %d entries and %v", maxEntries, maxDuration)
+		}
+		m.sweepEntries = maxEntries
+		m.sweepDuration = maxDuration
+		return nil
+	}
+}
+
+// sweepBatch is the number of elements a budgeted sweep removes between
+// looking at the clock
+const sweepBatch = 16
+
+// StartReaper starts a goroutine that removes expired elements every interval
+// and calls the expiration callback for them, so elements that are never
+// accessed again do not linger in the map. Only concurrent maps can be reaped.
+func (m *TtlMap) StartReaper(interval time.Duration) error {
+	if interval <= 0 {
+		return fmt.Errorf("Reap interval should be > 0, got %v", interval)
+	}
+	if m.mutex == nil {
+		return errors.New("Reaper requires a map created with NewConcurrent")
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if m.reaperStop != nil {
+		return errors.New("Reaper is already running")
+	}
+	m.reaperStop = make(chan struct{})
+	m.reaperDone = make(chan struct{})
+	go m.reap(interval, m.reaperStop, m.reaperDone)
+	return nil
+}
+
+// StopReaper stops the reaper started by StartReaper and waits for it to
+// exit. It is a no-op if the reaper is not running.
+func (m *TtlMap) StopReaper() {
+	if m.mutex == nil {
+		return
+	}
+
+	m.mutex.Lock()
+	stop, done := m.reaperStop, m.reaperDone
+	m.reaperStop, m.reaperDone = nil, nil
+	m.mutex.Unlock()
+
+	if stop == nil {
+		return
+	}
+	close(stop)
+	<-done
+}
+
+func (m *TtlMap) reap(interval time.Duration, stop <-chan struct{}, done chan<- struct{}) {
+	defer close(done)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			start := time.Now()
+			removed := 0
+			switch {
+			case m.sampleSize > 0:
+				removed = m.activeExpireCycle(interval / 4)
+			case m.sweepEntries > 0 || m.sweepDuration > 0:
+				removed = m.lockNSweep()
+			default:
+				removed = m.lockNReap(0)
+			}
+			if removed > 0 && m.logger != nil {
+				m.logger.Debugf("ttlmap: reaper removed %d expired elements in %v", removed, time.Since(start))
+			}
+			if m.highWatermark > 0 {
+				m.lockNTrim()
+			}
+			if m.latencies != nil {
+				m.latencies.sweep.record(start)
+			}
+		case <-stop:
+			return
+		}
+	}
+}
+
+// activeExpireCycle expires batches of sampleSize elements while the batches
+// are mostly expired and the time budget is not exhausted
+func (m *TtlMap) activeExpireCycle(budget time.Duration) int {
+	start := time.Now()
+	total := 0
+	for {
+		removed := m.lockNReap(m.sampleSize)
+		total += removed
+		if removed*4 <= m.sampleSize || time.Since(start) >= budget {
+			return total
+		}
+	}
+}
+
+// lockNSweep removes expired elements within the sweep budget
+func (m *TtlMap) lockNSweep() int {
+	if m.mutex != nil {
+		m.mutex.Lock()
+		defer m.mutex.Unlock()
+	}
+	if m.sweepDuration == 0 {
+		return m.reapExpired(m.sweepEntries, nil)
+	}
+
+	deadline := time.Now().Add(m.sweepDuration)
+	removed := 0
+	for {
+		batch := sweepBatch
+		if m.sweepEntries > 0 && m.sweepEntries-removed < batch {
+			batch = m.sweepEntries - removed
+		}
+		n := m.reapExpired(batch, nil)
+		removed += n
+		if n < batch || removed == m.sweepEntries || !time.Now().Before(deadline) {
+			return removed
+		}
+	}
+}
+
+func (m *TtlMap) lockNReap(max int) int {
+	if m.mutex != nil {
+		m.mutex.Lock()
+		defer m.mutex.Unlock()
+	}
+	return m.reapExpired(max, nil)
+}
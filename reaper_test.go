@@ -0,0 +1,204 @@
+package ttlmap
+
+import (
+	"fmt"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+func (s *TestSuite) TestReaperValidation(c *C) {
+	_, err := NewConcurrent(1, ReapInterval(0))
+	c.Assert(err, Not(Equals), nil)
+
+	_, err = NewMap(1, ReapInterval(time.Millisecond))
+	c.Assert(err, Not(Equals), nil)
+
+	m, err := NewMap(1)
+	c.Assert(err, Equals, nil)
+	c.Assert(m.StartReaper(time.Millisecond), Not(Equals), nil)
+	m.StopReaper()
+
+	m = s.newMap(1)
+	c.Assert(m.StartReaper(0), Not(Equals), nil)
+	c.Assert(m.StartReaper(time.Millisecond), Equals, nil)
+	c.Assert(m.StartReaper(time.Millisecond), Not(Equals), nil)
+	m.StopReaper()
+	m.StopReaper()
+}
+
+func (s *TestSuite) TestReaperRemovesExpired(c *C) {
+	expired := make(chan string, 2)
+	m := s.newMap(2, CallOnExpire(func(key string, el interface{}) {
+		expired <- key
+	}))
+
+	m.Set("a", 1, 1)
+	m.Set("b", 2, 10)
+
+	s.advanceSeconds(1)
+
+	c.Assert(m.StartReaper(time.Millisecond), Equals, nil)
+	defer m.StopReaper()
+
+	select {
+	case key := <-expired:
+		c.Assert(key, Equals, "a")
+	case <-time.After(time.Second):
+		c.Fatal("Reaper did not remove the expired element")
+	}
+	c.Assert(m.Len(), Equals, 1)
+}
+
+func (s *TestSuite) TestReapIntervalOption(c *C) {
+	m := s.newMap(1, ReapInterval(time.Millisecond))
+
+	m.mutex.Lock()
+	running := m.reaperStop != nil
+	m.mutex.Unlock()
+	c.Assert(running, Equals, true)
+
+	m.StopReaper()
+	c.Assert(m.reaperStop, IsNil)
+}
+
+func (s *TestSuite) TestActiveExpirationValidation(c *C) {
+	_, err := NewConcurrent(1, ActiveExpiration(0))
+	c.Assert(err, Not(Equals), nil)
+}
+
+func (s *TestSuite) TestActiveExpireCycle(c *C) {
+	m := s.newMap(100, ActiveExpiration(10))
+
+	for i := 0; i < 100; i += 1 {
+		m.Set(fmt.Sprintf("k%d", i), i, 1+i%2)
+	}
+
+	s.advanceSeconds(1)
+
+	// Half of the elements are expired, batches keep going until one is
+	// mostly live
+	c.Assert(m.activeExpireCycle(time.Minute), Equals, 50)
+	c.Assert(m.Len(), Equals, 50)
+
+	c.Assert(m.activeExpireCycle(time.Minute), Equals, 0)
+}
+
+func (s *TestSuite) TestActiveExpireCycleStopsOnSparseBatch(c *C) {
+	m := s.newMap(100, ActiveExpiration(10))
+
+	for i := 0; i < 100; i += 1 {
+		m.Set(fmt.Sprintf("k%d", i), i, 10)
+	}
+	m.Set("k0", 0, 1)
+	m.Set("k1", 1, 1)
+
+	s.advanceSeconds(1)
+
+	c.Assert(m.activeExpireCycle(time.Minute), Equals, 2)
+}
+
+func (s *TestSuite) TestActiveExpirationReaper(c *C) {
+	expired := make(chan string, 1)
+	m := s.newMap(2, ActiveExpiration(1), CallOnExpire(func(key string, el interface{}) {
+		expired <- key
+	}))
+
+	m.Set("a", 1, 1)
+	s.advanceSeconds(1)
+
+	c.Assert(m.StartReaper(time.Millisecond), Equals, nil)
+	defer m.StopReaper()
+
+	c.Assert(<-expired, Equals, "a")
+}
+
+func (s *TestSuite) TestSweepBudgetValidation(c *C) {
+	_, err := NewConcurrent(1, SweepBudget(0, 0))
+	c.Assert(err, Not(Equals), nil)
+	_, err = NewConcurrent(1, SweepBudget(-1, time.Second))
+	c.Assert(err, Not(Equals), nil)
+	_, err = NewConcurrent(1, SweepBudget(10, 0), ActiveExpiration(10))
+	c.Assert(err, Not(Equals), nil)
+}
+
+func (s *TestSuite) TestSweepBudget(c *C) {
+	m := s.newMap(100, SweepBudget(30, 0))
+	for i := 0; i < 100; i += 1 {
+		m.Set(fmt.Sprintf("k%d", i), i, 1+i%2)
+	}
+	s.advanceSeconds(1)
+
+	// Each sweep stops at the budget and the next one resumes
+	c.Assert(m.lockNSweep(), Equals, 30)
+	c.Assert(m.lockNSweep(), Equals, 20)
+	c.Assert(m.lockNSweep(), Equals, 0)
+	c.Assert(m.Len(), Equals, 50)
+
+	// A time budget is checked between batches
+	m = s.newMap(100, SweepBudget(0, time.Nanosecond))
+	for i := 0; i < 100; i += 1 {
+		m.Set(fmt.Sprintf("k%d", i), i, 1)
+	}
+	s.advanceSeconds(1)
+	c.Assert(m.lockNSweep(), Equals, sweepBatch)
+
+	m = s.newMap(100, SweepBudget(40, time.Minute))
+	for i := 0; i < 100; i += 1 {
+		m.Set(fmt.Sprintf("k%d", i), i, 1)
+	}
+	s.advanceSeconds(1)
+	c.Assert(m.lockNSweep(), Equals, 40)
+}
+
+func (s *TestSuite) TestExpirationModeValidation(c *C) {
+	_, err := NewConcurrent(1, Expiration(0))
+	c.Assert(err, Not(Equals), nil)
+
+	_, err = NewConcurrent(1, Expiration(LazyExpiration), ReapInterval(time.Second))
+	c.Assert(err, Not(Equals), nil)
+
+	_, err = NewConcurrent(1, Expiration(EagerExpiration))
+	c.Assert(err, Not(Equals), nil)
+
+	_, err = NewConcurrent(1, Expiration(LazyAndEagerExpiration))
+	c.Assert(err, Not(Equals), nil)
+
+	m, err := NewConcurrent(1, Expiration(LazyExpiration))
+	c.Assert(err, Equals, nil)
+	c.Assert(m, NotNil)
+}
+
+func (s *TestSuite) TestEagerExpiration(c *C) {
+	expired := make(chan string, 1)
+	m := s.newMap(1, Expiration(EagerExpiration), ReapInterval(time.Hour),
+		CallOnExpire(func(key string, el interface{}) {
+			expired <- key
+		}))
+	defer m.StopReaper()
+
+	m.Set("a", 1, 1)
+	s.advanceSeconds(1)
+
+	// Reads report the element as missing but leave it to the reaper
+	_, exists := m.Get("a")
+	c.Assert(exists, Equals, false)
+	c.Assert(m.GetMany([]string{"a"}), HasLen, 0)
+	c.Assert(m.Len(), Equals, 1)
+
+	c.Assert(m.lockNReap(0), Equals, 1)
+	c.Assert(<-expired, Equals, "a")
+	c.Assert(m.Len(), Equals, 0)
+}
+
+func (s *TestSuite) TestLazyAndEagerExpiration(c *C) {
+	m := s.newMap(1, Expiration(LazyAndEagerExpiration), ReapInterval(time.Hour))
+	defer m.StopReaper()
+
+	m.Set("a", 1, 1)
+	s.advanceSeconds(1)
+
+	_, exists := m.Get("a")
+	c.Assert(exists, Equals, false)
+	c.Assert(m.Len(), Equals, 0)
+}
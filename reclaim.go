@@ -0,0 +1,85 @@
+package ttlmap
+
+import (
+	"sync/atomic"
+)
+
+// reclaimer defers recycling removed elements for the LockFreeReads readers,
+// which use elements outside the map lock. Such a reader brackets its access
+// with enter and exit, and a removed element is only recycled once every reader that might
+// have found it before it was removed has exited. Without a reclaimer the
+// pool could hand the element out to a new key while the reader still looks
+// at it.
+//
+// It is an epoch scheme with two generations: elements retired in one epoch
+// are recycled when the epoch after next begins, and an epoch only begins
+// once the readers of the epoch before the current one are gone. Readers
+// never block and the writer never waits, retired elements just pile up
+// until the readers are done.
+type reclaimer struct {
+	// epoch is advanced by writers holding the map lock
+	epoch uint64
+	// active counts the readers by epoch parity
+	active [2]int64
+	// retired elements by epoch parity, guarded by the map lock
+	retired [2][]*mapElement
+}
+
+// enter registers a reader, elements it finds from now on stay untouched
+// until it calls exit with the returned epoch
+func (r *reclaimer) enter() uint64 {
+	for {
+		epoch := atomic.LoadUint64(&r.epoch)
+		atomic.AddInt64(&r.active[epoch&1], 1)
+		// A reader registered for an epoch that ended in the meantime may be
+		// missed by advance, it tries again in the current one
+		if atomic.LoadUint64(&r.epoch) == epoch {
+			return epoch
+		}
+		atomic.AddInt64(&r.active[epoch&1], -1)
+	}
+}
+
+func (r *reclaimer) exit(epoch uint64) {
+	atomic.AddInt64(&r.active[epoch&1], -1)
+}
+
+// retire queues an element that is no longer reachable from the map for
+// recycling, it must be called with the map lock held
+func (r *reclaimer) retire(mapEl *mapElement) {
+	epoch := atomic.LoadUint64(&r.epoch)
+	r.retired[epoch&1] = append(r.retired[epoch&1], mapEl)
+	r.advance()
+}
+
+// advance begins the next epoch if no reader of the previous epoch is left.
+// The elements retired in the previous epoch were removed before the current
+// one began, so only readers of the previous epoch could have found them.
+func (r *reclaimer) advance() {
+	epoch := atomic.LoadUint64(&r.epoch)
+	previous := (epoch + 1) & 1
+	if atomic.LoadInt64(&r.active[previous]) != 0 {
+		return
+	}
+	for i, mapEl := range r.retired[previous] {
+		recycle(mapEl)
+		r.retired[previous][i] = nil
+	}
+	r.retired[previous] = r.retired[previous][:0]
+	atomic.StoreUint64(&r.epoch, epoch+1)
+}
+
+// recycle returns a removed element to the pool, through the reclaimer if
+// the map has one. Elements left in the expiry heap by LazyDeletion are
+// recycled once the heap discards them.
+func (m *TtlMap) recycle(mapEl *mapElement) {
+	if mapEl.dead {
+		// The expiry heap still holds the element
+		return
+	}
+	if m.reclaimer != nil {
+		m.reclaimer.retire(mapEl)
+		return
+	}
+	recycle(mapEl)
+}
@@ -0,0 +1,77 @@
+package ttlmap
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+func (s *TestSuite) TestReclaimer(c *C) {
+	m := s.newMap(2, LockFreeReads())
+	r := m.reclaimer
+
+	m.Set("a", 1, 10)
+	epoch := r.enter()
+	mapEl := m.elements["a"]
+	m.Delete("a")
+
+	// The element stays untouched while the reader may hold it
+	for i := 0; i < 10; i += 1 {
+		m.Set(fmt.Sprintf("k%d", i), i, 10)
+	}
+	c.Assert(mapEl.key, Equals, "a")
+	c.Assert(mapEl.value, Equals, 1)
+	c.Assert(len(r.retired[0])+len(r.retired[1]), Equals, 9)
+
+	// Retired elements are recycled once the reader is gone
+	r.exit(epoch)
+	m.Set("b", 2, 10)
+	m.Set("c", 3, 10)
+	c.Assert(mapEl.key, Not(Equals), "a")
+	c.Assert(len(r.retired[0])+len(r.retired[1]) <= 1, Equals, true)
+}
+
+// Lock free readers look at elements that may be removed meanwhile, they must
+// not be reused for other keys before the readers are done, which the race
+// detector reports
+func (s *TestSuite) TestReclaimerConcurrent(c *C) {
+	m, err := NewConcurrent(10, LockFreeReads())
+	c.Assert(err, IsNil)
+	keys := make([]string, 20)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("k%d", i)
+	}
+
+	var wg sync.WaitGroup
+	done := make(chan struct{})
+	for g := 0; g < 4; g += 1 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				for _, key := range keys {
+					if value, ok := m.Get(key); ok {
+						c.Check(value, Equals, key)
+					}
+				}
+			}
+		}()
+	}
+	for i := 0; i < 20000; i += 1 {
+		key := keys[i%len(keys)]
+		if i%3 == 0 {
+			m.Delete(key)
+		} else {
+			m.SetWithDuration(key, key, time.Duration(i%5)*time.Microsecond+time.Microsecond)
+		}
+	}
+	close(done)
+	wg.Wait()
+}
@@ -0,0 +1,66 @@
+package ttlmap
+
+import (
+	"errors"
+	"fmt"
+)
+
+// RemovalReason tells why an element was removed from the map
+type RemovalReason int
+
+const (
+	// Expired elements ran out of ttl or were expired with Expire
+	Expired RemovalReason = iota + 1
+	// EvictedCapacity elements were evicted to make room for other elements
+	EvictedCapacity
+	// Deleted elements were removed with Delete, Pop or Clear
+	Deleted
+	// Replaced values were overwritten by a new value for the same key
+	Replaced
+)
+
+func (r RemovalReason) String() string {
+	switch r {
+	case Expired:
+		return "expired"
+	case EvictedCapacity:
+		return "evicted"
+	case Deleted:
+		return "deleted"
+	case Replaced:
+		return "replaced"
+	}
+	return fmt.Sprintf("RemovalReason(%d)", int(r))
+}
+
+// RemovalCallback is called with the key and the value of a removed element
+type RemovalCallback func(key string, value interface{}, reason RemovalReason)
+
+// OnRemove sets the callback called whenever an element or value leaves the
+// map, whatever the reason. Unlike the expiration callback it also fires for
+// elements expired without being accessed, evicted, deleted, or replaced
+// values. It is called while the map is locked, so it must not access the
+// map, unless AsyncCallbacks is used.
+func OnRemove(cb RemovalCallback) TtlMapOption {
+	return func(m *TtlMap) error {
+		if cb == nil {
+			return errors.New("Please pass removal callback")
+		}
+		m.onRemove = cb
+		return nil
+	}
+}
+
+func (m *TtlMap) removed(mapEl *mapElement, reason RemovalReason) {
+	m.counters.removals[reason] += 1
+	if reason == EvictedCapacity && m.logger != nil {
+		m.evictedForCapacity()
+	}
+	if m.events != nil {
+		m.removalEvent(mapEl, reason)
+	}
+	if m.onRemove != nil {
+		key, value := mapEl.key, mapEl.value
+		m.notify(func() { m.onRemove(key, value, reason) })
+	}
+}
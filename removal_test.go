@@ -0,0 +1,62 @@
+package ttlmap
+
+import (
+	. "gopkg.in/check.v1"
+)
+
+type removal struct {
+	key    string
+	value  interface{}
+	reason RemovalReason
+}
+
+func (s *TestSuite) newRemovalMap(capacity int, removals *[]removal, opts ...TtlMapOption) *TtlMap {
+	opts = append(opts, OnRemove(func(key string, value interface{}, reason RemovalReason) {
+		*removals = append(*removals, removal{key, value, reason})
+	}))
+	return s.newMap(capacity, opts...)
+}
+
+func (s *TestSuite) TestOnRemoveValidation(c *C) {
+	_, err := NewMap(1, OnRemove(nil))
+	c.Assert(err, Not(Equals), nil)
+}
+
+func (s *TestSuite) TestOnRemove(c *C) {
+	var removals []removal
+	m := s.newRemovalMap(2, &removals)
+
+	m.Set("a", 1, 1)
+	m.Set("a", 2, 1)
+	c.Assert(removals, DeepEquals, []removal{{"a", 1, Replaced}})
+
+	m.Set("b", 3, 5)
+	m.Set("c", 4, 5)
+	c.Assert(removals[1:], DeepEquals, []removal{{"a", 2, EvictedCapacity}})
+
+	m.Delete("b")
+	m.Pop("c")
+	c.Assert(removals[2:], DeepEquals, []removal{{"b", 3, Deleted}, {"c", 4, Deleted}})
+
+	m.Set("d", 5, 1)
+	s.advanceSeconds(1)
+	m.Get("d")
+	c.Assert(removals[4:], DeepEquals, []removal{{"d", 5, Expired}})
+
+	// Expired elements removed to make room are reported as well
+	m.Set("e", 6, 1)
+	m.Set("f", 7, 5)
+	s.advanceSeconds(1)
+	m.Set("g", 8, 5)
+	c.Assert(removals[5:], DeepEquals, []removal{{"e", 6, Expired}})
+
+	m.Clear()
+	c.Assert(removals[6:], HasLen, 2)
+	c.Assert(removals[6].reason, Equals, Deleted)
+	c.Assert(removals[7].reason, Equals, Deleted)
+}
+
+func (s *TestSuite) TestOnRemoveReasonString(c *C) {
+	c.Assert(EvictedCapacity.String(), Equals, "evicted")
+	c.Assert(RemovalReason(0).String(), Equals, "RemovalReason(0)")
+}
@@ -0,0 +1,840 @@
+package ttlmap
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Shards sets the number of shards of a map created with NewSharded
+func Shards(n int) TtlMapOption {
+	return func(m *TtlMap) error {
+		if n <= 0 {
+			return fmt.Errorf("Shards should be > 0, got %d", n)
+		}
+		m.shards = n
+		return nil
+	}
+}
+
+// asShard marks maps created by NewSharded, only they accept Shards
+func asShard() TtlMapOption {
+	return func(m *TtlMap) error {
+		m.shard = true
+		return nil
+	}
+}
+
+// ShardedMap spreads its elements over independent concurrent maps by key
+// hash, so operations on different keys rarely contend for the same lock.
+// Capacity and expiration are enforced per shard: each shard holds its share
+// of the capacity and evicts on its own. It has the methods of TtlMap,
+// operations on several keys lock one shard at a time.
+type ShardedMap struct {
+	shards []*TtlMap
+	// events and evictions merge the channels of the shards
+	events    chan Event
+	evictions chan EvictedEntry
+	// stop ends the goroutines forwarding to the merged channels
+	stop      chan struct{}
+	closeOnce sync.Once
+}
+
+// NewSharded creates a concurrent map of the number of shards given with the
+// Shards option (16 by default), the capacity is split evenly between them.
+// All other options apply to every shard. With EventChannel and
+// EvictionChannel, goroutines merge the channels of the shards into the ones
+// returned by Events and Evictions until the map is closed.
+func NewSharded(capacity int, opts ...TtlMapOption) (*ShardedMap, error) {
+	probe := &TtlMap{capacity: capacity, shards: 16}
+	for _, o := range opts {
+		if err := o(probe); err != nil {
+			return nil, err
+		}
+	}
+	n := probe.shards
+	if capacity < n {
+		return nil, fmt.Errorf("Capacity should be >= number of shards %d, got %d", n, capacity)
+	}
+
+	opts = append(opts, asShard())
+	sm := &ShardedMap{shards: make([]*TtlMap, n), stop: make(chan struct{})}
+	for i := range sm.shards {
+		shard, err := newMap(sm.shardCapacity(capacity, i), true, opts...)
+		if err != nil {
+			sm.Close()
+			return nil, err
+		}
+		sm.shards[i] = shard
+	}
+	if probe.events != nil {
+		sm.events = make(chan Event, cap(probe.events))
+		for _, shard := range sm.shards {
+			go forwardEvents(shard.events, sm.events, sm.stop)
+		}
+	}
+	if probe.evictions != nil {
+		sm.evictions = make(chan EvictedEntry, cap(probe.evictions))
+		for _, shard := range sm.shards {
+			go forwardEvictions(shard.evictions, sm.evictions, sm.stop)
+		}
+	}
+	if probe.expvarName != "" {
+		if err := publishExpvar(probe.expvarName, sm.Stats); err != nil {
+			sm.Close()
+			return nil, err
+		}
+	}
+	return sm, nil
+}
+
+// shardCapacity returns the share of shard i of the capacity
+func (sm *ShardedMap) shardCapacity(capacity, i int) int {
+	n := len(sm.shards)
+	shardCapacity := capacity / n
+	if i < capacity%n {
+		shardCapacity += 1
+	}
+	return shardCapacity
+}
+
+func forwardEvents(from <-chan Event, to chan<- Event, stop <-chan struct{}) {
+	for {
+		select {
+		case event := <-from:
+			select {
+			case to <- event:
+			case <-stop:
+				return
+			}
+		case <-stop:
+			return
+		}
+	}
+}
+
+func forwardEvictions(from <-chan EvictedEntry, to chan<- EvictedEntry, stop <-chan struct{}) {
+	for {
+		select {
+		case entry := <-from:
+			select {
+			case to <- entry:
+			case <-stop:
+				return
+			}
+		case <-stop:
+			return
+		}
+	}
+}
+
+func (sm *ShardedMap) shardOf(key string) *TtlMap {
+	return sm.shards[hashKey(key)%uint32(len(sm.shards))]
+}
+
+func (sm *ShardedMap) shardIndexOf(key string) int {
+	return int(hashKey(key) % uint32(len(sm.shards)))
+}
+
+// shardOfBytes hashes like hashKey without converting the key to a string
+func (sm *ShardedMap) shardOfBytes(key []byte) *TtlMap {
+	h := uint32(2166136261)
+	for _, b := range key {
+		h ^= uint32(b)
+		h *= 16777619
+	}
+	return sm.shards[h%uint32(len(sm.shards))]
+}
+
+// hashKey is an inlined 32 bit FNV-1a, hash/fnv would allocate per call
+func hashKey(key string) uint32 {
+	h := uint32(2166136261)
+	for i := 0; i < len(key); i += 1 {
+		h ^= uint32(key[i])
+		h *= 16777619
+	}
+	return h
+}
+
+func (sm *ShardedMap) Set(key string, value interface{}, ttlSeconds int) error {
+	return sm.shardOf(key).Set(key, value, ttlSeconds)
+}
+
+func (sm *ShardedMap) SetWithDuration(key string, value interface{}, ttl time.Duration) error {
+	return sm.shardOf(key).SetWithDuration(key, value, ttl)
+}
+
+func (sm *ShardedMap) SetIfAbsent(key string, value interface{}, ttlSeconds int) (bool, error) {
+	return sm.shardOf(key).SetIfAbsent(key, value, ttlSeconds)
+}
+
+func (sm *ShardedMap) Get(key string) (interface{}, bool) {
+	return sm.shardOf(key).Get(key)
+}
+
+func (sm *ShardedMap) GetOrCompute(key string, ttlSeconds int, fn func() (interface{}, error)) (interface{}, error) {
+	return sm.shardOf(key).GetOrCompute(key, ttlSeconds, fn)
+}
+
+func (sm *ShardedMap) GetWithTTL(key string) (interface{}, time.Duration, bool) {
+	return sm.shardOf(key).GetWithTTL(key)
+}
+
+func (sm *ShardedMap) Contains(key string) bool {
+	return sm.shardOf(key).Contains(key)
+}
+
+func (sm *ShardedMap) Delete(key string) bool {
+	return sm.shardOf(key).Delete(key)
+}
+
+func (sm *ShardedMap) Pop(key string) (interface{}, bool) {
+	return sm.shardOf(key).Pop(key)
+}
+
+func (sm *ShardedMap) Expire(key string) bool {
+	return sm.shardOf(key).Expire(key)
+}
+
+func (sm *ShardedMap) Touch(key string, ttlSeconds int) bool {
+	return sm.shardOf(key).Touch(key, ttlSeconds)
+}
+
+func (sm *ShardedMap) ExpiresAt(key string) (time.Time, bool) {
+	return sm.shardOf(key).ExpiresAt(key)
+}
+
+func (sm *ShardedMap) Increment(key string, value int, ttlSeconds int) (int, error) {
+	return sm.shardOf(key).Increment(key, value, ttlSeconds)
+}
+
+func (sm *ShardedMap) Update(key string, ttlSeconds int, fn func(current interface{}, exists bool) (interface{}, error)) error {
+	return sm.shardOf(key).Update(key, ttlSeconds, fn)
+}
+
+func (sm *ShardedMap) SetDefault(key string, value interface{}) error {
+	return sm.shardOf(key).SetDefault(key, value)
+}
+
+func (sm *ShardedMap) SetWithExpireAt(key string, value interface{}, expireAt time.Time) error {
+	return sm.shardOf(key).SetWithExpireAt(key, value, expireAt)
+}
+
+func (sm *ShardedMap) SetWithPriority(key string, value interface{}, ttlSeconds int, priority int) error {
+	return sm.shardOf(key).SetWithPriority(key, value, ttlSeconds, priority)
+}
+
+func (sm *ShardedMap) SetCtx(ctx context.Context, key string, value interface{}, ttlSeconds int) error {
+	return sm.shardOf(key).SetCtx(ctx, key, value, ttlSeconds)
+}
+
+func (sm *ShardedMap) SetKeepTTL(key string, value interface{}) bool {
+	return sm.shardOf(key).SetKeepTTL(key, value)
+}
+
+func (sm *ShardedMap) Replace(key string, value interface{}, ttlSeconds int) (bool, error) {
+	return sm.shardOf(key).Replace(key, value, ttlSeconds)
+}
+
+func (sm *ShardedMap) CompareAndSwap(key string, oldValue, newValue interface{}, ttlSeconds int) (bool, error) {
+	return sm.shardOf(key).CompareAndSwap(key, oldValue, newValue, ttlSeconds)
+}
+
+func (sm *ShardedMap) GetOrSet(key string, value interface{}, ttlSeconds int) (actual interface{}, loaded bool, err error) {
+	return sm.shardOf(key).GetOrSet(key, value, ttlSeconds)
+}
+
+// SetMany sets the entries shard by shard, each shard is locked once
+func (sm *ShardedMap) SetMany(entries map[string]interface{}, ttlSeconds int) error {
+	byShard := make([]map[string]interface{}, len(sm.shards))
+	for key, value := range entries {
+		i := sm.shardIndexOf(key)
+		if byShard[i] == nil {
+			byShard[i] = make(map[string]interface{})
+		}
+		byShard[i][key] = value
+	}
+	for i, shardEntries := range byShard {
+		if shardEntries == nil {
+			continue
+		}
+		if err := sm.shards[i].SetMany(shardEntries, ttlSeconds); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (sm *ShardedMap) GetCtx(ctx context.Context, key string) (interface{}, bool, error) {
+	return sm.shardOf(key).GetCtx(ctx, key)
+}
+
+func (sm *ShardedMap) GetStale(key string) (value interface{}, stale bool, ok bool) {
+	return sm.shardOf(key).GetStale(key)
+}
+
+// GetMany looks the keys up shard by shard, each shard is locked once
+func (sm *ShardedMap) GetMany(keys []string) map[string]interface{} {
+	byShard := make([][]string, len(sm.shards))
+	for _, key := range keys {
+		i := sm.shardIndexOf(key)
+		byShard[i] = append(byShard[i], key)
+	}
+	values := make(map[string]interface{}, len(keys))
+	for i, shardKeys := range byShard {
+		if len(shardKeys) == 0 {
+			continue
+		}
+		for key, value := range sm.shards[i].GetMany(shardKeys) {
+			values[key] = value
+		}
+	}
+	return values
+}
+
+func (sm *ShardedMap) GetOrComputeCtx(ctx context.Context, key string, ttlSeconds int, fn func(ctx context.Context) (interface{}, error)) (interface{}, error) {
+	return sm.shardOf(key).GetOrComputeCtx(ctx, key, ttlSeconds, fn)
+}
+
+func (sm *ShardedMap) GetInt(key string) (int, bool, error) {
+	return sm.shardOf(key).GetInt(key)
+}
+
+func (sm *ShardedMap) GetFloat(key string) (float64, bool, error) {
+	return sm.shardOf(key).GetFloat(key)
+}
+
+func (sm *ShardedMap) GetString(key string) (string, bool, error) {
+	return sm.shardOf(key).GetString(key)
+}
+
+func (sm *ShardedMap) GetBytes(key string) ([]byte, bool, error) {
+	return sm.shardOf(key).GetBytes(key)
+}
+
+func (sm *ShardedMap) GetBool(key string) (bool, bool, error) {
+	return sm.shardOf(key).GetBool(key)
+}
+
+func (sm *ShardedMap) GetByBytes(key []byte) (interface{}, bool) {
+	return sm.shardOfBytes(key).GetByBytes(key)
+}
+
+func (sm *ShardedMap) ContainsByBytes(key []byte) bool {
+	return sm.shardOfBytes(key).ContainsByBytes(key)
+}
+
+func (sm *ShardedMap) SetByBytes(key []byte, value interface{}, ttlSeconds int) error {
+	return sm.shardOfBytes(key).SetByBytes(key, value, ttlSeconds)
+}
+
+func (sm *ShardedMap) DeleteByBytes(key []byte) bool {
+	return sm.shardOfBytes(key).DeleteByBytes(key)
+}
+
+// KeyCodec returns the codec set with WithKeyCodec, all shards share it
+func (sm *ShardedMap) KeyCodec() KeyCodec {
+	return sm.shards[0].KeyCodec()
+}
+
+func (sm *ShardedMap) SetKey(key interface{}, value interface{}, ttlSeconds int) error {
+	codec := sm.KeyCodec()
+	if codec == nil {
+		return errors.New("Key codec is not configured")
+	}
+	return sm.Set(codec.Encode(key), value, ttlSeconds)
+}
+
+func (sm *ShardedMap) GetKey(key interface{}) (interface{}, bool) {
+	codec := sm.KeyCodec()
+	if codec == nil {
+		return nil, false
+	}
+	return sm.Get(codec.Encode(key))
+}
+
+func (sm *ShardedMap) ContainsKey(key interface{}) bool {
+	codec := sm.KeyCodec()
+	if codec == nil {
+		return false
+	}
+	return sm.Contains(codec.Encode(key))
+}
+
+func (sm *ShardedMap) DeleteKey(key interface{}) bool {
+	codec := sm.KeyCodec()
+	if codec == nil {
+		return false
+	}
+	return sm.Delete(codec.Encode(key))
+}
+
+func (sm *ShardedMap) TouchWithDuration(key string, ttl time.Duration) bool {
+	return sm.shardOf(key).TouchWithDuration(key, ttl)
+}
+
+func (sm *ShardedMap) Persist(key string) bool {
+	return sm.shardOf(key).Persist(key)
+}
+
+func (sm *ShardedMap) EntryInfo(key string) (EntryInfo, bool) {
+	return sm.shardOf(key).EntryInfo(key)
+}
+
+func (sm *ShardedMap) IncrementWithDuration(key string, value int, ttl time.Duration) (int, error) {
+	return sm.shardOf(key).IncrementWithDuration(key, value, ttl)
+}
+
+func (sm *ShardedMap) IncrementKeepTTL(key string, value int, ttlSeconds int) (int, error) {
+	return sm.shardOf(key).IncrementKeepTTL(key, value, ttlSeconds)
+}
+
+func (sm *ShardedMap) IncrementFloat(key string, value float64, ttlSeconds int) (float64, error) {
+	return sm.shardOf(key).IncrementFloat(key, value, ttlSeconds)
+}
+
+func (sm *ShardedMap) Append(key string, data []byte, ttlSeconds int) (int, error) {
+	return sm.shardOf(key).Append(key, data, ttlSeconds)
+}
+
+// Rename moves the live element under oldKey to newKey keeping its expiry
+// time. When the keys belong to different shards both shards are locked and
+// the element is stored anew in the shard of newKey, which may evict or
+// reject it like a Set would; Rename then returns false and leaves the
+// element under oldKey.
+func (sm *ShardedMap) Rename(oldKey, newKey string) bool {
+	from, to := sm.shardIndexOf(oldKey), sm.shardIndexOf(newKey)
+	if from == to {
+		return sm.shards[from].Rename(oldKey, newKey)
+	}
+
+	src, dst := sm.shards[from], sm.shards[to]
+	// Shards are always locked in index order
+	first, second := src, dst
+	if to < from {
+		first, second = dst, src
+	}
+	first.mutex.Lock()
+	defer first.mutex.Unlock()
+	second.mutex.Lock()
+	defer second.mutex.Unlock()
+
+	mapEl, expired := src.get(oldKey)
+	if mapEl == nil || expired {
+		return false
+	}
+	expiryTime := mapEl.heapEl.Priority
+	if expiryTime != neverExpires {
+		// The shards measure expiry times from their own creation
+		expiryTime += int64(src.base.Sub(dst.base))
+	}
+	if err := dst.set(newKey, mapEl.value, expiryTime); err != nil {
+		return false
+	}
+	src.moveOut(mapEl)
+	return true
+}
+
+// moveOut drops an element renamed to another shard, like Rename within a
+// map it neither counts as a deletion nor calls the removal callbacks, but
+// sends the DeleteEvent of its key
+func (m *TtlMap) moveOut(mapEl *mapElement) {
+	if m.events != nil {
+		m.sendEvent(Event{Type: DeleteEvent, Key: mapEl.key, OldValue: mapEl.value})
+	}
+	m.unlink(mapEl)
+	m.expiryTimes.RemoveEl(&mapEl.heapEl)
+	m.recycle(mapEl)
+}
+
+// Capacity returns the total capacity of all shards
+func (sm *ShardedMap) Capacity() int {
+	total := 0
+	for _, shard := range sm.shards {
+		total += shard.Capacity()
+	}
+	return total
+}
+
+// SetCapacity splits the new capacity evenly between the shards like
+// NewSharded, it stops at the first shard that fails
+func (sm *ShardedMap) SetCapacity(capacity int) error {
+	if capacity < len(sm.shards) {
+		return fmt.Errorf("Capacity should be >= number of shards %d, got %d", len(sm.shards), capacity)
+	}
+	for i, shard := range sm.shards {
+		if err := shard.SetCapacity(sm.shardCapacity(capacity, i)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Cost returns the total cost of the elements of all shards
+func (sm *ShardedMap) Cost() int64 {
+	total := int64(0)
+	for _, shard := range sm.shards {
+		total += shard.Cost()
+	}
+	return total
+}
+
+// Len returns the number of elements in all shards, the shards are counted
+// one after another, so the result is not a consistent snapshot
+func (sm *ShardedMap) Len() int {
+	total := 0
+	for _, shard := range sm.shards {
+		total += shard.Len()
+	}
+	return total
+}
+
+// LiveLen returns the number of live elements in all shards
+func (sm *ShardedMap) LiveLen() int {
+	total := 0
+	for _, shard := range sm.shards {
+		total += shard.LiveLen()
+	}
+	return total
+}
+
+// Keys returns the keys of the live elements of all shards
+func (sm *ShardedMap) Keys() []string {
+	var keys []string
+	for _, shard := range sm.shards {
+		keys = append(keys, shard.Keys()...)
+	}
+	return keys
+}
+
+// KeysInRange returns the keys of the live elements of all shards that are
+// >= from and < to in ascending order, an empty to means there is no upper
+// bound
+func (sm *ShardedMap) KeysInRange(from, to string) []string {
+	var keys []string
+	for _, shard := range sm.shards {
+		keys = append(keys, shard.KeysInRange(from, to)...)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Items returns the live elements of all shards
+func (sm *ShardedMap) Items() map[string]interface{} {
+	items := make(map[string]interface{})
+	for _, shard := range sm.shards {
+		for key, value := range shard.Items() {
+			items[key] = value
+		}
+	}
+	return items
+}
+
+// Values returns the values of the live elements of all shards
+func (sm *ShardedMap) Values() []interface{} {
+	var values []interface{}
+	for _, shard := range sm.shards {
+		values = append(values, shard.Values()...)
+	}
+	return values
+}
+
+// RandomKey returns the key of a randomly chosen live element of a randomly
+// chosen shard, the elements of sparse shards are more likely to be chosen
+func (sm *ShardedMap) RandomKey() (string, bool) {
+	start := rand.Intn(len(sm.shards))
+	for i := range sm.shards {
+		if key, ok := sm.shards[(start+i)%len(sm.shards)].RandomKey(); ok {
+			return key, true
+		}
+	}
+	return "", false
+}
+
+// RandomSample returns the keys of up to n randomly chosen live elements,
+// drawn from samples of every shard
+func (sm *ShardedMap) RandomSample(n int) []string {
+	var keys []string
+	for _, shard := range sm.shards {
+		keys = append(keys, shard.RandomSample(n)...)
+	}
+	rand.Shuffle(len(keys), func(i, j int) { keys[i], keys[j] = keys[j], keys[i] })
+	if len(keys) > n {
+		keys = keys[:n]
+	}
+	if keys == nil {
+		keys = []string{}
+	}
+	return keys
+}
+
+// TTLHistogram sums the histograms of all shards
+func (sm *ShardedMap) TTLHistogram(buckets []time.Duration) []int {
+	counts := make([]int, len(buckets)+1)
+	for _, shard := range sm.shards {
+		for i, count := range shard.TTLHistogram(buckets) {
+			counts[i] += count
+		}
+	}
+	return counts
+}
+
+// Oldest returns the live element that was inserted first in any shard
+func (sm *ShardedMap) Oldest() (key string, value interface{}, createdAt time.Time, ok bool) {
+	for _, shard := range sm.shards {
+		k, v, at, found := shard.Oldest()
+		if found && (!ok || at.Before(createdAt)) {
+			key, value, createdAt, ok = k, v, at, true
+		}
+	}
+	return key, value, createdAt, ok
+}
+
+// Newest returns the live element that was inserted last in any shard
+func (sm *ShardedMap) Newest() (key string, value interface{}, createdAt time.Time, ok bool) {
+	for _, shard := range sm.shards {
+		k, v, at, found := shard.Newest()
+		if found && (!ok || !at.Before(createdAt)) {
+			key, value, createdAt, ok = k, v, at, true
+		}
+	}
+	return key, value, createdAt, ok
+}
+
+// NextExpiry returns the element of all shards that expires first
+func (sm *ShardedMap) NextExpiry() (key string, value interface{}, at time.Time, ok bool) {
+	for _, shard := range sm.shards {
+		k, v, expiresAt, found := shard.NextExpiry()
+		if found && (!ok || expiresAt.Before(at)) {
+			key, value, at, ok = k, v, expiresAt, true
+		}
+	}
+	return key, value, at, ok
+}
+
+// rangeSorted collects the elements ranged over by each shard and calls fn
+// for them in key order
+func (sm *ShardedMap) rangeSorted(each func(shard *TtlMap, fn func(key string, value interface{}, expiresAt time.Time) bool), fn func(key string, value interface{}, expiresAt time.Time) bool) {
+	type item struct {
+		key       string
+		value     interface{}
+		expiresAt time.Time
+	}
+	var items []item
+	for _, shard := range sm.shards {
+		each(shard, func(key string, value interface{}, expiresAt time.Time) bool {
+			items = append(items, item{key, value, expiresAt})
+			return true
+		})
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].key < items[j].key })
+	for _, it := range items {
+		if !fn(it.key, it.value, it.expiresAt) {
+			return
+		}
+	}
+}
+
+// RangeOrdered calls fn for the live elements of all shards with keys >=
+// from and < to in ascending key order, an empty to means there is no upper
+// bound. The elements are collected before fn is called, shard by shard.
+func (sm *ShardedMap) RangeOrdered(from, to string, fn func(key string, value interface{}, expiresAt time.Time) bool) {
+	sm.rangeSorted(func(shard *TtlMap, collect func(key string, value interface{}, expiresAt time.Time) bool) {
+		shard.RangeOrdered(from, to, collect)
+	}, fn)
+}
+
+// RangePrefix calls fn for the live elements of all shards whose keys start
+// with prefix in ascending key order, like RangeOrdered
+func (sm *ShardedMap) RangePrefix(prefix string, fn func(key string, value interface{}, expiresAt time.Time) bool) {
+	sm.rangeSorted(func(shard *TtlMap, collect func(key string, value interface{}, expiresAt time.Time) bool) {
+		shard.RangePrefix(prefix, collect)
+	}, fn)
+}
+
+// Range calls fn for the live elements shard by shard, stopping early if fn
+// returns false. Each shard is locked only while it is ranged over.
+func (sm *ShardedMap) Range(fn func(key string, value interface{}, expiresAt time.Time) bool) {
+	stopped := false
+	for _, shard := range sm.shards {
+		shard.Range(func(key string, value interface{}, expiresAt time.Time) bool {
+			stopped = !fn(key, value, expiresAt)
+			return !stopped
+		})
+		if stopped {
+			return
+		}
+	}
+}
+
+// RemoveExpired removes up to max expired elements (all of them if max <= 0)
+// from the shards in turn
+func (sm *ShardedMap) RemoveExpired(max int) []ExpiredEntry {
+	var removed []ExpiredEntry
+	for _, shard := range sm.shards {
+		left := 0
+		if max > 0 {
+			left = max - len(removed)
+			if left <= 0 {
+				break
+			}
+		}
+		removed = append(removed, shard.RemoveExpired(left)...)
+	}
+	return removed
+}
+
+func (sm *ShardedMap) Clear() {
+	for _, shard := range sm.shards {
+		shard.Clear()
+	}
+}
+
+// FlushAt schedules the flush in every shard
+func (sm *ShardedMap) FlushAt(t time.Time) error {
+	for _, shard := range sm.shards {
+		if err := shard.FlushAt(t); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Restore restores the elements of the snapshot into their shards, it stops
+// at the first shard that fails
+func (sm *ShardedMap) Restore(snapshot *Snapshot) error {
+	byShard := make([]*Snapshot, len(sm.shards))
+	for key, entry := range snapshot.entries {
+		i := sm.shardIndexOf(key)
+		if byShard[i] == nil {
+			byShard[i] = &Snapshot{TakenAt: snapshot.TakenAt, entries: make(map[string]snapshotEntry)}
+		}
+		byShard[i].entries[key] = entry
+	}
+	for i, shardSnapshot := range byShard {
+		if shardSnapshot == nil {
+			continue
+		}
+		if err := sm.shards[i].Restore(shardSnapshot); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Dump writes the Dump of every shard to w
+func (sm *ShardedMap) Dump(w io.Writer) error {
+	for i, shard := range sm.shards {
+		if _, err := fmt.Fprintf(w, "shard %d:\n", i); err != nil {
+			return err
+		}
+		if err := shard.Dump(w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Events returns the channel merging the event channels of the shards, nil
+// if the EventChannel option was not used. Events of one shard arrive in
+// order, events of different shards may interleave in any order.
+func (sm *ShardedMap) Events() <-chan Event {
+	return sm.events
+}
+
+// DroppedEvents returns the number of events the shards could not deliver
+func (sm *ShardedMap) DroppedEvents() int {
+	total := 0
+	for _, shard := range sm.shards {
+		total += shard.DroppedEvents()
+	}
+	return total
+}
+
+// Evictions returns the channel merging the eviction channels of the
+// shards, nil if the EvictionChannel option was not used
+func (sm *ShardedMap) Evictions() <-chan EvictedEntry {
+	return sm.evictions
+}
+
+// DroppedEvictions returns the number of evictions the shards could not
+// deliver
+func (sm *ShardedMap) DroppedEvictions() int {
+	total := 0
+	for _, shard := range sm.shards {
+		total += shard.DroppedEvictions()
+	}
+	return total
+}
+
+// Snapshot copies the live elements of all shards, locking one shard at a
+// time, so it is not taken at a single point in time across shards
+func (sm *ShardedMap) Snapshot() *Snapshot {
+	snapshot := &Snapshot{entries: make(map[string]snapshotEntry)}
+	for i, shard := range sm.shards {
+		shardSnapshot := shard.Snapshot()
+		if i == 0 {
+			snapshot.TakenAt = shardSnapshot.TakenAt
+		}
+		for key, entry := range shardSnapshot.entries {
+			snapshot.entries[key] = entry
+		}
+	}
+	return snapshot
+}
+
+// Close closes all shards and stops merging their event and eviction
+// channels
+func (sm *ShardedMap) Close() {
+	sm.closeOnce.Do(func() {
+		if sm.stop != nil {
+			close(sm.stop)
+		}
+	})
+	for _, shard := range sm.shards {
+		if shard != nil {
+			shard.Close()
+		}
+	}
+}
+
+// StopReaper stops the reapers of all shards
+func (sm *ShardedMap) StopReaper() {
+	for _, shard := range sm.shards {
+		if shard != nil {
+			shard.StopReaper()
+		}
+	}
+}
+
+// StartReaper starts the reapers of all shards
+func (sm *ShardedMap) StartReaper(interval time.Duration) error {
+	for _, shard := range sm.shards {
+		if err := shard.StartReaper(interval); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WaitCallbacks waits for the queued callbacks of all shards
+func (sm *ShardedMap) WaitCallbacks() {
+	for _, shard := range sm.shards {
+		shard.WaitCallbacks()
+	}
+}
+
+// WaitCallbacksCtx is WaitCallbacks that gives up when ctx is done
+func (sm *ShardedMap) WaitCallbacksCtx(ctx context.Context) error {
+	for _, shard := range sm.shards {
+		if err := shard.WaitCallbacksCtx(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,256 @@
+package ttlmap
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+func (s *TestSuite) newShardedMap(capacity int, opts ...TtlMapOption) *ShardedMap {
+	opts = append(opts, Clock(s.timeProvider))
+	sm, err := NewSharded(capacity, opts...)
+	if err != nil {
+		panic(err)
+	}
+	return sm
+}
+
+func (s *TestSuite) TestShardedValidation(c *C) {
+	_, err := NewConcurrent(10, Shards(2))
+	c.Assert(err, Not(Equals), nil)
+
+	_, err = NewSharded(10, Shards(0))
+	c.Assert(err, Not(Equals), nil)
+
+	_, err = NewSharded(2, Shards(4))
+	c.Assert(err, Not(Equals), nil)
+
+	sm, err := NewSharded(16)
+	c.Assert(err, Equals, nil)
+	c.Assert(sm.shards, HasLen, 16)
+}
+
+func (s *TestSuite) TestSharded(c *C) {
+	sm := s.newShardedMap(10, Shards(3))
+	c.Assert(sm.Capacity(), Equals, 10)
+	c.Assert(sm.shards[0].Capacity(), Equals, 4)
+
+	for i := 0; i < 6; i += 1 {
+		c.Assert(sm.Set(fmt.Sprintf("k%d", i), i, 1+i%2), Equals, nil)
+	}
+	c.Assert(sm.Len(), Equals, 6)
+
+	valI, exists := sm.Get("k3")
+	c.Assert(exists, Equals, true)
+	c.Assert(valI, Equals, 3)
+
+	keys := sm.Keys()
+	sort.Strings(keys)
+	c.Assert(keys, DeepEquals, []string{"k0", "k1", "k2", "k3", "k4", "k5"})
+
+	s.advanceSeconds(1)
+	c.Assert(sm.LiveLen(), Equals, 3)
+	c.Assert(sm.RemoveExpired(2), HasLen, 2)
+	c.Assert(sm.RemoveExpired(0), HasLen, 1)
+	c.Assert(sm.Len(), Equals, 3)
+
+	count := 0
+	sm.Range(func(key string, value interface{}, _ time.Time) bool {
+		count += 1
+		return false
+	})
+	c.Assert(count, Equals, 1)
+
+	c.Assert(sm.Delete("k1"), Equals, true)
+	sm.Clear()
+	c.Assert(sm.Len(), Equals, 0)
+}
+
+func (s *TestSuite) TestShardedConcurrent(c *C) {
+	sm := s.newShardedMap(1000, Shards(8))
+
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g += 1 {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 100; i += 1 {
+				key := fmt.Sprintf("k%d", i)
+				sm.Increment(key, 1, 10)
+				sm.Get(key)
+			}
+		}(g)
+	}
+	wg.Wait()
+
+	c.Assert(sm.Len(), Equals, 100)
+	valI, _ := sm.Get("k42")
+	c.Assert(valI, Equals, 8)
+}
+
+// ShardedMap has every method of TtlMap with the same signature
+func (s *TestSuite) TestShardedMethodSet(c *C) {
+	sharded := reflect.TypeOf(&ShardedMap{})
+	single := reflect.TypeOf(&TtlMap{})
+	for i := 0; i < single.NumMethod(); i += 1 {
+		method := single.Method(i)
+		shardedMethod, ok := sharded.MethodByName(method.Name)
+		c.Assert(ok, Equals, true, Commentf("missing %s", method.Name))
+		want, got := method.Type, shardedMethod.Type
+		c.Assert(got.NumIn(), Equals, want.NumIn(), Commentf(method.Name))
+		for j := 1; j < want.NumIn(); j += 1 {
+			c.Assert(got.In(j), Equals, want.In(j), Commentf(method.Name))
+		}
+		c.Assert(got.NumOut(), Equals, want.NumOut(), Commentf(method.Name))
+		for j := 0; j < want.NumOut(); j += 1 {
+			c.Assert(got.Out(j), Equals, want.Out(j), Commentf(method.Name))
+		}
+	}
+}
+
+func (s *TestSuite) TestShardedMultiKey(c *C) {
+	sm := s.newShardedMap(64, Shards(4))
+	entries := map[string]interface{}{}
+	for i := 0; i < 20; i += 1 {
+		entries[fmt.Sprint("k", i)] = i
+	}
+	c.Assert(sm.SetMany(entries, 10), IsNil)
+	c.Assert(sm.Items(), DeepEquals, entries)
+	c.Assert(sm.Values(), HasLen, 20)
+	c.Assert(sm.GetMany([]string{"k1", "k7", "missing"}), DeepEquals, map[string]interface{}{"k1": 1, "k7": 7})
+	c.Assert(sm.RandomSample(5), HasLen, 5)
+	c.Assert(sm.TTLHistogram([]time.Duration{5 * time.Second, time.Minute}), DeepEquals, []int{0, 20, 0})
+
+	replaced, err := sm.Replace("k1", "one", 10)
+	c.Assert(err, IsNil)
+	c.Assert(replaced, Equals, true)
+	swapped, err := sm.CompareAndSwap("k1", "one", "uno", 10)
+	c.Assert(err, IsNil)
+	c.Assert(swapped, Equals, true)
+	actual, loaded, err := sm.GetOrSet("k1", "eins", 10)
+	c.Assert(err, IsNil)
+	c.Assert(loaded, Equals, true)
+	c.Assert(actual, Equals, "uno")
+
+	c.Assert(sm.SetWithExpireAt("at", 1, s.timeProvider.CurrentTime.Add(time.Second)), IsNil)
+	key, _, _, ok := sm.NextExpiry()
+	c.Assert(ok, Equals, true)
+	c.Assert(key, Equals, "at")
+
+	var ordered []string
+	sm.RangePrefix("k1", func(key string, value interface{}, expiresAt time.Time) bool {
+		ordered = append(ordered, key)
+		return true
+	})
+	c.Assert(ordered, DeepEquals, []string{"k1", "k10", "k11", "k12", "k13", "k14", "k15", "k16", "k17", "k18", "k19"})
+
+	c.Assert(sm.SetCapacity(2), NotNil)
+	c.Assert(sm.SetCapacity(40), IsNil)
+	c.Assert(sm.Capacity(), Equals, 40)
+}
+
+// keysOnShards returns two keys that belong to different shards
+func keysOnShards(sm *ShardedMap) (string, string) {
+	first := "a"
+	for i := 0; ; i += 1 {
+		key := fmt.Sprint("b", i)
+		if sm.shardIndexOf(key) != sm.shardIndexOf(first) {
+			return first, key
+		}
+	}
+}
+
+func (s *TestSuite) TestShardedRenameAcrossShards(c *C) {
+	sm := s.newShardedMap(16, Shards(4))
+	oldKey, newKey := keysOnShards(sm)
+
+	sm.SetWithDuration(oldKey, 1, 1500*time.Millisecond)
+	expiresAt, _ := sm.ExpiresAt(oldKey)
+	c.Assert(sm.Rename(oldKey, newKey), Equals, true)
+	c.Assert(sm.Contains(oldKey), Equals, false)
+	value, ok := sm.Get(newKey)
+	c.Assert(ok, Equals, true)
+	c.Assert(value, Equals, 1)
+	movedAt, _ := sm.ExpiresAt(newKey)
+	c.Assert(movedAt, Equals, expiresAt)
+	c.Assert(sm.Len(), Equals, 1)
+
+	sm.Set(oldKey, 2, NoExpiration)
+	c.Assert(sm.Rename(oldKey, newKey), Equals, true)
+	value, _ = sm.Get(newKey)
+	c.Assert(value, Equals, 2)
+	movedAt, ok = sm.ExpiresAt(newKey)
+	c.Assert(ok, Equals, true)
+	c.Assert(movedAt.IsZero(), Equals, true)
+	c.Assert(sm.Len(), Equals, 1)
+
+	c.Assert(sm.Rename("missing", newKey), Equals, false)
+}
+
+func (s *TestSuite) TestShardedRenameEvents(c *C) {
+	sm := s.newShardedMap(16, Shards(4), EventChannel(16))
+	defer sm.Close()
+	oldKey, newKey := keysOnShards(sm)
+
+	sm.Set(oldKey, 1, 10)
+	c.Assert(sm.Rename(oldKey, newKey), Equals, true)
+
+	var events []Event
+	deadline := time.After(time.Second)
+	for len(events) < 3 {
+		select {
+		case event := <-sm.Events():
+			event.At = time.Time{}
+			events = append(events, event)
+		case <-deadline:
+			c.Fatalf("Got %v", events)
+		}
+	}
+	// The events of different shards are merged in no particular order
+	sort.Slice(events, func(i, j int) bool {
+		if events[i].Key != events[j].Key {
+			return events[i].Key < events[j].Key
+		}
+		return events[i].Type < events[j].Type
+	})
+	c.Assert(events, DeepEquals, []Event{
+		{Type: SetEvent, Key: oldKey, NewValue: 1},
+		{Type: DeleteEvent, Key: oldKey, OldValue: 1},
+		{Type: SetEvent, Key: newKey, NewValue: 1},
+	})
+}
+
+func (s *TestSuite) TestShardedChannels(c *C) {
+	sm := s.newShardedMap(4, Shards(2), EventChannel(16), EvictionChannel(16))
+	defer sm.Close()
+
+	for i := 0; i < 6; i += 1 {
+		sm.Set(fmt.Sprint(i), i, 10)
+	}
+
+	var sets int
+	var evicted []string
+	deadline := time.After(time.Second)
+	for sets < 6 || len(evicted) < 2 {
+		select {
+		case event := <-sm.Events():
+			if event.Type == SetEvent {
+				sets += 1
+			}
+		case entry := <-sm.Evictions():
+			evicted = append(evicted, entry.Key)
+		case <-deadline:
+			c.Fatalf("Got %d sets and %d evictions", sets, len(evicted))
+		}
+	}
+	c.Assert(sm.DroppedEvents(), Equals, 0)
+	c.Assert(sm.DroppedEvictions(), Equals, 0)
+
+	plain := s.newShardedMap(4, Shards(2))
+	c.Assert(plain.Events(), IsNil)
+	c.Assert(plain.Evictions(), IsNil)
+}
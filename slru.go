@@ -0,0 +1,89 @@
+package ttlmap
+
+import (
+	"container/list"
+)
+
+// slruProtectedShare is the share of the capacity reserved for the
+// protected segment
+const slruProtectedShare = 0.8
+
+// slru implements the segmented lru policy: new elements enter probation
+// and are promoted to protected when accessed again. Elements demoted from
+// a full protected segment get another chance in probation, victims are
+// taken from probation first.
+type slru struct {
+	capacity  *int
+	probation *list.List
+	protected *list.List
+}
+
+type slruEntry struct {
+	mapEl     *mapElement
+	protected bool
+}
+
+func newSLRU(capacity *int) *slru {
+	return &slru{
+		capacity:  capacity,
+		probation: list.New(),
+		protected: list.New(),
+	}
+}
+
+func (s *slru) add(mapEl *mapElement) {
+	mapEl.evictEl = s.probation.PushFront(&slruEntry{mapEl: mapEl})
+}
+
+func (s *slru) access(mapEl *mapElement) {
+	entry := mapEl.evictEl.Value.(*slruEntry)
+	if entry.protected {
+		s.protected.MoveToFront(mapEl.evictEl)
+		return
+	}
+	s.probation.Remove(mapEl.evictEl)
+	entry.protected = true
+	mapEl.evictEl = s.protected.PushFront(entry)
+
+	maxProtected := int(slruProtectedShare * float64(*s.capacity))
+	if maxProtected < 1 {
+		maxProtected = 1
+	}
+	for s.protected.Len() > maxProtected {
+		demoted := s.protected.Remove(s.protected.Back()).(*slruEntry)
+		demoted.protected = false
+		demoted.mapEl.evictEl = s.probation.PushFront(demoted)
+	}
+}
+
+func (s *slru) remove(mapEl *mapElement) {
+	if mapEl.evictEl.Value.(*slruEntry).protected {
+		s.protected.Remove(mapEl.evictEl)
+	} else {
+		s.probation.Remove(mapEl.evictEl)
+	}
+	mapEl.evictEl = nil
+}
+
+func (s *slru) victim() *mapElement {
+	e := s.probation.Back()
+	if e == nil {
+		e = s.protected.Back()
+	}
+	if e == nil {
+		return nil
+	}
+	return e.Value.(*slruEntry).mapEl
+}
+
+func (s *slru) evicting(mapEl *mapElement) {
+}
+
+func (s *slru) clear() {
+	s.probation.Init()
+	s.protected.Init()
+}
+
+func (s *slru) tracksAccess() bool {
+	return true
+}
@@ -0,0 +1,50 @@
+package ttlmap
+
+import (
+	"fmt"
+
+	. "gopkg.in/check.v1"
+)
+
+func (s *TestSuite) TestEvictSLRU(c *C) {
+	m := s.newMap(5, Eviction(EvictSLRU))
+	l := m.evictor.(*slru)
+
+	for _, key := range []string{"a", "b", "c"} {
+		m.Set(key, key, 10)
+		m.Get(key)
+	}
+	c.Assert(l.protected.Len(), Equals, 3)
+
+	// A flood of new keys churns through probation only
+	for i := 0; i < 10; i += 1 {
+		m.Set(fmt.Sprintf("x%d", i), i, 10)
+	}
+	c.Assert(m.Contains("a"), Equals, true)
+	c.Assert(m.Contains("b"), Equals, true)
+	c.Assert(m.Contains("c"), Equals, true)
+	c.Assert(m.Contains("x9"), Equals, true)
+	c.Assert(m.Len(), Equals, 5)
+}
+
+func (s *TestSuite) TestEvictSLRUDemotion(c *C) {
+	m := s.newMap(5, Eviction(EvictSLRU))
+	l := m.evictor.(*slru)
+
+	for _, key := range []string{"a", "b", "c", "d", "e"} {
+		m.Set(key, key, 10)
+		m.Get(key)
+	}
+	// The protected segment holds 4 elements, a was demoted
+	c.Assert(l.protected.Len(), Equals, 4)
+	c.Assert(l.victim().key, Equals, "a")
+
+	m.Set("f", "f", 10)
+	c.Assert(m.Contains("a"), Equals, false)
+
+	m.Delete("b")
+	c.Assert(l.protected.Len()+l.probation.Len(), Equals, m.Len())
+
+	m.Clear()
+	c.Assert(l.protected.Len()+l.probation.Len(), Equals, 0)
+}
@@ -0,0 +1,121 @@
+package ttlmap
+
+import (
+	"reflect"
+	"sort"
+	"time"
+)
+
+// Snapshot is an immutable copy of the live elements of a map at one point
+// in time. It can be iterated, looked up and compared with another snapshot
+// without holding the map lock, the values themselves are shared with the
+// map though, so values modified in place show up in the snapshot as well.
+type Snapshot struct {
+	// TakenAt is the time the snapshot was taken at
+	TakenAt time.Time
+	entries map[string]snapshotEntry
+}
+
+type snapshotEntry struct {
+	value     interface{}
+	expiresAt time.Time
+}
+
+// Snapshot copies the live elements of the map. The map is only locked for
+// the copy, so writers are not held up by whatever the caller does with the
+// snapshot.
+func (m *TtlMap) Snapshot() *Snapshot {
+	if m.mutex != nil {
+		m.mutex.RLock()
+		defer m.mutex.RUnlock()
+	}
+
+	snapshot := &Snapshot{
+		TakenAt: m.currentTime().UTC(),
+		entries: make(map[string]snapshotEntry, len(m.elements)),
+	}
+	now := m.now()
+	for key, mapEl := range m.elements {
+		if mapEl.heapEl.Priority <= now {
+			continue
+		}
+		snapshot.entries[key] = snapshotEntry{
+			value:     mapEl.value,
+			expiresAt: m.fromExpiryTime(mapEl.heapEl.Priority),
+		}
+	}
+	return snapshot
+}
+
+// Len returns the number of elements in the snapshot
+func (s *Snapshot) Len() int {
+	return len(s.entries)
+}
+
+// Get returns the value of the element with the given key and its expiry
+// time, the zero time if it never expires. Elements are returned even if
+// they expired since the snapshot was taken.
+func (s *Snapshot) Get(key string) (value interface{}, expiresAt time.Time, ok bool) {
+	entry, ok := s.entries[key]
+	return entry.value, entry.expiresAt, ok
+}
+
+// Keys returns the keys of the elements in the snapshot in ascending order
+func (s *Snapshot) Keys() []string {
+	keys := make([]string, 0, len(s.entries))
+	for key := range s.entries {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Range calls fn for every element in the snapshot in no particular order,
+// stopping early if fn returns false
+func (s *Snapshot) Range(fn func(key string, value interface{}, expiresAt time.Time) bool) {
+	for key, entry := range s.entries {
+		if !fn(key, entry.value, entry.expiresAt) {
+			return
+		}
+	}
+}
+
+// Diff compares the snapshot with an older one and returns, in ascending
+// order, the keys only present in this snapshot, the keys present in both
+// with different values and the keys only present in the older one. Changed
+// expiry times alone do not count as changes.
+func (s *Snapshot) Diff(older *Snapshot) (added, changed, removed []string) {
+	for key, entry := range s.entries {
+		old, ok := older.entries[key]
+		switch {
+		case !ok:
+			added = append(added, key)
+		case !valuesEqual(old.value, entry.value):
+			changed = append(changed, key)
+		}
+	}
+	for key := range older.entries {
+		if _, ok := s.entries[key]; !ok {
+			removed = append(removed, key)
+		}
+	}
+	sort.Strings(added)
+	sort.Strings(changed)
+	sort.Strings(removed)
+	return added, changed, removed
+}
+
+// valuesEqual compares comparable values with == and falls back to deep
+// equality for the others, such as slices, where == would panic
+func valuesEqual(a, b interface{}) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	if reflect.TypeOf(a) != reflect.TypeOf(b) {
+		return false
+	}
+	if reflect.TypeOf(a).Comparable() {
+		return a == b
+	}
+	return reflect.DeepEqual(a, b)
+}
@@ -0,0 +1,62 @@
+package ttlmap
+
+import (
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+func (s *TestSuite) TestSnapshot(c *C) {
+	m := s.newMap(10)
+	start := s.timeProvider.UtcNow()
+
+	m.Set("a", 1, 1)
+	m.Set("b", []byte("b"), 5)
+	m.Set("c", 3, 5)
+	m.Persist("c")
+	m.Set("d", 4, 5)
+	s.advanceSeconds(1)
+
+	snapshot := m.Snapshot()
+	c.Assert(snapshot.TakenAt, Equals, start.Add(time.Second))
+	c.Assert(snapshot.Len(), Equals, 3)
+	c.Assert(snapshot.Keys(), DeepEquals, []string{"b", "c", "d"})
+
+	value, expiresAt, ok := snapshot.Get("b")
+	c.Assert(ok, Equals, true)
+	c.Assert(value, DeepEquals, []byte("b"))
+	c.Assert(expiresAt, Equals, start.Add(5*time.Second))
+	_, expiresAt, _ = snapshot.Get("c")
+	c.Assert(expiresAt.IsZero(), Equals, true)
+	_, _, ok = snapshot.Get("a")
+	c.Assert(ok, Equals, false)
+
+	// The snapshot does not follow the map
+	m.Set("b", []byte("B"), 5)
+	m.Set("c", 3, 10)
+	m.Delete("d")
+	m.Set("e", 5, 5)
+	value, _, _ = snapshot.Get("b")
+	c.Assert(value, DeepEquals, []byte("b"))
+	c.Assert(snapshot.Len(), Equals, 3)
+
+	count := 0
+	snapshot.Range(func(key string, value interface{}, expiresAt time.Time) bool {
+		count += 1
+		return false
+	})
+	c.Assert(count, Equals, 1)
+
+	added, changed, removed := m.Snapshot().Diff(snapshot)
+	c.Assert(added, DeepEquals, []string{"e"})
+	c.Assert(changed, DeepEquals, []string{"b"})
+	c.Assert(removed, DeepEquals, []string{"d"})
+}
+
+func (s *TestSuite) TestShardedSnapshot(c *C) {
+	sm := s.newShardedMap(100, Shards(4))
+	for _, key := range []string{"a", "b", "c", "d", "e"} {
+		sm.Set(key, key, 10)
+	}
+	c.Assert(sm.Snapshot().Keys(), DeepEquals, []string{"a", "b", "c", "d", "e"})
+}
@@ -0,0 +1,117 @@
+package ttlmap
+
+import (
+	"sync/atomic"
+)
+
+// Stats are counters of what happened to a map since it was created
+type Stats struct {
+	// Hits and Misses count the lookups of Get, GetWithTTL, GetMany and the
+	// methods built on them that found a live element or did not
+	Hits   uint64
+	Misses uint64
+	// Sets counts the values written
+	Sets uint64
+	// Deletes, Expirations and CapacityEvictions count the elements removed
+	// for each reason, see RemovalReason
+	Deletes           uint64
+	Expirations       uint64
+	CapacityEvictions uint64
+	// Len is the current number of elements, see Len
+	Len int
+	// Windows are the lookups over the windows set with HitRatioWindows
+	Windows []WindowStats
+	// Latencies are the durations of operations, nil unless the map was
+	// created with RecordLatencies
+	Latencies *Latencies
+}
+
+// counters are the Stats of a map. Lookups may run concurrently, even
+// without the lock, so they are counted atomically, the other counters are
+// only updated with the map locked for writing.
+type counters struct {
+	hits     uint64
+	misses   uint64
+	removals [Replaced + 1]uint64
+}
+
+// Stats returns the counters of the map
+func (m *TtlMap) Stats() Stats {
+	if m.mutex != nil {
+		m.mutex.RLock()
+		defer m.mutex.RUnlock()
+	}
+
+	stats := Stats{
+		Hits:              atomic.LoadUint64(&m.counters.hits),
+		Misses:            atomic.LoadUint64(&m.counters.misses),
+		Sets:              m.writes,
+		Deletes:           m.counters.removals[Deleted],
+		Expirations:       m.counters.removals[Expired],
+		CapacityEvictions: m.counters.removals[EvictedCapacity],
+		Len:               len(m.elements),
+	}
+	if m.hitWindows != nil {
+		stats.Windows = m.hitWindows.stats(m.now())
+	}
+	if m.latencies != nil {
+		stats.Latencies = m.latencies.snapshot()
+	}
+	return stats
+}
+
+// Stats returns the sums of the counters of all shards
+func (sm *ShardedMap) Stats() Stats {
+	var total Stats
+	for _, shard := range sm.shards {
+		stats := shard.Stats()
+		total.Hits += stats.Hits
+		total.Misses += stats.Misses
+		total.Sets += stats.Sets
+		total.Deletes += stats.Deletes
+		total.Expirations += stats.Expirations
+		total.CapacityEvictions += stats.CapacityEvictions
+		total.Len += stats.Len
+		if total.Windows == nil && stats.Windows != nil {
+			total.Windows = make([]WindowStats, len(stats.Windows))
+		}
+		for i, window := range stats.Windows {
+			total.Windows[i].Window = window.Window
+			total.Windows[i].Hits += window.Hits
+			total.Windows[i].Misses += window.Misses
+		}
+		if stats.Latencies != nil {
+			if total.Latencies == nil {
+				total.Latencies = &Latencies{}
+			}
+			total.Latencies.Get.merge(stats.Latencies.Get)
+			total.Latencies.Set.merge(stats.Latencies.Set)
+			total.Latencies.Sweep.merge(stats.Latencies.Sweep)
+		}
+	}
+	for i := range total.Windows {
+		total.Windows[i].HitRatio = hitRatio(total.Windows[i].Hits, total.Windows[i].Misses)
+	}
+	return total
+}
+
+// lookedUp counts a lookup
+func (m *TtlMap) lookedUp(hit bool) {
+	if hit {
+		m.lookedUpMany(1, 0)
+	} else {
+		m.lookedUpMany(0, 1)
+	}
+}
+
+func (m *TtlMap) lookedUpMany(hits, misses uint64) {
+	if hits > 0 {
+		atomic.AddUint64(&m.counters.hits, hits)
+	}
+	if misses > 0 {
+		atomic.AddUint64(&m.counters.misses, misses)
+	}
+	if m.hitWindows != nil {
+		m.hitWindows.record(m.now(), hits, misses)
+	}
+}
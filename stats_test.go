@@ -0,0 +1,45 @@
+package ttlmap
+
+import (
+	. "gopkg.in/check.v1"
+)
+
+func (s *TestSuite) TestStats(c *C) {
+	m := s.newMap(2)
+
+	m.Set("a", 1, 1)
+	m.Set("a", 2, 1)
+	m.Set("b", 1, 5)
+	m.Get("a")
+	m.Get("missing")
+	m.GetWithTTL("b")
+	m.GetMany([]string{"a", "b", "c"})
+	m.GetByBytes([]byte("a"))
+	c.Assert(m.Stats(), DeepEquals, Stats{Hits: 5, Misses: 2, Sets: 3, Len: 2})
+
+	// Capacity evictions, expirations and deletes are counted even though
+	// they happen inside the map
+	s.advanceSeconds(1)
+	m.Get("a")
+	m.Set("c", 1, 10)
+	m.Set("d", 1, 10)
+	m.Delete("c")
+	m.Clear()
+	c.Assert(m.Stats(), DeepEquals, Stats{
+		Hits:              5,
+		Misses:            3,
+		Sets:              5,
+		Deletes:           2,
+		Expirations:       1,
+		CapacityEvictions: 1,
+	})
+}
+
+func (s *TestSuite) TestShardedStats(c *C) {
+	sm := s.newShardedMap(16, Shards(4))
+	sm.Set("a", 1, 10)
+	sm.Set("b", 1, 10)
+	sm.Get("a")
+	sm.Get("c")
+	c.Assert(sm.Stats(), DeepEquals, Stats{Hits: 1, Misses: 1, Sets: 2, Len: 2})
+}
@@ -0,0 +1,74 @@
+package ttlmap
+
+import (
+	"fmt"
+	"sync"
+)
+
+// UpdateStripes makes Update call its function holding one of n stripe
+// locks picked by key hash instead of the map lock. Updates of keys on
+// different stripes run their functions in parallel, and the functions may
+// access the map. The map lock is only held to read the current value and to
+// write the new one: if another write changed the element in between, the
+// function is called again with the new value, so Update stays atomic.
+//
+// Only Update is striped. Get, Set, Delete and every other operation still
+// take the map lock, because all keys share one index and one expiry heap.
+// Use NewSharded to spread all operations over independent locks. The map has
+// to be created with NewConcurrent.
+func UpdateStripes(n int) TtlMapOption {
+	return func(m *TtlMap) error {
+		if n <= 0 {
+			return fmt.Errorf("Update stripes should be > 0, got %d", n)
+		}
+		m.stripes = make([]sync.Mutex, n)
+		return nil
+	}
+}
+
+func (m *TtlMap) stripe(key string) *sync.Mutex {
+	return &m.stripes[hashKey(key)%uint32(len(m.stripes))]
+}
+
+func (m *TtlMap) updateStriped(key string, expiryTime int64, fn func(current interface{}, exists bool) (interface{}, error)) error {
+	stripe := m.stripe(key)
+	stripe.Lock()
+	defer stripe.Unlock()
+
+	for {
+		current, version, exists := m.lockNVersion(key)
+		value, err := fn(current, exists)
+		if err != nil {
+			return err
+		}
+		if done, err := m.lockNSetVersion(key, value, expiryTime, version, exists); done {
+			return err
+		}
+	}
+}
+
+// lockNVersion returns the value and the version of the live element with
+// the given key
+func (m *TtlMap) lockNVersion(key string) (value interface{}, version uint64, exists bool) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	mapEl, expired := m.get(key)
+	if mapEl == nil || expired {
+		return nil, 0, false
+	}
+	return mapEl.value, mapEl.version, true
+}
+
+// lockNSetVersion sets the value unless the element changed since its
+// version was read, done is false if it did
+func (m *TtlMap) lockNSetVersion(key string, value interface{}, expiryTime int64, version uint64, exists bool) (done bool, err error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	mapEl, expired := m.get(key)
+	if exists != (mapEl != nil && !expired) || (exists && mapEl.version != version) {
+		return false, nil
+	}
+	return true, m.set(key, value, expiryTime)
+}
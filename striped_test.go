@@ -0,0 +1,97 @@
+package ttlmap
+
+import (
+	"sync"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+func (s *TestSuite) TestUpdateStripesValidation(c *C) {
+	_, err := NewConcurrent(1, UpdateStripes(0))
+	c.Assert(err, Not(Equals), nil)
+
+	_, err = NewMap(1, UpdateStripes(4))
+	c.Assert(err, Not(Equals), nil)
+}
+
+func (s *TestSuite) TestUpdateStripesUpdate(c *C) {
+	m := s.newMap(10, UpdateStripes(4))
+
+	err := m.Update("a", 10, func(current interface{}, exists bool) (interface{}, error) {
+		c.Assert(exists, Equals, false)
+		// The function runs without the map lock
+		c.Assert(m.Len(), Equals, 0)
+		return 1, nil
+	})
+	c.Assert(err, IsNil)
+
+	// A write racing with the function makes it run again
+	calls := 0
+	err = m.Update("a", 10, func(current interface{}, exists bool) (interface{}, error) {
+		calls += 1
+		if calls == 1 {
+			c.Assert(current, Equals, 1)
+			m.Set("a", 5, 10)
+		} else {
+			c.Assert(current, Equals, 5)
+		}
+		return current.(int) + 1, nil
+	})
+	c.Assert(err, IsNil)
+	c.Assert(calls, Equals, 2)
+	value, _ := m.Get("a")
+	c.Assert(value, Equals, 6)
+
+	// So does a removal
+	calls = 0
+	err = m.Update("a", 10, func(current interface{}, exists bool) (interface{}, error) {
+		calls += 1
+		if calls == 1 {
+			m.Delete("a")
+		} else {
+			c.Assert(exists, Equals, false)
+		}
+		return calls, nil
+	})
+	c.Assert(err, IsNil)
+	value, _ = m.Get("a")
+	c.Assert(value, Equals, 2)
+}
+
+func (s *TestSuite) TestUpdateStripesParallel(c *C) {
+	m := s.newMap(10, UpdateStripes(16))
+
+	// Find two keys on different stripes
+	keys := []string{"a"}
+	for _, key := range []string{"b", "c", "d", "e", "f"} {
+		if m.stripe(key) != m.stripe("a") {
+			keys = append(keys, key)
+			break
+		}
+	}
+	c.Assert(keys, HasLen, 2)
+
+	// Both functions have to run at the same time to return
+	var running sync.WaitGroup
+	running.Add(2)
+	done := make(chan error, 2)
+	for _, key := range keys {
+		go func(key string) {
+			done <- m.Update(key, 10, func(current interface{}, exists bool) (interface{}, error) {
+				running.Done()
+				running.Wait()
+				return key, nil
+			})
+		}(key)
+	}
+	for range keys {
+		select {
+		case err := <-done:
+			c.Assert(err, IsNil)
+		case <-time.After(5 * time.Second):
+			c.Fatal("updates of different stripes did not run in parallel")
+		}
+	}
+	c.Assert(m.Len(), Equals, 2)
+}
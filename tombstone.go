@@ -0,0 +1,121 @@
+package ttlmap
+
+// LazyDeletion makes removing an element from the expiry heap O(1): instead
+// of sifting it out of the heap right away the element is marked dead and
+// discarded once it surfaces at the top. When dead elements outnumber the
+// live ones the heap is rebuilt without them, which bounds the memory they
+// hold on to. It has no effect on maps using the TimingWheel, which removes
+// elements in O(1) anyway.
+func LazyDeletion() TtlMapOption {
+	return func(m *TtlMap) error {
+		m.lazyDeletion = true
+		return nil
+	}
+}
+
+// minCompaction is the heap size below which dead elements are not worth a
+// rebuild
+const minCompaction = 64
+
+// tombstoneHeap is an expiry heap that leaves removed elements in place. The
+// dead elements are not recycled until they leave the heap, discard recycles
+// them.
+type tombstoneHeap struct {
+	*heapIndex
+	dead    int
+	discard func(mapEl *mapElement)
+}
+
+func newTombstoneHeap(heap *heapIndex, discard func(mapEl *mapElement)) *tombstoneHeap {
+	return &tombstoneHeap{heapIndex: heap, discard: discard}
+}
+
+func (t *tombstoneHeap) Len() int {
+	return t.heapIndex.Len() - t.dead
+}
+
+func (t *tombstoneHeap) PopEl() *heapElement {
+	t.dropDead()
+	return t.heapIndex.PopEl()
+}
+
+func (t *tombstoneHeap) PeekEl() *heapElement {
+	t.dropDead()
+	return t.heapIndex.PeekEl()
+}
+
+func (t *tombstoneHeap) RemoveEl(el *heapElement) {
+	// Reaping removes from the top, where popping is cheap
+	if t.heapIndex.PeekEl() == el {
+		t.heapIndex.PopEl()
+		t.dropDead()
+		return
+	}
+	el.Value.(*mapElement).dead = true
+	t.dead += 1
+	if t.dead*2 > t.heapIndex.Len() && t.heapIndex.Len() >= minCompaction {
+		t.compact(el)
+	}
+}
+
+func (t *tombstoneHeap) ForEach(fn func(el *heapElement) bool) {
+	t.heapIndex.ForEach(func(el *heapElement) bool {
+		if el.Value.(*mapElement).dead {
+			return true
+		}
+		return fn(el)
+	})
+}
+
+// CountExpired walks the expired part of the heap like heapIndex does,
+// skipping the dead elements
+func (t *tombstoneHeap) CountExpired(now int64) int {
+	heap := *t.minHeap
+	count := 0
+	stack := []int{0}
+	for len(stack) > 0 {
+		i := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if i >= len(heap) || heap[i].Priority > now {
+			continue
+		}
+		if !heap[i].Value.(*mapElement).dead {
+			count += 1
+		}
+		stack = append(stack, 2*i+1, 2*i+2)
+	}
+	return count
+}
+
+// dropDead discards the dead elements at the top of the heap
+func (t *tombstoneHeap) dropDead() {
+	for t.dead > 0 && t.heapIndex.Len() > 0 {
+		mapEl := t.heapIndex.PeekEl().Value.(*mapElement)
+		if !mapEl.dead {
+			return
+		}
+		t.heapIndex.PopEl()
+		t.dead -= 1
+		mapEl.dead = false
+		t.discard(mapEl)
+	}
+}
+
+// compact rebuilds the heap from the live elements. removed is the element
+// being removed, its caller recycles it.
+func (t *tombstoneHeap) compact(removed *heapElement) {
+	live := newHeapIndex(t.heapIndex.Len() - t.dead)
+	for _, el := range *t.minHeap {
+		mapEl := el.Value.(*mapElement)
+		if mapEl.dead {
+			mapEl.dead = false
+			if el != removed {
+				t.discard(mapEl)
+			}
+			continue
+		}
+		live.PushEl(el)
+	}
+	t.heapIndex = live
+	t.dead = 0
+}
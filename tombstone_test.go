@@ -0,0 +1,88 @@
+package ttlmap
+
+import (
+	"fmt"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+func (s *TestSuite) TestLazyDeletion(c *C) {
+	m := s.newMap(10, LazyDeletion())
+	t := m.expiryTimes.(*tombstoneHeap)
+
+	m.Set("a", 1, 1)
+	m.Set("b", 2, 2)
+	m.Set("c", 3, 3)
+	m.Set("d", 4, 4)
+	b := m.elements["b"]
+	m.Delete("b")
+	m.Delete("c")
+
+	// Deleted elements stay in the heap without being recycled
+	c.Assert(t.dead, Equals, 2)
+	c.Assert(t.heapIndex.Len(), Equals, 4)
+	c.Assert(b.key, Equals, "b")
+	c.Assert(m.expiryTimes.Len(), Equals, 2)
+	c.Assert(m.expiryTimes.CountExpired(m.now()+int64(5*time.Second)), Equals, 2)
+	keys := map[string]bool{}
+	m.expiryTimes.ForEach(func(el *heapElement) bool {
+		keys[el.Value.(*mapElement).key] = true
+		return true
+	})
+	c.Assert(keys, DeepEquals, map[string]bool{"a": true, "d": true})
+
+	// Removing the top pops it along with the dead elements below
+	m.Delete("a")
+	c.Assert(t.dead, Equals, 0)
+	c.Assert(t.heapIndex.Len(), Equals, 1)
+	c.Assert(b.key, Equals, "")
+
+	m.Set("e", 5, 10)
+	m.Delete("e")
+	key, _, _, ok := m.NextExpiry()
+	c.Assert(ok, Equals, true)
+	c.Assert(key, Equals, "d")
+
+	s.advanceSeconds(4)
+	expired := m.RemoveExpired(0)
+	c.Assert(expired, HasLen, 1)
+	c.Assert(t.heapIndex.Len(), Equals, 0)
+	c.Assert(t.dead, Equals, 0)
+}
+
+func (s *TestSuite) TestLazyDeletionCompaction(c *C) {
+	m := s.newMap(100, LazyDeletion())
+
+	for i := 0; i < 100; i += 1 {
+		m.Set(fmt.Sprintf("k%d", i), i, 100-i)
+	}
+	for i := 0; i < 50; i += 1 {
+		m.Delete(fmt.Sprintf("k%d", i))
+	}
+	t := m.expiryTimes.(*tombstoneHeap)
+	c.Assert(t.dead, Equals, 50)
+
+	// Once the dead outnumber the live the heap is rebuilt
+	m.Delete("k50")
+	c.Assert(t.dead, Equals, 0)
+	c.Assert(t.heapIndex.Len(), Equals, 49)
+
+	// Each removed element is recycled once, so new ones are distinct
+	other := s.newMap(100)
+	for i := 0; i < 100; i += 1 {
+		other.Set(fmt.Sprintf("k%d", i), i, 1)
+	}
+	distinct := make(map[*mapElement]bool)
+	for _, mapEl := range other.elements {
+		distinct[mapEl] = true
+	}
+	c.Assert(distinct, HasLen, 100)
+
+	// Expiry order is intact
+	s.advanceSeconds(100)
+	expired := m.RemoveExpired(0)
+	c.Assert(expired, HasLen, 49)
+	c.Assert(expired[0].Key, Equals, "k99")
+	c.Assert(expired[48].Key, Equals, "k51")
+}
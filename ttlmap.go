@@ -1,17 +1,32 @@
 package ttlmap
 
 import (
+	"container/list"
 	"errors"
 	"fmt"
+	"math"
+	"math/rand"
+	"reflect"
+	"sort"
 	"sync"
 	"time"
 
-	"github.com/mailgun/minheap"
 	"github.com/mailgun/timetools"
 )
 
 type TtlMapOption func(m *TtlMap) error
 
+// NoExpiration can be passed as a ttl (in seconds or as a time.Duration) to
+// store an element that never expires, it is still subject to capacity
+// eviction. If MaxTTL is configured the element expires after MaxTTL instead.
+// Any other ttl <= 0 is still rejected, so a miscalculated ttl can not pin an
+// element forever by accident.
+const NoExpiration = math.MinInt32
+
+// neverExpires is the expiry time of persisted elements, it sorts them after
+// all other elements in the expiry heap so they are evicted last
+const neverExpires = int64(math.MaxInt64)
+
 // Clock sets the time provider clock, handy for testing
 func Clock(c timetools.TimeProvider) TtlMapOption {
 	return func(m *TtlMap) error {
@@ -20,105 +35,1436 @@ func Clock(c timetools.TimeProvider) TtlMapOption {
 	}
 }
 
-type Callback func(key string, el interface{})
+type Callback func(key string, el interface{})
+
+// CallOnExpire will call this callback on expiration of elements
+func CallOnExpire(cb Callback) TtlMapOption {
+	return func(m *TtlMap) error {
+		m.onExpire = cb
+		return nil
+	}
+}
+
+// DefaultTTL sets the ttl used by SetDefault
+func DefaultTTL(ttl time.Duration) TtlMapOption {
+	return func(m *TtlMap) error {
+		if ttl <= 0 {
+			return fmt.Errorf("Default ttl should be > 0, got %v", ttl)
+		}
+		m.defaultTTL = ttl
+		return nil
+	}
+}
+
+// SlidingExpiration makes every successful Get re-arm the ttl of the element
+// to the duration it was last set with
+func SlidingExpiration() TtlMapOption {
+	return func(m *TtlMap) error {
+		m.sliding = true
+		return nil
+	}
+}
+
+// MinTTL sets the lower bound all ttls passed to the map are clamped to
+func MinTTL(ttl time.Duration) TtlMapOption {
+	return func(m *TtlMap) error {
+		if ttl <= 0 {
+			return fmt.Errorf("Min ttl should be > 0, got %v", ttl)
+		}
+		m.minTTL = ttl
+		return nil
+	}
+}
+
+// MaxTTL sets the upper bound all ttls passed to the map are clamped to
+func MaxTTL(ttl time.Duration) TtlMapOption {
+	return func(m *TtlMap) error {
+		if ttl <= 0 {
+			return fmt.Errorf("Max ttl should be > 0, got %v", ttl)
+		}
+		m.maxTTL = ttl
+		return nil
+	}
+}
+
+// TTLJitter randomizes every relative ttl passed to the map by up to
+// +/- fraction of its value, so elements set together do not expire together
+func TTLJitter(fraction float64) TtlMapOption {
+	return func(m *TtlMap) error {
+		if fraction < 0 || fraction >= 1 {
+			return fmt.Errorf("Jitter fraction should be in [0, 1), got %v", fraction)
+		}
+		m.jitter = fraction
+		return nil
+	}
+}
+
+// PurgeOnWrite makes every write remove up to count expired elements, calling
+// the expiration callback for them. This amortizes the cleanup over the
+// writes and bounds the number of expired elements the map holds when writes
+// outpace expirations.
+func PurgeOnWrite(count int) TtlMapOption {
+	return func(m *TtlMap) error {
+		if count <= 0 {
+			return fmt.Errorf("Purge count should be > 0, got %d", count)
+		}
+		m.purgeOnWrite = count
+		return nil
+	}
+}
+
+// StaleGracePeriod keeps expired elements around for the given period so
+// they can still be read with GetStale, e.g. while a refresh is in flight.
+// Get never returns expired elements. The expiration callback fires when the
+// element is removed after the grace period.
+func StaleGracePeriod(grace time.Duration) TtlMapOption {
+	return func(m *TtlMap) error {
+		if grace <= 0 {
+			return fmt.Errorf("Stale grace period should be > 0, got %v", grace)
+		}
+		m.staleGrace = int64(grace)
+		return nil
+	}
+}
+
+// ExpiryGranularity rounds expiry times up to a multiple of granularity
+// (measured from the creation of the map). Elements set or touched
+// repeatedly within the same granularity window keep their place in the
+// expiry heap instead of being rescheduled every time, at the cost of living
+// up to granularity longer than requested.
+func ExpiryGranularity(granularity time.Duration) TtlMapOption {
+	return func(m *TtlMap) error {
+		if granularity <= 0 {
+			return fmt.Errorf("Expiry granularity should be > 0, got %v", granularity)
+		}
+		m.granularity = int64(granularity)
+		return nil
+	}
+}
+
+// Sparse disables allocating the element index and the expiry heap for the
+// full capacity up front. By default a map is sized so that filling it up
+// does not go through repeated growth (for up to a million elements), a
+// sparse map instead grows with the number of elements, which suits maps
+// that rarely get close to capacity.
+func Sparse() TtlMapOption {
+	return func(m *TtlMap) error {
+		m.sparse = true
+		return nil
+	}
+}
+
+type TtlMap struct {
+	capacity    int
+	elements    map[string]*mapElement
+	expiryTimes expiryIndex
+	clock       timetools.TimeProvider
+	mutex       locker
+	lockingMode LockingMode
+	// onExpire callback will be called when element is expired
+	onExpire Callback
+	// onRemove callback will be called whenever an element is removed
+	onRemove RemovalCallback
+	// insertions keeps elements in the order they were inserted
+	insertions *list.List
+	defaultTTL time.Duration
+	sliding    bool
+	minTTL     time.Duration
+	maxTTL     time.Duration
+	jitter     float64
+	// reaper removes expired elements in the background
+	reapInterval time.Duration
+	reaperStop   chan struct{}
+	reaperDone   chan struct{}
+	// sampleSize enables active expiration cycles in the reaper
+	sampleSize     int
+	expirationMode ExpirationMode
+	// sweepEntries and sweepDuration bound the work of a reaper cycle
+	sweepEntries  int
+	sweepDuration time.Duration
+	// purgeOnWrite is the number of expired elements removed on every write
+	purgeOnWrite int
+	// base is the instant expiry times are measured from, monotonic is set
+	// when the map reads the monotonic clock instead of the clock provider
+	base      time.Time
+	monotonic bool
+	// wheelResolution is set when the timing wheel replaces the heap
+	wheelResolution time.Duration
+	// sparse disables preallocation for the capacity
+	sparse bool
+	// lazyDeletion leaves removed elements in the expiry heap as tombstones
+	lazyDeletion bool
+	// expiryBatch is the number of expiry times DeferredExpiry buffers
+	expiryBatch int
+	// staleGrace is how long expired elements are kept for GetStale, in
+	// the units of the expiry heap priorities
+	staleGrace int64
+	// granularity expiry times are rounded up to, in the units of the
+	// expiry heap priorities
+	granularity int64
+	// flushes are the pending FlushAt deadlines in ascending order
+	flushes []int64
+	// evictor picks eviction victims, nil evicts the soonest expiring
+	evictor        evictor
+	evictionPolicy EvictionPolicy
+	// priorities is set once elements with eviction priorities are stored,
+	// it wraps the evictor of the eviction policy
+	priorities *priorityEvictor
+	// evictBatch is the fraction of the capacity evicted at once
+	evictBatch float64
+	rejectFull bool
+	// evictions delivers evicted elements if set
+	evictions        chan EvictedEntry
+	droppedEvictions int
+	// events delivers the changes of the elements if set, replacedKey and
+	// replacedValue hold a replaced value until the write replacing it
+	events        chan Event
+	droppedEvents int
+	replacing     bool
+	replacedKey   string
+	replacedValue interface{}
+	// shards is set by the Shards option, shard marks the shards of a
+	// ShardedMap
+	shards int
+	shard  bool
+	// readIndex holds snapshots of the elements for lock free reads
+	readIndex *sync.Map
+	// hot caches the snapshots of the most read keys
+	hot *hotCache
+	// ordered keeps the keys sorted with OrderedKeys
+	ordered *keyTree
+	// keyCodec encodes the structured keys of SetKey and friends
+	keyCodec KeyCodec
+	// hitWindows count the lookups over HitRatioWindows
+	hitWindows *hitWindows
+	// latencies are recorded with RecordLatencies
+	latencies *latencies
+	// logger reports anomalies, set with WithLogger
+	logger Logger
+	// stormStart and stormEvictions count the capacity evictions of the
+	// current second to detect eviction storms
+	stormStart     int64
+	stormEvictions int
+	// trackAccess counts the reads of every element for EntryInfo
+	trackAccess bool
+	// expvarName is the name the stats are published under
+	expvarName string
+	// counters are reported by Stats, they are allocated separately so the
+	// atomic counters are 64 bit aligned on 32 bit platforms
+	counters *counters
+	// dispatcher runs the callbacks with AsyncCallbacks
+	callbackWorkers int
+	dispatcher      *dispatcher
+	// computing holds the GetOrCompute calls in flight by key
+	computeMutex sync.Mutex
+	computing    map[string]*computation
+	// stripes serialize Update calls per key with UpdateStripes
+	stripes []sync.Mutex
+	// reclaimer defers recycling for the readers of LockFreeReads
+	reclaimer *reclaimer
+	// writes counts the values written, it stamps the element versions
+	writes uint64
+	// watermarks are fractions of the capacity, reaching high evicts down
+	// to low
+	highWatermark float64
+	lowWatermark  float64
+	// sketch estimates key frequencies for the TinyLFU admission filter
+	sketch *countMinSketch
+	// cost is the total cost of the elements as computed by sizer
+	sizer   Sizer
+	maxCost int64
+	cost    int64
+}
+
+// ExpiredEntry is an element removed from the map by RemoveExpired
+type ExpiredEntry struct {
+	Key       string
+	Value     interface{}
+	ExpiredAt time.Time
+}
+
+type mapElement struct {
+	// accessCount and lastAccess are updated atomically by reads with
+	// TrackAccess, they and entry come first to be 64 bit aligned on 32 bit
+	// platforms
+	accessCount uint64
+	lastAccess  int64
+	// entry is what LockFreeReads readers see of the element
+	entry seqEntry
+	key   string
+	value interface{}
+	// heapEl is embedded so an element takes a single allocation
+	heapEl    heapElement
+	createdAt time.Time
+	// updatedAt is when the value was last written, in the units of the
+	// expiry heap priorities
+	updatedAt int64
+	insertEl  *list.Element
+	wheelEl   *list.Element
+	evictEl   *list.Element
+	counterEl *heapElement
+	// evictIndex is the position of the element in the random evictor
+	evictIndex int
+	cost       int64
+	// priority elements are evicted in, lowest first
+	priority int
+	levelEl  *heapElement
+	// ttl the element was last set with, used by sliding expiration
+	ttl time.Duration
+	// version is the value of writes when the value was last written
+	version uint64
+	// dead elements are removed but still in the expiry heap with
+	// LazyDeletion, the heap recycles them
+	dead bool
+	// pendingIndex is the position plus one of the element in the
+	// DeferredExpiry buffer, 0 if it is not buffered
+	pendingIndex int
+	// published is set while the element is in the read index under its key
+	published bool
+}
+
+func NewMap(capacity int, opts ...TtlMapOption) (*TtlMap, error) {
+	return newMap(capacity, false, opts...)
+}
+
+func newMap(capacity int, concurrent bool, opts ...TtlMapOption) (*TtlMap, error) {
+	if capacity <= 0 {
+		return nil, errors.New("Capacity should be > 0")
+	}
+
+	m := &TtlMap{
+		capacity:   capacity,
+		insertions: list.New(),
+		counters:   &counters{},
+	}
+
+	for _, o := range opts {
+		if err := o(m); err != nil {
+			return nil, err
+		}
+	}
+
+	mutex, err := m.newLocker(concurrent)
+	if err != nil {
+		return nil, err
+	}
+	m.mutex = mutex
+
+	if m.maxTTL != 0 && m.minTTL > m.maxTTL {
+		return nil, fmt.Errorf("Min ttl %v should be <= max ttl %v", m.minTTL, m.maxTTL)
+	}
+
+	if m.shards > 0 && !m.shard {
+		return nil, errors.New("Shards option requires NewSharded")
+	}
+
+	if m.readIndex != nil && m.writesOnRead() {
+		return nil, errors.New("Lock free reads can not be combined with options that modify the map on read")
+	}
+
+	if m.hot != nil && m.writesOnRead() {
+		return nil, errors.New("Hot key cache can not be combined with options that modify the map on read")
+	}
+
+	if m.trackAccess && (m.readIndex != nil || m.hot != nil) {
+		return nil, errors.New("Access tracking can not be combined with LockFreeReads or HotKeyCache")
+	}
+
+	if m.stripes != nil && m.mutex == nil {
+		return nil, errors.New("Update stripes require a map created with NewConcurrent")
+	}
+
+	if m.sampleSize > 0 && (m.sweepEntries > 0 || m.sweepDuration > 0) {
+		return nil, errors.New("Sweep budget can not be combined with ActiveExpiration")
+	}
+
+	if m.rejectFull && m.highWatermark > 0 {
+		return nil, errors.New("Watermarks can not be combined with RejectWhenFull")
+	}
+
+	m.elements = make(map[string]*mapElement, m.preallocated())
+	m.expiryTimes = m.newExpiryIndex()
+
+	if m.clock == nil {
+		m.clock = &timetools.RealTime{}
+		m.monotonic = true
+	}
+	m.base = m.currentTime()
+
+	if err := m.validateExpirationMode(); err != nil {
+		return nil, err
+	}
+
+	if m.callbackWorkers > 0 {
+		m.dispatcher = newDispatcher(m.callbackWorkers)
+	}
+
+	if m.reapInterval > 0 {
+		if err := m.StartReaper(m.reapInterval); err != nil {
+			m.Close()
+			return nil, err
+		}
+	}
+
+	// Shards are published as a whole by NewSharded
+	if m.expvarName != "" && !m.shard {
+		if err := publishExpvar(m.expvarName, m.Stats); err != nil {
+			m.Close()
+			return nil, err
+		}
+	}
+
+	return m, nil
+}
+
+func NewMapWithProvider(capacity int, timeProvider timetools.TimeProvider) (*TtlMap, error) {
+	if timeProvider == nil {
+		return nil, errors.New("Please pass timeProvider")
+	}
+	return NewMap(capacity, Clock(timeProvider))
+}
+
+func NewConcurrent(capacity int, opts ...TtlMapOption) (*TtlMap, error) {
+	return newMap(capacity, true, opts...)
+}
+
+func (m *TtlMap) Set(key string, value interface{}, ttlSeconds int) error {
+	expiryTime, err := m.secondsToExpiryTime(ttlSeconds)
+	if err != nil {
+		return err
+	}
+	if m.mutex != nil {
+		m.mutex.Lock()
+		defer m.mutex.Unlock()
+	}
+	return m.set(key, value, expiryTime)
+}
+
+// SetWithDuration is like Set but accepts a ttl with sub-second precision
+func (m *TtlMap) SetWithDuration(key string, value interface{}, ttl time.Duration) error {
+	expiryTime, err := m.toExpiryTime(ttl)
+	if err != nil {
+		return err
+	}
+	if m.mutex != nil {
+		m.mutex.Lock()
+		defer m.mutex.Unlock()
+	}
+	return m.set(key, value, expiryTime)
+}
+
+// SetDefault sets the value with the ttl configured by the DefaultTTL option
+func (m *TtlMap) SetDefault(key string, value interface{}) error {
+	if m.defaultTTL == 0 {
+		return errors.New("Default ttl is not configured")
+	}
+	return m.SetWithDuration(key, value, m.defaultTTL)
+}
+
+// SetWithExpireAt sets the value to expire at the given absolute time
+func (m *TtlMap) SetWithExpireAt(key string, value interface{}, expireAt time.Time) error {
+	expiryTime, err := m.fromTime(expireAt)
+	if err != nil {
+		return err
+	}
+	if m.mutex != nil {
+		m.mutex.Lock()
+		defer m.mutex.Unlock()
+	}
+	return m.set(key, value, expiryTime)
+}
+
+// SetIfAbsent sets the value only if there is no live element with the given
+// key, returns true if the value was set
+func (m *TtlMap) SetIfAbsent(key string, value interface{}, ttlSeconds int) (bool, error) {
+	expiryTime, err := m.secondsToExpiryTime(ttlSeconds)
+	if err != nil {
+		return false, err
+	}
+	if m.mutex != nil {
+		m.mutex.Lock()
+		defer m.mutex.Unlock()
+	}
+
+	if mapEl, expired := m.get(key); mapEl != nil && !expired {
+		return false, nil
+	}
+	if err := m.set(key, value, expiryTime); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Replace sets the value only if a live element with the given key already
+// exists, returns true if the value was set
+func (m *TtlMap) Replace(key string, value interface{}, ttlSeconds int) (bool, error) {
+	expiryTime, err := m.secondsToExpiryTime(ttlSeconds)
+	if err != nil {
+		return false, err
+	}
+	if m.mutex != nil {
+		m.mutex.Lock()
+		defer m.mutex.Unlock()
+	}
+
+	if mapEl, expired := m.get(key); mapEl == nil || expired {
+		return false, nil
+	}
+	if err := m.set(key, value, expiryTime); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// SetKeepTTL replaces the value of a live element without changing its expiry
+// time, returns false if there is no live element with the given key
+func (m *TtlMap) SetKeepTTL(key string, value interface{}) bool {
+	if m.mutex != nil {
+		m.mutex.Lock()
+		defer m.mutex.Unlock()
+	}
+
+	mapEl, expired := m.get(key)
+	if mapEl == nil || expired {
+		return false
+	}
+	cost, err := m.costOf(key, value)
+	if err != nil {
+		return false
+	}
+	if m.maxCost > 0 && m.cost-mapEl.cost+cost > m.maxCost {
+		if !m.rejectFull {
+			// Growing the element needs room, set stores it anew
+			return m.set(key, value, mapEl.heapEl.Priority) == nil
+		}
+		if !m.reclaimExpired(mapEl, cost-mapEl.cost) {
+			return false
+		}
+	}
+	m.removed(mapEl, Replaced)
+	mapEl.value = value
+	m.written(mapEl, m.now())
+	m.cost += cost - mapEl.cost
+	mapEl.cost = cost
+	m.publish(mapEl)
+	return true
+}
+
+// CompareAndSwap sets the value to newValue only if a live element with the
+// given key exists and its value equals oldValue, returns true if the value
+// was swapped
+func (m *TtlMap) CompareAndSwap(key string, oldValue, newValue interface{}, ttlSeconds int) (bool, error) {
+	if oldValue != nil && !reflect.TypeOf(oldValue).Comparable() {
+		return false, fmt.Errorf("Expected comparable value, got %T", oldValue)
+	}
+	expiryTime, err := m.secondsToExpiryTime(ttlSeconds)
+	if err != nil {
+		return false, err
+	}
+	if m.mutex != nil {
+		m.mutex.Lock()
+		defer m.mutex.Unlock()
+	}
+
+	mapEl, expired := m.get(key)
+	if mapEl == nil || expired {
+		return false, nil
+	}
+	if mapEl.value != nil && !reflect.TypeOf(mapEl.value).Comparable() {
+		return false, fmt.Errorf("Expected existing value to be comparable, got %T", mapEl.value)
+	}
+	if mapEl.value != oldValue {
+		return false, nil
+	}
+	if err := m.set(key, newValue, expiryTime); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// GetOrSet returns the value of the live element with the given key if there
+// is one, otherwise sets and returns the given value. loaded is true if the
+// value was already present.
+func (m *TtlMap) GetOrSet(key string, value interface{}, ttlSeconds int) (actual interface{}, loaded bool, err error) {
+	expiryTime, err := m.secondsToExpiryTime(ttlSeconds)
+	if err != nil {
+		return nil, false, err
+	}
+	if m.mutex != nil {
+		m.mutex.Lock()
+		defer m.mutex.Unlock()
+	}
+
+	if mapEl, expired := m.get(key); mapEl != nil && !expired {
+		return mapEl.value, true, nil
+	}
+	if err := m.set(key, value, expiryTime); err != nil {
+		return nil, false, err
+	}
+	return value, false, nil
+}
+
+// SetMany sets all the given entries with the same ttl under a single lock
+func (m *TtlMap) SetMany(entries map[string]interface{}, ttlSeconds int) error {
+	expiryTime, err := m.secondsToExpiryTime(ttlSeconds)
+	if err != nil {
+		return err
+	}
+	if m.mutex != nil {
+		m.mutex.Lock()
+		defer m.mutex.Unlock()
+	}
+	for key, value := range entries {
+		if err := m.set(key, value, expiryTime); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Capacity returns the maximum number of elements the map can hold
+func (m *TtlMap) Capacity() int {
+	if m.mutex != nil {
+		m.mutex.RLock()
+		defer m.mutex.RUnlock()
+	}
+	return m.capacity
+}
+
+// SetCapacity changes the maximum number of elements the map can hold,
+// evicting elements if the map holds more than the new capacity
+func (m *TtlMap) SetCapacity(capacity int) error {
+	if capacity <= 0 {
+		return errors.New("Capacity should be > 0")
+	}
+	if m.mutex != nil {
+		m.mutex.Lock()
+		defer m.mutex.Unlock()
+	}
+
+	if m.rejectFull && len(m.elements) > capacity {
+		m.removeExpired(len(m.elements) - capacity)
+		if len(m.elements) > capacity {
+			return ErrFull
+		}
+	}
+	m.capacity = capacity
+	if len(m.elements) > capacity {
+		m.freeSpace(len(m.elements) - capacity)
+	}
+	return nil
+}
+
+func (m *TtlMap) Len() int {
+	if m.mutex != nil {
+		m.mutex.RLock()
+		defer m.mutex.RUnlock()
+	}
+	return len(m.elements)
+}
+
+// Keys returns the keys of all elements that have not expired yet
+func (m *TtlMap) Keys() []string {
+	if m.mutex != nil {
+		m.mutex.RLock()
+		defer m.mutex.RUnlock()
+	}
+
+	now := m.now()
+	keys := make([]string, 0, len(m.elements))
+	for key, mapEl := range m.elements {
+		if mapEl.heapEl.Priority <= now {
+			continue
+		}
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// Items returns a copy of all elements that have not expired yet
+func (m *TtlMap) Items() map[string]interface{} {
+	if m.mutex != nil {
+		m.mutex.RLock()
+		defer m.mutex.RUnlock()
+	}
+
+	now := m.now()
+	items := make(map[string]interface{}, len(m.elements))
+	for key, mapEl := range m.elements {
+		if mapEl.heapEl.Priority <= now {
+			continue
+		}
+		items[key] = mapEl.value
+	}
+	return items
+}
+
+// Values returns the values of all elements that have not expired yet
+func (m *TtlMap) Values() []interface{} {
+	if m.mutex != nil {
+		m.mutex.RLock()
+		defer m.mutex.RUnlock()
+	}
+
+	now := m.now()
+	values := make([]interface{}, 0, len(m.elements))
+	for _, mapEl := range m.elements {
+		if mapEl.heapEl.Priority <= now {
+			continue
+		}
+		values = append(values, mapEl.value)
+	}
+	return values
+}
+
+// Range calls fn for every element that has not expired yet, stopping early
+// if fn returns false. fn is called while the map is locked, so it must not
+// modify the map.
+func (m *TtlMap) Range(fn func(key string, value interface{}, expiresAt time.Time) bool) {
+	if m.mutex != nil {
+		m.mutex.RLock()
+		defer m.mutex.RUnlock()
+	}
+
+	now := m.now()
+	for key, mapEl := range m.elements {
+		if mapEl.heapEl.Priority <= now {
+			continue
+		}
+		if !fn(key, mapEl.value, m.fromExpiryTime(mapEl.heapEl.Priority)) {
+			return
+		}
+	}
+}
+
+// RandomKey returns the key of a randomly chosen live element
+func (m *TtlMap) RandomKey() (string, bool) {
+	if m.mutex != nil {
+		m.mutex.RLock()
+		defer m.mutex.RUnlock()
+	}
+
+	sample := m.randomSample(1)
+	if len(sample) == 0 {
+		return "", false
+	}
+	return sample[0], true
+}
+
+// RandomSample returns the keys of up to n randomly chosen live elements
+func (m *TtlMap) RandomSample(n int) []string {
+	if m.mutex != nil {
+		m.mutex.RLock()
+		defer m.mutex.RUnlock()
+	}
+
+	return m.randomSample(n)
+}
+
+// randomSample does reservoir sampling over the expiry index, skipping
+// expired elements
+func (m *TtlMap) randomSample(n int) []string {
+	if n <= 0 {
+		return []string{}
+	}
+	now := m.now()
+	sample := make([]string, 0, n)
+	seen := 0
+	m.expiryTimes.ForEach(func(heapEl *heapElement) bool {
+		if heapEl.Priority <= now {
+			return true
+		}
+		key := heapEl.Value.(*mapElement).key
+		if seen < n {
+			sample = append(sample, key)
+		} else if j := rand.Intn(seen + 1); j < n {
+			sample[j] = key
+		}
+		seen += 1
+		return true
+	})
+	return sample
+}
+
+// LiveLen returns the number of elements that have not expired yet. Unlike
+// Len it does not count expired elements that have not been removed yet.
+func (m *TtlMap) LiveLen() int {
+	if m.mutex != nil {
+		m.mutex.RLock()
+		defer m.mutex.RUnlock()
+	}
+	return len(m.elements) - m.expiryTimes.CountExpired(m.now())
+}
+
+// TTLHistogram counts the live elements by their remaining ttl. The buckets
+// are upper bounds in ascending order, element i of the result counts the
+// elements whose remaining ttl is <= buckets[i] and above the previous bound.
+// The extra last element counts everything above the last bound, including
+// the elements that never expire.
+func (m *TtlMap) TTLHistogram(buckets []time.Duration) []int {
+	if m.mutex != nil {
+		m.mutex.RLock()
+		defer m.mutex.RUnlock()
+	}
+
+	counts := make([]int, len(buckets)+1)
+	now := m.now()
+	for _, mapEl := range m.elements {
+		expiryTime := mapEl.heapEl.Priority
+		if expiryTime <= now {
+			continue
+		}
+		if expiryTime == neverExpires {
+			counts[len(buckets)]++
+			continue
+		}
+		remaining := time.Duration(expiryTime - now)
+		i := sort.Search(len(buckets), func(i int) bool { return remaining <= buckets[i] })
+		counts[i]++
+	}
+	return counts
+}
+
+func (m *TtlMap) Get(key string) (interface{}, bool) {
+	start := m.getStarted()
+	value, ok := m.lookup(key)
+	m.gotten(start, ok)
+	return value, ok
+}
+
+func (m *TtlMap) lookup(key string) (interface{}, bool) {
+	if m.hot != nil {
+		if value, hit := m.hotGet(key); hit {
+			return value, true
+		}
+	}
+	if m.readIndex != nil {
+		if value, _, exists, found := m.loadLive(key); found {
+			return value, exists
+		}
+	}
+	value, _, found, expired := m.lockNGet(key)
+	if !found {
+		return nil, false
+	}
+	if expired {
+		value, _, live := m.lockNExpire(key)
+		return value, live
+	}
+	return value, true
+}
+
+// GetStale is like Get but also returns elements that expired less than the
+// StaleGracePeriod ago, with stale set to true
+func (m *TtlMap) GetStale(key string) (value interface{}, stale bool, ok bool) {
+	value, expiryTime, found, expired := m.lockNGet(key)
+	if !found {
+		return nil, false, false
+	}
+	if !expired {
+		return value, false, true
+	}
+	if expiryTime+m.staleGrace > m.now() {
+		return value, true, true
+	}
+	value, _, live := m.lockNExpire(key)
+	return value, false, live
+}
+
+// GetMany returns the values of all live elements with the given keys,
+// missing and expired keys are omitted from the result
+func (m *TtlMap) GetMany(keys []string) map[string]interface{} {
+	var values map[string]interface{}
+	if m.readIndex != nil {
+		values = m.lockFreeGetMany(keys)
+	} else {
+		values = m.getMany(keys)
+	}
+	m.lookedUpMany(uint64(len(values)), uint64(len(keys)-len(values)))
+	return values
+}
+
+func (m *TtlMap) getMany(keys []string) map[string]interface{} {
+	values, expired := m.lockNGetMany(keys)
+	for _, key := range expired {
+		if value, _, live := m.lockNExpire(key); live {
+			values[key] = value
+		}
+	}
+	return values
+}
+
+// lockNGetMany returns the values of the live elements and the keys of the
+// expired ones, never the elements, which may be recycled once the lock is
+// released
+func (m *TtlMap) lockNGetMany(keys []string) (map[string]interface{}, []string) {
+	if m.mutex != nil {
+		if m.writesOnRead() {
+			m.mutex.Lock()
+			defer m.mutex.Unlock()
+		} else {
+			m.mutex.RLock()
+			defer m.mutex.RUnlock()
+		}
+	}
+
+	var expiredKeys []string
+	values := make(map[string]interface{}, len(keys))
+	for _, key := range keys {
+		if m.sketch != nil {
+			m.sketch.increment(key)
+		}
+		mapEl, expired := m.get(key)
+		if mapEl == nil {
+			continue
+		}
+		if expired {
+			expiredKeys = append(expiredKeys, key)
+			continue
+		}
+		m.access(mapEl)
+		values[key] = mapEl.value
+	}
+	return values, expiredKeys
+}
+
+// GetWithTTL returns the value of the element along with the time left
+// before it expires, the ttl is 0 for persisted elements
+func (m *TtlMap) GetWithTTL(key string) (interface{}, time.Duration, bool) {
+	value, ttl, ok := m.lookupWithTTL(key)
+	m.lookedUp(ok)
+	return value, ttl, ok
+}
+
+func (m *TtlMap) lookupWithTTL(key string) (interface{}, time.Duration, bool) {
+	if m.readIndex != nil {
+		if value, expiryTime, exists, found := m.loadLive(key); found {
+			if !exists {
+				return nil, 0, false
+			}
+			if expiryTime == neverExpires {
+				return value, 0, true
+			}
+			return value, time.Duration(expiryTime - m.now()), true
+		}
+	}
+	value, expiryTime, found, expired := m.lockNGet(key)
+	if !found {
+		return nil, 0, false
+	}
+	if expired {
+		var live bool
+		if value, expiryTime, live = m.lockNExpire(key); !live {
+			return nil, 0, false
+		}
+	}
+	if expiryTime == neverExpires {
+		return value, 0, true
+	}
+	return value, time.Duration(expiryTime - m.now()), true
+}
+
+// Delete removes the element with the given key, returns true if a live
+// (not expired) element was removed. An expired element is removed like
+// Get would, calling the expiration callback.
+func (m *TtlMap) Delete(key string) bool {
+	if m.mutex != nil {
+		m.mutex.Lock()
+		defer m.mutex.Unlock()
+	}
+
+	mapEl, expired := m.get(key)
+	if mapEl == nil {
+		return false
+	}
+	m.drop(mapEl, expired)
+	return !expired
+}
+
+// Clear removes all elements from the map, options and capacity are retained
+func (m *TtlMap) Clear() {
+	if m.mutex != nil {
+		m.mutex.Lock()
+		defer m.mutex.Unlock()
+	}
+
+	elements := m.elements
+	for _, mapEl := range elements {
+		m.unpublish(mapEl)
+	}
+	m.elements = make(map[string]*mapElement, m.preallocated())
+	m.expiryTimes = m.newExpiryIndex()
+	m.insertions = list.New()
+	m.cost = 0
+	if m.evictor != nil {
+		m.evictor.clear()
+	}
+	if m.ordered != nil {
+		m.ordered = &keyTree{}
+	}
+
+	now := m.now()
+	for _, mapEl := range elements {
+		if mapEl.heapEl.Priority <= now {
+			m.removed(mapEl, Expired)
+		} else {
+			m.removed(mapEl, Deleted)
+		}
+		m.recycle(mapEl)
+	}
+}
+
+// Contains reports whether an element with the given key exists and has not
+// expired yet
+func (m *TtlMap) Contains(key string) bool {
+	if m.readIndex != nil {
+		_, _, exists, _ := m.loadLive(key)
+		return exists
+	}
+	if m.mutex != nil {
+		m.mutex.RLock()
+		defer m.mutex.RUnlock()
+	}
+
+	mapEl, expired := m.get(key)
+	return mapEl != nil && !expired
+}
+
+// Rename moves the live element stored under oldKey to newKey keeping its
+// value and expiry time. An element already stored under newKey is replaced.
+// With EventChannel a rename is a DeleteEvent of oldKey followed by the
+// SetEvent or UpdateEvent of newKey. The cost of the element is computed
+// anew for newKey, if it grows beyond MaxCost other elements are evicted as
+// by Set. Returns false if there is no live element with oldKey, or if the
+// element does not fit under newKey.
+func (m *TtlMap) Rename(oldKey, newKey string) bool {
+	if m.mutex != nil {
+		m.mutex.Lock()
+		defer m.mutex.Unlock()
+	}
+
+	mapEl, expired := m.get(oldKey)
+	if mapEl == nil || expired {
+		return false
+	}
+	if oldKey == newKey {
+		return true
+	}
+	cost, err := m.costOf(newKey, mapEl.value)
+	if err != nil {
+		return false
+	}
+	existing, expired := m.get(newKey)
+	if existing != nil && expired {
+		m.del(existing)
+		existing = nil
+	}
+	delta := cost - mapEl.cost
+	if existing != nil {
+		delta -= existing.cost
+	}
+	if m.rejectFull && m.maxCost > 0 && m.cost+delta > m.maxCost {
+		// Live elements are never evicted, only expired ones make room
+		if !m.reclaimExpired(mapEl, delta) {
+			return false
+		}
+	}
+	if existing != nil {
+		m.remove(existing, Replaced)
+	}
+	delete(m.elements, oldKey)
+	m.unpublish(mapEl)
+	mapEl.key = newKey
+	m.elements[newKey] = mapEl
+	if m.ordered != nil {
+		m.ordered.remove(oldKey)
+		m.ordered.insert(newKey)
+	}
+	m.publish(mapEl)
+	if m.events != nil {
+		m.sendEvent(Event{Type: DeleteEvent, Key: oldKey, OldValue: mapEl.value})
+		m.writeEvent(mapEl)
+	}
+	m.cost += cost - mapEl.cost
+	mapEl.cost = cost
+	for m.maxCost > 0 && m.cost > m.maxCost {
+		if m.removeExpired(1) > 0 {
+			continue
+		}
+		m.evict(m.victim())
+	}
+	return true
+}
+
+// Oldest returns the live element that was inserted first
+func (m *TtlMap) Oldest() (key string, value interface{}, createdAt time.Time, ok bool) {
+	if m.mutex != nil {
+		m.mutex.RLock()
+		defer m.mutex.RUnlock()
+	}
+
+	now := m.now()
+	for e := m.insertions.Front(); e != nil; e = e.Next() {
+		mapEl := e.Value.(*mapElement)
+		if mapEl.heapEl.Priority > now {
+			return mapEl.key, mapEl.value, mapEl.createdAt, true
+		}
+	}
+	return "", nil, time.Time{}, false
+}
+
+// Newest returns the live element that was inserted last
+func (m *TtlMap) Newest() (key string, value interface{}, createdAt time.Time, ok bool) {
+	if m.mutex != nil {
+		m.mutex.RLock()
+		defer m.mutex.RUnlock()
+	}
+
+	now := m.now()
+	for e := m.insertions.Back(); e != nil; e = e.Prev() {
+		mapEl := e.Value.(*mapElement)
+		if mapEl.heapEl.Priority > now {
+			return mapEl.key, mapEl.value, mapEl.createdAt, true
+		}
+	}
+	return "", nil, time.Time{}, false
+}
+
+// ExpiresAt returns the time when the element with the given key expires,
+// the time is zero for persisted elements
+func (m *TtlMap) ExpiresAt(key string) (time.Time, bool) {
+	if m.readIndex != nil {
+		_, expiryTime, exists, _ := m.loadLive(key)
+		if !exists {
+			return time.Time{}, false
+		}
+		return m.fromExpiryTime(expiryTime), true
+	}
+	if m.mutex != nil {
+		m.mutex.RLock()
+		defer m.mutex.RUnlock()
+	}
+
+	mapEl, expired := m.get(key)
+	if mapEl == nil || expired {
+		return time.Time{}, false
+	}
+	return m.fromExpiryTime(mapEl.heapEl.Priority), true
+}
+
+// NextExpiry returns the element that expires first. It may have expired
+// already but not been removed yet, which is handy for callers running their
+// own RemoveExpired loop: there is nothing to remove until the returned time.
+// Returns false if the map is empty or none of its elements expire.
+func (m *TtlMap) NextExpiry() (key string, value interface{}, at time.Time, ok bool) {
+	// Peeking may fold the DeferredExpiry buffer or discard LazyDeletion
+	// tombstones, so it needs the write lock
+	if m.mutex != nil {
+		m.mutex.Lock()
+		defer m.mutex.Unlock()
+	}
+
+	if m.expiryTimes.Len() == 0 {
+		return "", nil, time.Time{}, false
+	}
+	heapEl := m.expiryTimes.PeekEl()
+	if heapEl.Priority == neverExpires {
+		return "", nil, time.Time{}, false
+	}
+	mapEl := heapEl.Value.(*mapElement)
+	return mapEl.key, mapEl.value, m.fromExpiryTime(heapEl.Priority), true
+}
+
+// Touch resets the expiry time of an existing element without changing its
+// value, returns false if there is no live element with the given key or the
+// ttl is invalid
+func (m *TtlMap) Touch(key string, ttlSeconds int) bool {
+	expiryTime, err := m.secondsToExpiryTime(ttlSeconds)
+	if err != nil {
+		return false
+	}
+	return m.touch(key, expiryTime)
+}
+
+// TouchWithDuration is like Touch but accepts a ttl with sub-second precision
+func (m *TtlMap) TouchWithDuration(key string, ttl time.Duration) bool {
+	expiryTime, err := m.toExpiryTime(ttl)
+	if err != nil {
+		return false
+	}
+	return m.touch(key, expiryTime)
+}
+
+func (m *TtlMap) touch(key string, expiryTime int64) bool {
+	if m.mutex != nil {
+		m.mutex.Lock()
+		defer m.mutex.Unlock()
+	}
+
+	mapEl, expired := m.get(key)
+	if mapEl == nil || expired {
+		return false
+	}
+	m.updateExpiryTime(mapEl, expiryTime, m.now())
+	return true
+}
+
+// Expire removes the element with the given key calling the expiration
+// callback as if its ttl had run out, returns true if a live element was
+// expired
+func (m *TtlMap) Expire(key string) bool {
+	if m.mutex != nil {
+		m.mutex.Lock()
+		defer m.mutex.Unlock()
+	}
+
+	mapEl, expired := m.get(key)
+	if mapEl == nil {
+		return false
+	}
+	m.del(mapEl)
+	return !expired
+}
+
+// Pop removes the element with the given key and returns its value if it
+// has not expired yet
+func (m *TtlMap) Pop(key string) (interface{}, bool) {
+	if m.mutex != nil {
+		m.mutex.Lock()
+		defer m.mutex.Unlock()
+	}
+
+	mapEl, expired := m.get(key)
+	if mapEl == nil {
+		return nil, false
+	}
+	value := mapEl.value
+	m.drop(mapEl, expired)
+	if expired {
+		return nil, false
+	}
+	return value, true
+}
+
+// RemoveExpired removes up to max expired elements (all of them if max <= 0),
+// calling the expiration callback for each of them, and returns the removed
+// entries in expiration order
+func (m *TtlMap) RemoveExpired(max int) []ExpiredEntry {
+	if m.mutex != nil {
+		m.mutex.Lock()
+		defer m.mutex.Unlock()
+	}
+
+	var removed []ExpiredEntry
+	m.reapExpired(max, func(entry ExpiredEntry) {
+		removed = append(removed, entry)
+	})
+	return removed
+}
+
+// reapExpired removes up to max expired elements (all of them if max <= 0)
+// calling the expiration callback and fn, if not nil, for each of them.
+// Returns the number of removed elements.
+func (m *TtlMap) reapExpired(max int, fn func(entry ExpiredEntry)) int {
+	removed := 0
+	now := m.now()
+	for max <= 0 || removed < max {
+		if m.expiryTimes.Len() == 0 {
+			break
+		}
+		heapEl := m.expiryTimes.PeekEl()
+		if heapEl.Priority+m.staleGrace > now {
+			break
+		}
+		mapEl := heapEl.Value.(*mapElement)
+		if m.elements[mapEl.key] != mapEl {
+			// Deleting by key would remove another element
+			if m.logger != nil {
+				m.logger.Warnf("ttlmap: expiry index holds %q, which is not in the map", mapEl.key)
+			}
+			m.expiryTimes.PopEl()
+			continue
+		}
+		entry := ExpiredEntry{
+			Key:       mapEl.key,
+			Value:     mapEl.value,
+			ExpiredAt: m.fromExpiryTime(heapEl.Priority),
+		}
+		m.del(mapEl)
+		removed += 1
+		if fn != nil {
+			fn(entry)
+		}
+	}
+	return removed
+}
+
+// Persist removes the ttl from the element with the given key so it never
+// expires, it can still be evicted when the map runs out of capacity.
+// Returns false if there is no live element with the given key.
+func (m *TtlMap) Persist(key string) bool {
+	if m.mutex != nil {
+		m.mutex.Lock()
+		defer m.mutex.Unlock()
+	}
 
-// CallOnExpire will call this callback on expiration of elements
-func CallOnExpire(cb Callback) TtlMapOption {
-	return func(m *TtlMap) error {
-		m.onExpire = cb
-		return nil
+	mapEl, expired := m.get(key)
+	if mapEl == nil || expired {
+		return false
 	}
+	m.updateExpiryTime(mapEl, neverExpires, m.now())
+	return true
 }
 
-type TtlMap struct {
-	capacity    int
-	elements    map[string]*mapElement
-	expiryTimes *minheap.MinHeap
-	clock       timetools.TimeProvider
-	mutex       *sync.RWMutex
-	// onExpire callback will be called when element is expired
-	onExpire Callback
+// Increment adds value to the integer stored under key, or stores value if
+// there is no live element, and returns the result. The lookup, expiry check
+// and update happen in a single critical section, so concurrent increments
+// on a concurrent map are never lost.
+func (m *TtlMap) Increment(key string, value int, ttlSeconds int) (int, error) {
+	expiryTime, err := m.secondsToExpiryTime(ttlSeconds)
+	if err != nil {
+		return 0, err
+	}
+	return m.increment(key, value, expiryTime, false)
 }
 
-type mapElement struct {
-	key    string
-	value  interface{}
-	heapEl *minheap.Element
+// IncrementWithDuration is like Increment but accepts a ttl with sub-second
+// precision
+func (m *TtlMap) IncrementWithDuration(key string, value int, ttl time.Duration) (int, error) {
+	expiryTime, err := m.toExpiryTime(ttl)
+	if err != nil {
+		return 0, err
+	}
+	return m.increment(key, value, expiryTime, false)
 }
 
-func NewMap(capacity int, opts ...TtlMapOption) (*TtlMap, error) {
-	if capacity <= 0 {
-		return nil, errors.New("Capacity should be > 0")
+// IncrementKeepTTL is like Increment but keeps the expiry time of an existing
+// element, the ttl only applies when a new element is created. This makes
+// counters expire at the end of fixed windows, e.g. for rate limiting.
+func (m *TtlMap) IncrementKeepTTL(key string, value int, ttlSeconds int) (int, error) {
+	expiryTime, err := m.secondsToExpiryTime(ttlSeconds)
+	if err != nil {
+		return 0, err
 	}
+	return m.increment(key, value, expiryTime, true)
+}
 
-	m := &TtlMap{
-		capacity:    capacity,
-		elements:    make(map[string]*mapElement),
-		expiryTimes: minheap.NewMinHeap(),
+func (m *TtlMap) increment(key string, value int, expiryTime int64, keepTTL bool) (int, error) {
+	if m.mutex != nil {
+		m.mutex.Lock()
+		defer m.mutex.Unlock()
 	}
 
-	for _, o := range opts {
-		if err := o(m); err != nil {
-			return nil, err
+	mapEl, expired := m.get(key)
+	if mapEl == nil || expired {
+		if err := m.set(key, value, expiryTime); err != nil {
+			return 0, err
 		}
+		return value, nil
 	}
 
-	if m.clock == nil {
-		m.clock = &timetools.RealTime{}
+	currentValue, ok := mapEl.value.(int)
+	if !ok {
+		return 0, fmt.Errorf("Expected existing value to be integer, got %T", mapEl.value)
 	}
 
-	return m, nil
-}
-
-func NewMapWithProvider(capacity int, timeProvider timetools.TimeProvider) (*TtlMap, error) {
-	if timeProvider == nil {
-		return nil, errors.New("Please pass timeProvider")
+	if keepTTL {
+		expiryTime = mapEl.heapEl.Priority
 	}
-	return NewMap(capacity, Clock(timeProvider))
-}
-
-func NewConcurrent(capacity int, opts ...TtlMapOption) (*TtlMap, error) {
-	m, err := NewMap(capacity, opts...)
-	if err == nil {
-		m.mutex = new(sync.RWMutex)
+	currentValue += value
+	if err := m.set(key, currentValue, expiryTime); err != nil {
+		return 0, err
 	}
-	return m, err
+	return currentValue, nil
 }
 
-func (m *TtlMap) Set(key string, value interface{}, ttlSeconds int) error {
-	expiryTime, err := m.toEpochSeconds(ttlSeconds)
+// Update calls fn with the current value of the element (exists is false if
+// there is no live element) and sets the value it returns. fn is called while
+// the map is locked, so it must not access the map, unless UpdateStripes is
+// used. If fn returns an error the map is left unchanged.
+func (m *TtlMap) Update(key string, ttlSeconds int, fn func(current interface{}, exists bool) (interface{}, error)) error {
+	expiryTime, err := m.secondsToExpiryTime(ttlSeconds)
 	if err != nil {
 		return err
 	}
+	if m.stripes != nil {
+		return m.updateStriped(key, expiryTime, fn)
+	}
+
 	if m.mutex != nil {
 		m.mutex.Lock()
 		defer m.mutex.Unlock()
 	}
+
+	var current interface{}
+	mapEl, expired := m.get(key)
+	exists := mapEl != nil && !expired
+	if exists {
+		current = mapEl.value
+	}
+
+	value, err := fn(current, exists)
+	if err != nil {
+		return err
+	}
 	return m.set(key, value, expiryTime)
 }
 
-func (m *TtlMap) Len() int {
+// Append appends data to an existing string or []byte value, or sets it as a
+// new []byte value if there is no live element. Returns the length of the
+// resulting value.
+func (m *TtlMap) Append(key string, data []byte, ttlSeconds int) (int, error) {
+	expiryTime, err := m.secondsToExpiryTime(ttlSeconds)
+	if err != nil {
+		return 0, err
+	}
+
 	if m.mutex != nil {
-		m.mutex.RLock()
-		defer m.mutex.RUnlock()
+		m.mutex.Lock()
+		defer m.mutex.Unlock()
 	}
-	return len(m.elements)
+
+	mapEl, expired := m.get(key)
+	if mapEl == nil || expired {
+		value := make([]byte, len(data))
+		copy(value, data)
+		if err := m.set(key, value, expiryTime); err != nil {
+			return 0, err
+		}
+		return len(value), nil
+	}
+
+	switch currentValue := mapEl.value.(type) {
+	case []byte:
+		currentValue = append(currentValue, data...)
+		if err := m.set(key, currentValue, expiryTime); err != nil {
+			return 0, err
+		}
+		return len(currentValue), nil
+	case string:
+		currentValue += string(data)
+		if err := m.set(key, currentValue, expiryTime); err != nil {
+			return 0, err
+		}
+		return len(currentValue), nil
+	}
+	return 0, fmt.Errorf("Expected existing value to be string or []byte, got %T", mapEl.value)
 }
 
-func (m *TtlMap) Get(key string) (interface{}, bool) {
-	value, mapEl, expired := m.lockNGet(key)
-	if mapEl == nil {
-		return nil, false
+func (m *TtlMap) GetInt(key string) (int, bool, error) {
+	valueI, exists := m.Get(key)
+	if !exists {
+		return 0, false, nil
 	}
-	if expired {
-		m.lockNDel(mapEl)
-		return nil, false
+	value, ok := valueI.(int)
+	if !ok {
+		return 0, false, fmt.Errorf("Expected existing value to be integer, got %T", valueI)
 	}
-	return value, true
+	return value, true, nil
 }
 
-func (m *TtlMap) Increment(key string, value int, ttlSeconds int) (int, error) {
-	expiryTime, err := m.toEpochSeconds(ttlSeconds)
+func (m *TtlMap) IncrementFloat(key string, value float64, ttlSeconds int) (float64, error) {
+	expiryTime, err := m.secondsToExpiryTime(ttlSeconds)
 	if err != nil {
 		return 0, err
 	}
@@ -130,68 +1476,272 @@ func (m *TtlMap) Increment(key string, value int, ttlSeconds int) (int, error) {
 
 	mapEl, expired := m.get(key)
 	if mapEl == nil || expired {
-		m.set(key, value, expiryTime)
+		if err := m.set(key, value, expiryTime); err != nil {
+			return 0, err
+		}
 		return value, nil
 	}
 
-	currentValue, ok := mapEl.value.(int)
+	currentValue, ok := mapEl.value.(float64)
 	if !ok {
-		return 0, fmt.Errorf("Expected existing value to be integer, got %T", mapEl.value)
+		return 0, fmt.Errorf("Expected existing value to be float64, got %T", mapEl.value)
 	}
 
 	currentValue += value
-	m.set(key, currentValue, expiryTime)
+	if err := m.set(key, currentValue, expiryTime); err != nil {
+		return 0, err
+	}
 	return currentValue, nil
 }
 
-func (m *TtlMap) GetInt(key string) (int, bool, error) {
+func (m *TtlMap) GetFloat(key string) (float64, bool, error) {
 	valueI, exists := m.Get(key)
 	if !exists {
 		return 0, false, nil
 	}
-	value, ok := valueI.(int)
+	value, ok := valueI.(float64)
 	if !ok {
-		return 0, false, fmt.Errorf("Expected existing value to be integer, got %T", valueI)
+		return 0, false, fmt.Errorf("Expected existing value to be float64, got %T", valueI)
 	}
 	return value, true, nil
 }
 
-func (m *TtlMap) set(key string, value interface{}, expiryTime int) error {
-	if mapEl, ok := m.elements[key]; ok {
-		mapEl.value = value
-		m.expiryTimes.UpdateEl(mapEl.heapEl, expiryTime)
-		return nil
+func (m *TtlMap) GetString(key string) (string, bool, error) {
+	valueI, exists := m.Get(key)
+	if !exists {
+		return "", false, nil
+	}
+	value, ok := valueI.(string)
+	if !ok {
+		return "", false, fmt.Errorf("Expected existing value to be string, got %T", valueI)
+	}
+	return value, true, nil
+}
+
+func (m *TtlMap) GetBytes(key string) ([]byte, bool, error) {
+	valueI, exists := m.Get(key)
+	if !exists {
+		return nil, false, nil
+	}
+	value, ok := valueI.([]byte)
+	if !ok {
+		return nil, false, fmt.Errorf("Expected existing value to be []byte, got %T", valueI)
+	}
+	return value, true, nil
+}
+
+func (m *TtlMap) GetBool(key string) (bool, bool, error) {
+	valueI, exists := m.Get(key)
+	if !exists {
+		return false, false, nil
+	}
+	value, ok := valueI.(bool)
+	if !ok {
+		return false, false, fmt.Errorf("Expected existing value to be bool, got %T", valueI)
+	}
+	return value, true, nil
+}
+
+func (m *TtlMap) set(key string, value interface{}, expiryTime int64) error {
+	if m.latencies != nil {
+		defer m.latencies.set.record(time.Now())
+	}
+	if m.purgeOnWrite > 0 {
+		m.reapExpired(m.purgeOnWrite, nil)
+	}
+
+	if m.sketch != nil {
+		m.sketch.increment(key)
 	}
 
-	if len(m.elements) >= m.capacity {
-		m.freeSpace(1)
+	cost, err := m.costOf(key, value)
+	if err != nil {
+		return err
+	}
+
+	nowTime := m.currentTime()
+	now := m.sinceBase(nowTime)
+	priority := 0
+	// admitted keys had a live element, they are not subject to admission
+	admitted := false
+	if mapEl, ok := m.elements[key]; ok {
+		expired := mapEl.heapEl.Priority <= now
+		grow := m.maxCost > 0 && m.cost-mapEl.cost+cost > m.maxCost
+		if grow && m.rejectFull && !expired {
+			// Live elements are never evicted, only expired ones make room
+			if !m.reclaimExpired(mapEl, cost-mapEl.cost) {
+				return ErrFull
+			}
+			grow = false
+		}
+		if grow {
+			// Growing the element needs room, it is stored anew
+			priority = mapEl.priority
+			if expired {
+				m.remove(mapEl, Expired)
+			} else {
+				admitted = true
+				m.remove(mapEl, Replaced)
+			}
+		} else {
+			// Overwriting an expired element counts as a new insertion
+			if expired {
+				mapEl.createdAt = nowTime.UTC()
+				m.insertions.MoveToBack(mapEl.insertEl)
+				m.removed(mapEl, Expired)
+				m.resetAccess(mapEl)
+			} else {
+				m.removed(mapEl, Replaced)
+			}
+			mapEl.value = value
+			m.written(mapEl, now)
+			m.cost += cost - mapEl.cost
+			mapEl.cost = cost
+			m.updateExpiryTime(mapEl, expiryTime, now)
+			if m.evictor != nil {
+				m.evictor.access(mapEl)
+			}
+			m.publish(mapEl)
+			return nil
+		}
 	}
-	heapEl := &minheap.Element{
-		Priority: expiryTime,
+
+	// Without the reaper writes trim the map at the high watermark
+	if m.reaperStop == nil && m.aboveHighWatermark() {
+		m.trimToLowWatermark()
 	}
-	mapEl := &mapElement{
-		key:    key,
-		value:  value,
-		heapEl: heapEl,
+	for len(m.elements) > 0 && m.isFull(cost) {
+		if m.removeExpired(1) > 0 {
+			continue
+		}
+		if m.rejectFull {
+			return ErrFull
+		}
+		victim := m.victim()
+		if m.sketch != nil && !admitted && !m.sketch.admit(key, victim.key) {
+			return ErrRejected
+		}
+		if m.evictBatch > 0 && len(m.elements) >= m.capacity {
+			m.removeLastUsed(m.evictBatchSize())
+			continue
+		}
+		m.evict(victim)
 	}
-	heapEl.Value = mapEl
+	mapEl := newElement()
+	mapEl.key = key
+	mapEl.value = value
+	mapEl.createdAt = nowTime.UTC()
+	mapEl.ttl = ttlOf(expiryTime, now)
+	mapEl.cost = cost
+	mapEl.priority = priority
+	m.written(mapEl, now)
+	mapEl.heapEl.Priority = m.clampToFlush(expiryTime, now)
+	mapEl.insertEl = m.insertions.PushBack(mapEl)
 	m.elements[key] = mapEl
-	m.expiryTimes.PushEl(heapEl)
+	if m.ordered != nil {
+		m.ordered.insert(key)
+	}
+	m.cost += cost
+	m.expiryTimes.PushEl(&mapEl.heapEl)
+	if m.evictor != nil {
+		m.evictor.add(mapEl)
+	}
+	m.publish(mapEl)
 	return nil
 }
 
-func (m *TtlMap) lockNGet(key string) (value interface{}, mapEl *mapElement, expired bool) {
+// written stamps the element with a new version after its value changed
+func (m *TtlMap) written(mapEl *mapElement, now int64) {
+	m.writes += 1
+	mapEl.version = m.writes
+	mapEl.updatedAt = now
+	if m.events != nil {
+		m.writeEvent(mapEl)
+	}
+}
+
+// updateExpiryTime reschedules the element in the expiry heap
+func (m *TtlMap) updateExpiryTime(mapEl *mapElement, expiryTime, now int64) {
+	mapEl.ttl = ttlOf(expiryTime, now)
+	expiryTime = m.clampToFlush(expiryTime, now)
+	// With coarse expiry granularity rescheduling is often a no-op
+	if mapEl.heapEl.Priority != expiryTime {
+		m.expiryTimes.UpdateEl(&mapEl.heapEl, expiryTime)
+		m.rescheduled(mapEl)
+	}
+}
+
+// writesOnRead reports whether reads modify the map and need the write lock
+func (m *TtlMap) writesOnRead() bool {
+	return m.sliding || m.sketch != nil || (m.evictor != nil && m.evictor.tracksAccess())
+}
+
+// access records a read of a live element
+func (m *TtlMap) access(mapEl *mapElement) {
+	if m.trackAccess {
+		m.accessed(mapEl)
+	}
+	if m.sliding {
+		m.slide(mapEl)
+	}
+	if m.evictor != nil {
+		m.evictor.access(mapEl)
+	}
+}
+
+// rescheduled keeps the structures that mirror expiry times in sync after
+// the expiry time of the element changed
+func (m *TtlMap) rescheduled(mapEl *mapElement) {
+	if m.priorities != nil {
+		m.priorities.rescheduled(mapEl)
+	}
+	m.publish(mapEl)
+}
+
+// slide re-arms the ttl of a live element for sliding expiration
+func (m *TtlMap) slide(mapEl *mapElement) {
+	if mapEl.ttl <= 0 {
+		return
+	}
+	now := m.now()
+	expiryTime := m.clampToFlush(m.roundExpiryTime(now+int64(mapEl.ttl)), now)
+	if mapEl.heapEl.Priority != expiryTime {
+		m.expiryTimes.UpdateEl(&mapEl.heapEl, expiryTime)
+		m.rescheduled(mapEl)
+	}
+}
+
+func ttlOf(expiryTime, now int64) time.Duration {
+	if expiryTime == neverExpires {
+		return 0
+	}
+	return time.Duration(expiryTime - now)
+}
+
+// lockNGet copies what the readers need while the map is locked, the
+// element itself may be recycled as soon as the lock is released
+func (m *TtlMap) lockNGet(key string) (value interface{}, expiryTime int64, found bool, expired bool) {
 	if m.mutex != nil {
-		m.mutex.RLock()
-		defer m.mutex.RUnlock()
+		if m.writesOnRead() {
+			m.mutex.Lock()
+			defer m.mutex.Unlock()
+		} else {
+			m.mutex.RLock()
+			defer m.mutex.RUnlock()
+		}
 	}
 
-	mapEl, expired = m.get(key)
-	value = nil
-	if mapEl != nil {
-		value = mapEl.value
+	if m.sketch != nil {
+		m.sketch.increment(key)
+	}
+	mapEl, expired := m.get(key)
+	if mapEl == nil {
+		return nil, 0, false, false
 	}
-	return value, mapEl, expired
+	if !expired {
+		m.access(mapEl)
+	}
+	return mapEl.value, mapEl.heapEl.Priority, true, expired
 }
 
 func (m *TtlMap) get(key string) (*mapElement, bool) {
@@ -199,37 +1749,113 @@ func (m *TtlMap) get(key string) (*mapElement, bool) {
 	if !ok {
 		return nil, false
 	}
-	now := int(m.clock.UtcNow().Unix())
+	now := m.now()
 	expired := mapEl.heapEl.Priority <= now
 	return mapEl, expired
 }
 
-func (m *TtlMap) lockNDel(mapEl *mapElement) {
+// lockNExpire removes the expired element with the given key found by a
+// read. Lookup, expiry check and removal happen in a single critical section
+// on the current element rather than the one the read saw: if the key was set
+// again in the meantime the element is left alone and its live value and
+// expiry time are returned, so the expiration callback never fires with a
+// stale value.
+func (m *TtlMap) lockNExpire(key string) (value interface{}, expiryTime int64, live bool) {
+	// With eager only expiration reads leave expired elements to the reaper
+	if m.expirationMode == EagerExpiration {
+		return nil, 0, false
+	}
 	if m.mutex != nil {
 		m.mutex.Lock()
 		defer m.mutex.Unlock()
+	}
 
-		// Map element could have been updated. Now that we have a lock
-		// retrieve it again and check if it is still expired.
-		var ok bool
-		if mapEl, ok = m.elements[mapEl.key]; !ok {
-			return
-		}
-		now := int(m.clock.UtcNow().Unix())
-		if mapEl.heapEl.Priority > now {
-			return
-		}
+	mapEl, expired := m.get(key)
+	if mapEl == nil {
+		return nil, 0, false
+	}
+	if !expired {
+		m.access(mapEl)
+		return mapEl.value, mapEl.heapEl.Priority, true
+	}
+	// Expired elements are kept for GetStale during the grace period
+	if mapEl.heapEl.Priority+m.staleGrace > m.now() {
+		return nil, 0, false
 	}
 	m.del(mapEl)
+	return nil, 0, false
 }
 
 func (m *TtlMap) del(mapEl *mapElement) {
 	if m.onExpire != nil {
-		m.onExpire(mapEl.key, mapEl.value)
+		key, value := mapEl.key, mapEl.value
+		m.notify(func() { m.onExpire(key, value) })
 	}
+	m.remove(mapEl, Expired)
+}
+
+// drop removes an element the caller asked to remove, an expired one is
+// handled like on every other path that finds it expired: the expiration
+// callback fires and it counts as Expired
+func (m *TtlMap) drop(mapEl *mapElement, expired bool) {
+	if expired {
+		m.del(mapEl)
+		return
+	}
+	m.remove(mapEl, Deleted)
+}
+
+// remove drops the element from the map and the expiry heap without
+// triggering the expiration callback. The element is recycled, so it must not
+// be used afterwards.
+func (m *TtlMap) remove(mapEl *mapElement, reason RemovalReason) {
+	m.unlink(mapEl)
+	m.expiryTimes.RemoveEl(&mapEl.heapEl)
+	m.removed(mapEl, reason)
+	m.recycle(mapEl)
+}
 
+// unlink drops the element from everything but the expiry heap
+func (m *TtlMap) unlink(mapEl *mapElement) {
 	delete(m.elements, mapEl.key)
-	m.expiryTimes.RemoveEl(mapEl.heapEl)
+	m.unpublish(mapEl)
+	if m.ordered != nil {
+		m.ordered.remove(mapEl.key)
+	}
+	m.insertions.Remove(mapEl.insertEl)
+	m.cost -= mapEl.cost
+	if m.evictor != nil {
+		m.evictor.remove(mapEl)
+	}
+}
+
+// maxPreallocated bounds preallocation, so a huge capacity used as a mere
+// safety limit does not allocate all of it up front
+const maxPreallocated = 1 << 20
+
+// preallocated is the number of elements the internal structures are
+// allocated for
+func (m *TtlMap) preallocated() int {
+	if m.sparse {
+		return 0
+	}
+	if m.capacity > maxPreallocated {
+		return maxPreallocated
+	}
+	return m.capacity
+}
+
+func (m *TtlMap) newExpiryIndex() expiryIndex {
+	var index expiryIndex = newHeapIndex(m.preallocated())
+	if m.wheelResolution > 0 {
+		index = newTimingWheel(m.wheelResolution)
+	} else if m.lazyDeletion {
+		index = newTombstoneHeap(index.(*heapIndex), m.recycle)
+	}
+	if m.expiryBatch > 0 {
+		index = newDeferredIndex(index, m.expiryBatch)
+	}
+	return index
 }
 
 func (m *TtlMap) freeSpace(count int) {
@@ -242,7 +1868,7 @@ func (m *TtlMap) freeSpace(count int) {
 
 func (m *TtlMap) removeExpired(iterations int) int {
 	removed := 0
-	now := int(m.clock.UtcNow().Unix())
+	now := m.now()
 	for i := 0; i < iterations; i += 1 {
 		if len(m.elements) == 0 {
 			break
@@ -253,7 +1879,9 @@ func (m *TtlMap) removeExpired(iterations int) int {
 		}
 		m.expiryTimes.PopEl()
 		mapEl := heapEl.Value.(*mapElement)
-		delete(m.elements, mapEl.key)
+		m.unlink(mapEl)
+		m.removed(mapEl, Expired)
+		m.recycle(mapEl)
 		removed += 1
 	}
 	return removed
@@ -264,15 +1892,113 @@ func (m *TtlMap) removeLastUsed(iterations int) {
 		if len(m.elements) == 0 {
 			return
 		}
-		heapEl := m.expiryTimes.PopEl()
-		mapEl := heapEl.Value.(*mapElement)
-		delete(m.elements, mapEl.key)
+		m.evict(m.victim())
+	}
+}
+
+// victim returns the live element capacity eviction removes next
+func (m *TtlMap) victim() *mapElement {
+	if m.evictor != nil {
+		return m.evictor.victim()
+	}
+	return m.expiryTimes.PeekEl().Value.(*mapElement)
+}
+
+func (m *TtlMap) evict(mapEl *mapElement) {
+	if m.evictor != nil {
+		m.evictor.evicting(mapEl)
+	}
+	if m.evictions != nil {
+		m.sendEviction(mapEl)
+	}
+	m.remove(mapEl, EvictedCapacity)
+}
+
+// currentTime reads the clock
+func (m *TtlMap) currentTime() time.Time {
+	if m.monotonic {
+		// Unlike RealTime.UtcNow, time.Now carries a monotonic reading
+		return time.Now()
 	}
+	return m.clock.UtcNow()
+}
+
+// now returns the current time in the units of the expiry heap priorities,
+// which are nanoseconds elapsed since the map was created. With the default
+// clock they are measured on the monotonic clock, so wall clock steps (NTP,
+// VM migrations) neither expire elements early nor keep them alive longer.
+func (m *TtlMap) now() int64 {
+	return m.sinceBase(m.currentTime())
 }
 
-func (m *TtlMap) toEpochSeconds(ttlSeconds int) (int, error) {
+func (m *TtlMap) sinceBase(t time.Time) int64 {
+	return int64(t.Sub(m.base))
+}
+
+func (m *TtlMap) secondsToExpiryTime(ttlSeconds int) (int64, error) {
+	if ttlSeconds == NoExpiration {
+		return m.toExpiryTime(NoExpiration)
+	}
 	if ttlSeconds <= 0 {
 		return 0, fmt.Errorf("ttlSeconds should be >= 0, got %d", ttlSeconds)
 	}
-	return int(m.clock.UtcNow().Add(time.Second * time.Duration(ttlSeconds)).Unix()), nil
+	return m.toExpiryTime(time.Second * time.Duration(ttlSeconds))
+}
+
+func (m *TtlMap) toExpiryTime(ttl time.Duration) (int64, error) {
+	if ttl == NoExpiration {
+		if m.maxTTL == 0 {
+			return neverExpires, nil
+		}
+		ttl = m.maxTTL
+	}
+	if ttl <= 0 {
+		return 0, fmt.Errorf("ttl should be > 0, got %v", ttl)
+	}
+	if m.jitter != 0 {
+		ttl += time.Duration(float64(ttl) * m.jitter * (2*rand.Float64() - 1))
+		if ttl <= 0 {
+			ttl = 1
+		}
+	}
+	return m.roundExpiryTime(m.now() + int64(m.clampTTL(ttl))), nil
+}
+
+func (m *TtlMap) fromTime(expireAt time.Time) (int64, error) {
+	now := m.currentTime()
+	if !expireAt.After(now) {
+		return 0, fmt.Errorf("expireAt should be in the future, got %v", expireAt)
+	}
+	return m.roundExpiryTime(m.sinceBase(now) + int64(m.clampTTL(expireAt.Sub(now)))), nil
+}
+
+// roundExpiryTime rounds the expiry time up to the ExpiryGranularity
+func (m *TtlMap) roundExpiryTime(expiryTime int64) int64 {
+	g := m.granularity
+	if g == 0 || expiryTime%g == 0 {
+		return expiryTime
+	}
+	if expiryTime > 0 {
+		return expiryTime - expiryTime%g + g
+	}
+	return expiryTime - expiryTime%g
+}
+
+// clampTTL applies the MinTTL and MaxTTL bounds
+func (m *TtlMap) clampTTL(ttl time.Duration) time.Duration {
+	if m.minTTL != 0 && ttl < m.minTTL {
+		return m.minTTL
+	}
+	if m.maxTTL != 0 && ttl > m.maxTTL {
+		return m.maxTTL
+	}
+	return ttl
+}
+
+// fromExpiryTime converts an expiry heap priority to wall clock time
+func (m *TtlMap) fromExpiryTime(expiryTime int64) time.Time {
+	if expiryTime == neverExpires {
+		return time.Time{}
+	}
+	return m.base.Add(time.Duration(expiryTime)).UTC()
 }
@@ -1,6 +1,10 @@
 package ttlmap
 
 import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
 	"testing"
 	"time"
 
@@ -34,6 +38,10 @@ func (s *TestSuite) advanceSeconds(seconds int) {
 	s.timeProvider.CurrentTime = s.timeProvider.CurrentTime.Add(time.Second * time.Duration(seconds))
 }
 
+func (s *TestSuite) advance(d time.Duration) {
+	s.timeProvider.CurrentTime = s.timeProvider.CurrentTime.Add(d)
+}
+
 func (s *TestSuite) TestValidation(c *C) {
 	_, err := NewMapWithProvider(-1, s.timeProvider)
 	c.Assert(err, Not(Equals), nil)
@@ -312,6 +320,34 @@ func (s *TestSuite) TestIncrementUpdatesTtl(c *C) {
 	c.Assert(val, Equals, 2)
 }
 
+func (s *TestSuite) TestIncrementConcurrent(c *C) {
+	m := s.newMap(3)
+	m.Set("b", 100, 1)
+	s.advanceSeconds(1)
+
+	// Concurrent increments of a fresh and of an expired key are not lost
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g += 1 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 100; i += 1 {
+				m.Increment("a", 1, 10)
+				m.IncrementFloat("f", 0.5, 10)
+				m.Increment("b", 1, 10)
+			}
+		}()
+	}
+	wg.Wait()
+
+	val, _, _ := m.GetInt("a")
+	c.Assert(val, Equals, 800)
+	fval, _, _ := m.GetFloat("f")
+	c.Assert(fval, Equals, 400.0)
+	val, _, _ = m.GetInt("b")
+	c.Assert(val, Equals, 800)
+}
+
 func (s *TestSuite) TestUpdate(c *C) {
 	m := s.newMap(1)
 
@@ -351,3 +387,1502 @@ func (s *TestSuite) TestCallOnExpire(c *C) {
 	c.Assert(key, Equals, "a")
 	c.Assert(val, Equals, 1)
 }
+
+func (s *TestSuite) TestExpireOnReadRechecksUnderLock(c *C) {
+	var expired []interface{}
+	m := s.newMap(1, CallOnExpire(func(k string, el interface{}) {
+		expired = append(expired, el)
+	}))
+
+	m.Set("a", 1, 1)
+	s.advanceSeconds(1)
+
+	// A read found a expired, then the key is set again before the read
+	// gets to remove it
+	_, _, _, isExpired := m.lockNGet("a")
+	c.Assert(isExpired, Equals, true)
+	m.Set("a", 2, 5)
+
+	value, _, live := m.lockNExpire("a")
+	c.Assert(live, Equals, true)
+	c.Assert(value, Equals, 2)
+	c.Assert(expired, HasLen, 0)
+
+	s.advanceSeconds(5)
+	_, _, live = m.lockNExpire("a")
+	c.Assert(live, Equals, false)
+	c.Assert(expired, DeepEquals, []interface{}{2})
+}
+
+func (s *TestSuite) TestDelete(c *C) {
+	var called bool
+	m := s.newMap(2, CallOnExpire(func(k string, el interface{}) {
+		called = true
+	}))
+
+	err := m.Set("a", 1, 1)
+	c.Assert(err, Equals, nil)
+	err = m.Set("b", 2, 1)
+	c.Assert(err, Equals, nil)
+
+	c.Assert(m.Delete("a"), Equals, true)
+	c.Assert(m.Delete("a"), Equals, false)
+	c.Assert(m.Delete("c"), Equals, false)
+
+	_, exists := m.Get("a")
+	c.Assert(exists, Equals, false)
+
+	valI, exists := m.Get("b")
+	c.Assert(exists, Equals, true)
+	c.Assert(valI, Equals, 2)
+
+	c.Assert(len(m.elements), Equals, 1)
+	c.Assert(m.expiryTimes.Len(), Equals, 1)
+	c.Assert(called, Equals, false)
+}
+
+func (s *TestSuite) TestDeleteExpired(c *C) {
+	var expired []string
+	m := s.newMap(1, CallOnExpire(func(k string, el interface{}) {
+		expired = append(expired, k)
+	}))
+
+	err := m.Set("a", 1, 1)
+	c.Assert(err, Equals, nil)
+
+	s.advanceSeconds(1)
+
+	c.Assert(m.Delete("a"), Equals, false)
+	c.Assert(expired, DeepEquals, []string{"a"})
+	c.Assert(len(m.elements), Equals, 0)
+	c.Assert(m.expiryTimes.Len(), Equals, 0)
+}
+
+// Removing an expired element behaves the same whichever method removes it
+func (s *TestSuite) TestRemoveExpiredElementPaths(c *C) {
+	remove := map[string]func(m *TtlMap, key string){
+		"Delete":        func(m *TtlMap, key string) { m.Delete(key) },
+		"DeleteByBytes": func(m *TtlMap, key string) { m.DeleteByBytes([]byte(key)) },
+		"Pop":           func(m *TtlMap, key string) { m.Pop(key) },
+		"Get":           func(m *TtlMap, key string) { m.Get(key) },
+	}
+	for name, fn := range remove {
+		var expired []string
+		var reasons []RemovalReason
+		m := s.newMap(2, CallOnExpire(func(k string, el interface{}) {
+			expired = append(expired, k)
+		}), OnRemove(func(k string, el interface{}, reason RemovalReason) {
+			reasons = append(reasons, reason)
+		}))
+		m.Set("a", 1, 1)
+		s.advanceSeconds(1)
+
+		fn(m, "a")
+		c.Assert(expired, DeepEquals, []string{"a"}, Commentf(name))
+		c.Assert(reasons, DeepEquals, []RemovalReason{Expired}, Commentf(name))
+		c.Assert(m.Stats().Expirations, Equals, uint64(1), Commentf(name))
+		c.Assert(m.Len(), Equals, 0, Commentf(name))
+	}
+}
+
+func (s *TestSuite) TestKeys(c *C) {
+	m := s.newMap(3)
+	c.Assert(m.Keys(), DeepEquals, []string{})
+
+	m.Set("a", 1, 1)
+	m.Set("b", 2, 2)
+	m.Set("c", 3, 3)
+
+	keys := m.Keys()
+	sort.Strings(keys)
+	c.Assert(keys, DeepEquals, []string{"a", "b", "c"})
+
+	s.advanceSeconds(2)
+
+	c.Assert(m.Keys(), DeepEquals, []string{"c"})
+}
+
+func (s *TestSuite) TestItems(c *C) {
+	m := s.newMap(3)
+	c.Assert(m.Items(), DeepEquals, map[string]interface{}{})
+
+	m.Set("a", 1, 1)
+	m.Set("b", 2, 2)
+
+	items := m.Items()
+	c.Assert(items, DeepEquals, map[string]interface{}{"a": 1, "b": 2})
+
+	// The returned map is a copy
+	items["c"] = 3
+	c.Assert(m.Len(), Equals, 2)
+
+	s.advanceSeconds(1)
+
+	c.Assert(m.Items(), DeepEquals, map[string]interface{}{"b": 2})
+}
+
+func (s *TestSuite) TestValues(c *C) {
+	m := s.newMap(3)
+	c.Assert(m.Values(), DeepEquals, []interface{}{})
+
+	m.Set("a", 1, 1)
+	m.Set("b", 2, 2)
+
+	values := m.Values()
+	c.Assert(values, HasLen, 2)
+
+	s.advanceSeconds(1)
+
+	c.Assert(m.Values(), DeepEquals, []interface{}{2})
+}
+
+func (s *TestSuite) TestRange(c *C) {
+	m := s.newMap(3)
+
+	m.Set("a", 1, 1)
+	m.Set("b", 2, 2)
+	m.Set("c", 3, 3)
+
+	s.advanceSeconds(1)
+
+	items := make(map[string]interface{})
+	expires := make(map[string]time.Time)
+	m.Range(func(key string, value interface{}, expiresAt time.Time) bool {
+		items[key] = value
+		expires[key] = expiresAt
+		return true
+	})
+	c.Assert(items, DeepEquals, map[string]interface{}{"b": 2, "c": 3})
+	c.Assert(expires["b"], Equals, s.timeProvider.UtcNow().Add(time.Second))
+	c.Assert(expires["c"], Equals, s.timeProvider.UtcNow().Add(2*time.Second))
+}
+
+func (s *TestSuite) TestRangeStop(c *C) {
+	m := s.newMap(3)
+
+	m.Set("a", 1, 1)
+	m.Set("b", 2, 2)
+	m.Set("c", 3, 3)
+
+	calls := 0
+	m.Range(func(key string, value interface{}, expiresAt time.Time) bool {
+		calls += 1
+		return false
+	})
+	c.Assert(calls, Equals, 1)
+}
+
+func (s *TestSuite) TestClear(c *C) {
+	var called bool
+	m := s.newMap(2, CallOnExpire(func(k string, el interface{}) {
+		called = true
+	}))
+
+	m.Set("a", 1, 1)
+	m.Set("b", 2, 2)
+
+	m.Clear()
+
+	c.Assert(m.Len(), Equals, 0)
+	c.Assert(m.expiryTimes.Len(), Equals, 0)
+	_, exists := m.Get("a")
+	c.Assert(exists, Equals, false)
+	c.Assert(called, Equals, false)
+
+	// The map is still usable after being cleared
+	err := m.Set("c", 3, 1)
+	c.Assert(err, Equals, nil)
+
+	valI, exists := m.Get("c")
+	c.Assert(exists, Equals, true)
+	c.Assert(valI, Equals, 3)
+
+	s.advanceSeconds(1)
+
+	_, exists = m.Get("c")
+	c.Assert(exists, Equals, false)
+	c.Assert(called, Equals, true)
+}
+
+func (s *TestSuite) TestContains(c *C) {
+	m := s.newMap(1)
+	c.Assert(m.Contains("a"), Equals, false)
+
+	m.Set("a", 1, 1)
+	c.Assert(m.Contains("a"), Equals, true)
+	c.Assert(m.Contains("b"), Equals, false)
+
+	s.advanceSeconds(1)
+
+	c.Assert(m.Contains("a"), Equals, false)
+}
+
+func (s *TestSuite) TestExpiresAt(c *C) {
+	m := s.newMap(1)
+
+	_, exists := m.ExpiresAt("a")
+	c.Assert(exists, Equals, false)
+
+	m.Set("a", 1, 5)
+
+	expiresAt, exists := m.ExpiresAt("a")
+	c.Assert(exists, Equals, true)
+	c.Assert(expiresAt, Equals, s.timeProvider.UtcNow().Add(5*time.Second))
+
+	s.advanceSeconds(5)
+
+	_, exists = m.ExpiresAt("a")
+	c.Assert(exists, Equals, false)
+}
+
+func (s *TestSuite) TestNextExpiry(c *C) {
+	m := s.newMap(3)
+
+	_, _, _, ok := m.NextExpiry()
+	c.Assert(ok, Equals, false)
+
+	m.Set("p", 0, NoExpiration)
+	_, _, _, ok = m.NextExpiry()
+	c.Assert(ok, Equals, false)
+
+	m.Set("a", 1, 5)
+	m.Set("b", 2, 2)
+
+	key, value, at, ok := m.NextExpiry()
+	c.Assert(ok, Equals, true)
+	c.Assert(key, Equals, "b")
+	c.Assert(value, Equals, 2)
+	c.Assert(at, Equals, s.timeProvider.UtcNow().Add(2*time.Second))
+
+	// Expired elements are reported until they are removed
+	s.advanceSeconds(3)
+	key, _, _, ok = m.NextExpiry()
+	c.Assert(ok, Equals, true)
+	c.Assert(key, Equals, "b")
+
+	m.RemoveExpired(0)
+	key, _, _, ok = m.NextExpiry()
+	c.Assert(ok, Equals, true)
+	c.Assert(key, Equals, "a")
+}
+
+func (s *TestSuite) TestTouch(c *C) {
+	m := s.newMap(1)
+
+	c.Assert(m.Touch("a", 5), Equals, false)
+
+	m.Set("a", 1, 1)
+	c.Assert(m.Touch("a", 0), Equals, false)
+	c.Assert(m.Touch("a", 5), Equals, true)
+
+	s.advanceSeconds(1)
+
+	valI, exists := m.Get("a")
+	c.Assert(exists, Equals, true)
+	c.Assert(valI, Equals, 1)
+
+	s.advanceSeconds(4)
+
+	c.Assert(m.Touch("a", 5), Equals, false)
+	_, exists = m.Get("a")
+	c.Assert(exists, Equals, false)
+}
+
+func (s *TestSuite) TestGetWithTTL(c *C) {
+	m := s.newMap(1)
+
+	_, _, exists := m.GetWithTTL("a")
+	c.Assert(exists, Equals, false)
+
+	m.Set("a", 1, 5)
+
+	valI, ttl, exists := m.GetWithTTL("a")
+	c.Assert(exists, Equals, true)
+	c.Assert(valI, Equals, 1)
+	c.Assert(ttl, Equals, 5*time.Second)
+
+	s.advanceSeconds(3)
+
+	valI, ttl, exists = m.GetWithTTL("a")
+	c.Assert(exists, Equals, true)
+	c.Assert(valI, Equals, 1)
+	c.Assert(ttl, Equals, 2*time.Second)
+
+	s.advanceSeconds(2)
+
+	_, _, exists = m.GetWithTTL("a")
+	c.Assert(exists, Equals, false)
+	c.Assert(m.Len(), Equals, 0)
+}
+
+func (s *TestSuite) TestSetIfAbsent(c *C) {
+	m := s.newMap(1)
+
+	_, err := m.SetIfAbsent("a", 1, 0)
+	c.Assert(err, Not(Equals), nil)
+
+	set, err := m.SetIfAbsent("a", 1, 1)
+	c.Assert(err, Equals, nil)
+	c.Assert(set, Equals, true)
+
+	set, err = m.SetIfAbsent("a", 2, 5)
+	c.Assert(err, Equals, nil)
+	c.Assert(set, Equals, false)
+
+	valI, exists := m.Get("a")
+	c.Assert(exists, Equals, true)
+	c.Assert(valI, Equals, 1)
+
+	s.advanceSeconds(1)
+
+	set, err = m.SetIfAbsent("a", 3, 1)
+	c.Assert(err, Equals, nil)
+	c.Assert(set, Equals, true)
+
+	valI, exists = m.Get("a")
+	c.Assert(exists, Equals, true)
+	c.Assert(valI, Equals, 3)
+}
+
+func (s *TestSuite) TestReplace(c *C) {
+	m := s.newMap(1)
+
+	_, err := m.Replace("a", 1, 0)
+	c.Assert(err, Not(Equals), nil)
+
+	replaced, err := m.Replace("a", 1, 1)
+	c.Assert(err, Equals, nil)
+	c.Assert(replaced, Equals, false)
+	c.Assert(m.Len(), Equals, 0)
+
+	m.Set("a", 1, 1)
+
+	replaced, err = m.Replace("a", 2, 1)
+	c.Assert(err, Equals, nil)
+	c.Assert(replaced, Equals, true)
+
+	valI, exists := m.Get("a")
+	c.Assert(exists, Equals, true)
+	c.Assert(valI, Equals, 2)
+
+	s.advanceSeconds(1)
+
+	replaced, err = m.Replace("a", 3, 1)
+	c.Assert(err, Equals, nil)
+	c.Assert(replaced, Equals, false)
+
+	_, exists = m.Get("a")
+	c.Assert(exists, Equals, false)
+}
+
+func (s *TestSuite) TestCompareAndSwap(c *C) {
+	m := s.newMap(1)
+
+	swapped, err := m.CompareAndSwap("a", 1, 2, 1)
+	c.Assert(err, Equals, nil)
+	c.Assert(swapped, Equals, false)
+
+	m.Set("a", 1, 1)
+
+	_, err = m.CompareAndSwap("a", 1, 2, 0)
+	c.Assert(err, Not(Equals), nil)
+
+	swapped, err = m.CompareAndSwap("a", 3, 2, 1)
+	c.Assert(err, Equals, nil)
+	c.Assert(swapped, Equals, false)
+
+	swapped, err = m.CompareAndSwap("a", 1, 2, 1)
+	c.Assert(err, Equals, nil)
+	c.Assert(swapped, Equals, true)
+
+	valI, exists := m.Get("a")
+	c.Assert(exists, Equals, true)
+	c.Assert(valI, Equals, 2)
+
+	s.advanceSeconds(1)
+
+	swapped, err = m.CompareAndSwap("a", 2, 3, 1)
+	c.Assert(err, Equals, nil)
+	c.Assert(swapped, Equals, false)
+}
+
+func (s *TestSuite) TestCompareAndSwapNotComparable(c *C) {
+	m := s.newMap(1)
+
+	m.Set("a", []int{1}, 1)
+
+	_, err := m.CompareAndSwap("a", []int{1}, 2, 1)
+	c.Assert(err, Not(Equals), nil)
+
+	_, err = m.CompareAndSwap("a", 1, 2, 1)
+	c.Assert(err, Not(Equals), nil)
+}
+
+func (s *TestSuite) TestGetOrSet(c *C) {
+	m := s.newMap(1)
+
+	_, _, err := m.GetOrSet("a", 1, 0)
+	c.Assert(err, Not(Equals), nil)
+
+	actual, loaded, err := m.GetOrSet("a", 1, 1)
+	c.Assert(err, Equals, nil)
+	c.Assert(loaded, Equals, false)
+	c.Assert(actual, Equals, 1)
+
+	actual, loaded, err = m.GetOrSet("a", 2, 1)
+	c.Assert(err, Equals, nil)
+	c.Assert(loaded, Equals, true)
+	c.Assert(actual, Equals, 1)
+
+	s.advanceSeconds(1)
+
+	actual, loaded, err = m.GetOrSet("a", 3, 1)
+	c.Assert(err, Equals, nil)
+	c.Assert(loaded, Equals, false)
+	c.Assert(actual, Equals, 3)
+}
+
+func (s *TestSuite) TestPop(c *C) {
+	var expired []string
+	m := s.newMap(2, CallOnExpire(func(k string, el interface{}) {
+		expired = append(expired, k)
+	}))
+
+	_, exists := m.Pop("a")
+	c.Assert(exists, Equals, false)
+
+	m.Set("a", 1, 1)
+	m.Set("b", 2, 1)
+
+	valI, exists := m.Pop("a")
+	c.Assert(exists, Equals, true)
+	c.Assert(valI, Equals, 1)
+
+	_, exists = m.Pop("a")
+	c.Assert(exists, Equals, false)
+
+	s.advanceSeconds(1)
+
+	_, exists = m.Pop("b")
+	c.Assert(exists, Equals, false)
+	c.Assert(expired, DeepEquals, []string{"b"})
+	c.Assert(m.Len(), Equals, 0)
+	c.Assert(m.expiryTimes.Len(), Equals, 0)
+}
+
+func (s *TestSuite) TestUpdateFn(c *C) {
+	m := s.newMap(1)
+
+	appendFn := func(current interface{}, exists bool) (interface{}, error) {
+		if !exists {
+			return []string{"x"}, nil
+		}
+		return append(current.([]string), "y"), nil
+	}
+
+	err := m.Update("a", 0, appendFn)
+	c.Assert(err, Not(Equals), nil)
+
+	err = m.Update("a", 1, appendFn)
+	c.Assert(err, Equals, nil)
+	err = m.Update("a", 1, appendFn)
+	c.Assert(err, Equals, nil)
+
+	valI, exists := m.Get("a")
+	c.Assert(exists, Equals, true)
+	c.Assert(valI, DeepEquals, []string{"x", "y"})
+
+	s.advanceSeconds(1)
+
+	err = m.Update("a", 1, appendFn)
+	c.Assert(err, Equals, nil)
+
+	valI, exists = m.Get("a")
+	c.Assert(exists, Equals, true)
+	c.Assert(valI, DeepEquals, []string{"x"})
+}
+
+func (s *TestSuite) TestUpdateFnError(c *C) {
+	m := s.newMap(1)
+
+	m.Set("a", 1, 1)
+
+	err := m.Update("a", 5, func(current interface{}, exists bool) (interface{}, error) {
+		return nil, errors.New("boom")
+	})
+	c.Assert(err, ErrorMatches, "boom")
+
+	s.advanceSeconds(1)
+
+	_, exists := m.Get("a")
+	c.Assert(exists, Equals, false)
+}
+
+func (s *TestSuite) TestIncrementFloatGetExpire(c *C) {
+	m := s.newMap(1)
+
+	_, err := m.IncrementFloat("a", 0.5, 0)
+	c.Assert(err, Not(Equals), nil)
+
+	m.IncrementFloat("a", 0.5, 1)
+	val, exists, err := m.GetFloat("a")
+
+	c.Assert(err, Equals, nil)
+	c.Assert(exists, Equals, true)
+	c.Assert(val, Equals, 0.5)
+
+	m.IncrementFloat("a", 1.25, 1)
+	val, exists, err = m.GetFloat("a")
+
+	c.Assert(err, Equals, nil)
+	c.Assert(exists, Equals, true)
+	c.Assert(val, Equals, 1.75)
+
+	s.advanceSeconds(1)
+
+	m.IncrementFloat("a", 0.25, 1)
+	val, exists, err = m.GetFloat("a")
+
+	c.Assert(err, Equals, nil)
+	c.Assert(exists, Equals, true)
+	c.Assert(val, Equals, 0.25)
+}
+
+func (s *TestSuite) TestGetFloatInvalidType(c *C) {
+	m := s.newMap(1)
+
+	_, exists, err := m.GetFloat("a")
+	c.Assert(err, Equals, nil)
+	c.Assert(exists, Equals, false)
+
+	m.Set("a", 1, 5)
+
+	_, _, err = m.GetFloat("a")
+	c.Assert(err, Not(Equals), nil)
+
+	_, err = m.IncrementFloat("a", 4, 1)
+	c.Assert(err, Not(Equals), nil)
+}
+
+func (s *TestSuite) TestGetSetMany(c *C) {
+	var expired []string
+	m := s.newMap(3, CallOnExpire(func(k string, el interface{}) {
+		expired = append(expired, k)
+	}))
+
+	err := m.SetMany(map[string]interface{}{"a": 1, "b": 2}, 0)
+	c.Assert(err, Not(Equals), nil)
+	c.Assert(m.Len(), Equals, 0)
+
+	err = m.SetMany(map[string]interface{}{"a": 1, "b": 2}, 1)
+	c.Assert(err, Equals, nil)
+	err = m.SetMany(map[string]interface{}{"c": 3}, 2)
+	c.Assert(err, Equals, nil)
+
+	values := m.GetMany([]string{"a", "b", "c", "d"})
+	c.Assert(values, DeepEquals, map[string]interface{}{"a": 1, "b": 2, "c": 3})
+
+	s.advanceSeconds(1)
+
+	values = m.GetMany([]string{"a", "c"})
+	c.Assert(values, DeepEquals, map[string]interface{}{"c": 3})
+	c.Assert(expired, DeepEquals, []string{"a"})
+	c.Assert(m.Len(), Equals, 2)
+}
+
+func (s *TestSuite) TestSetWithExpireAt(c *C) {
+	m := s.newMap(1)
+
+	err := m.SetWithExpireAt("a", 1, s.timeProvider.UtcNow())
+	c.Assert(err, Not(Equals), nil)
+
+	err = m.SetWithExpireAt("a", 1, s.timeProvider.UtcNow().Add(-time.Second))
+	c.Assert(err, Not(Equals), nil)
+
+	expireAt := s.timeProvider.UtcNow().Add(3 * time.Second)
+	err = m.SetWithExpireAt("a", 1, expireAt)
+	c.Assert(err, Equals, nil)
+
+	at, exists := m.ExpiresAt("a")
+	c.Assert(exists, Equals, true)
+	c.Assert(at, Equals, expireAt)
+
+	s.advanceSeconds(2)
+
+	valI, exists := m.Get("a")
+	c.Assert(exists, Equals, true)
+	c.Assert(valI, Equals, 1)
+
+	s.advanceSeconds(1)
+
+	_, exists = m.Get("a")
+	c.Assert(exists, Equals, false)
+}
+
+func (s *TestSuite) TestRename(c *C) {
+	m := s.newMap(2)
+
+	c.Assert(m.Rename("a", "b"), Equals, false)
+
+	m.Set("a", 1, 3)
+	m.Set("b", 2, 1)
+
+	c.Assert(m.Rename("a", "a"), Equals, true)
+	c.Assert(m.Rename("a", "b"), Equals, true)
+
+	_, exists := m.Get("a")
+	c.Assert(exists, Equals, false)
+	c.Assert(m.Len(), Equals, 1)
+	c.Assert(m.expiryTimes.Len(), Equals, 1)
+
+	s.advanceSeconds(2)
+
+	valI, exists := m.Get("b")
+	c.Assert(exists, Equals, true)
+	c.Assert(valI, Equals, 1)
+
+	s.advanceSeconds(1)
+
+	_, exists = m.Get("b")
+	c.Assert(exists, Equals, false)
+	c.Assert(m.Rename("b", "c"), Equals, false)
+}
+
+func (s *TestSuite) TestRenameOverExpired(c *C) {
+	var expired []string
+	m := s.newMap(2, CallOnExpire(func(key string, value interface{}) {
+		expired = append(expired, key)
+	}))
+
+	m.Set("a", 1, 10)
+	m.Set("b", 2, 1)
+	s.advanceSeconds(1)
+
+	// An expired element under the new key is expired, not replaced
+	c.Assert(m.Rename("a", "b"), Equals, true)
+	c.Assert(expired, DeepEquals, []string{"b"})
+	c.Assert(m.Stats().Expirations, Equals, uint64(1))
+	value, _ := m.Get("b")
+	c.Assert(value, Equals, 1)
+}
+
+func (s *TestSuite) TestOldestNewest(c *C) {
+	m := s.newMap(3)
+
+	_, _, _, ok := m.Oldest()
+	c.Assert(ok, Equals, false)
+	_, _, _, ok = m.Newest()
+	c.Assert(ok, Equals, false)
+
+	start := s.timeProvider.UtcNow()
+	m.Set("a", 1, 1)
+	s.advanceSeconds(1)
+	m.Set("b", 2, 5)
+	s.advanceSeconds(1)
+	m.Set("c", 3, 5)
+
+	key, valI, createdAt, ok := m.Oldest()
+	c.Assert(ok, Equals, true)
+	c.Assert(key, Equals, "b")
+	c.Assert(valI, Equals, 2)
+	c.Assert(createdAt, Equals, start.Add(time.Second))
+
+	key, valI, createdAt, ok = m.Newest()
+	c.Assert(ok, Equals, true)
+	c.Assert(key, Equals, "c")
+	c.Assert(valI, Equals, 3)
+	c.Assert(createdAt, Equals, start.Add(2*time.Second))
+
+	// Overwriting does not change the insertion order
+	m.Set("b", 4, 5)
+	key, valI, _, _ = m.Oldest()
+	c.Assert(key, Equals, "b")
+	c.Assert(valI, Equals, 4)
+
+	m.Delete("c")
+	key, _, _, _ = m.Newest()
+	c.Assert(key, Equals, "b")
+}
+
+func (s *TestSuite) TestOldestAfterEviction(c *C) {
+	m := s.newMap(2)
+
+	m.Set("a", 1, 1)
+	m.Set("b", 2, 5)
+	m.Set("c", 3, 5)
+
+	key, _, _, ok := m.Oldest()
+	c.Assert(ok, Equals, true)
+	c.Assert(key, Equals, "b")
+	c.Assert(m.insertions.Len(), Equals, 2)
+}
+
+func (s *TestSuite) TestRemoveExpiredPublic(c *C) {
+	var expired []string
+	m := s.newMap(4, CallOnExpire(func(k string, el interface{}) {
+		expired = append(expired, k)
+	}))
+	c.Assert(m.RemoveExpired(0), HasLen, 0)
+
+	start := s.timeProvider.UtcNow()
+	m.Set("a", 1, 1)
+	m.Set("b", 2, 2)
+	m.Set("c", 3, 3)
+	m.Set("d", 4, 10)
+
+	s.advanceSeconds(3)
+
+	removed := m.RemoveExpired(2)
+	c.Assert(removed, DeepEquals, []ExpiredEntry{
+		{Key: "a", Value: 1, ExpiredAt: start.Add(time.Second)},
+		{Key: "b", Value: 2, ExpiredAt: start.Add(2 * time.Second)},
+	})
+	c.Assert(expired, DeepEquals, []string{"a", "b"})
+	c.Assert(m.Len(), Equals, 2)
+
+	removed = m.RemoveExpired(0)
+	c.Assert(removed, DeepEquals, []ExpiredEntry{
+		{Key: "c", Value: 3, ExpiredAt: start.Add(3 * time.Second)},
+	})
+	c.Assert(m.Len(), Equals, 1)
+	c.Assert(m.expiryTimes.Len(), Equals, 1)
+}
+
+func (s *TestSuite) TestLiveLen(c *C) {
+	m := s.newMap(10)
+	c.Assert(m.LiveLen(), Equals, 0)
+
+	for i := 1; i <= 10; i += 1 {
+		m.Set(string(rune('a'+i)), i, i)
+	}
+	c.Assert(m.LiveLen(), Equals, 10)
+
+	s.advanceSeconds(4)
+
+	c.Assert(m.Len(), Equals, 10)
+	c.Assert(m.LiveLen(), Equals, 6)
+
+	s.advanceSeconds(10)
+
+	c.Assert(m.LiveLen(), Equals, 0)
+}
+
+func (s *TestSuite) TestPreallocation(c *C) {
+	m := s.newMap(100)
+	c.Assert(cap(*m.expiryTimes.(*heapIndex).minHeap), Equals, 100)
+
+	m.Set("a", 1, 1)
+	m.Clear()
+	c.Assert(cap(*m.expiryTimes.(*heapIndex).minHeap), Equals, 100)
+
+	m = s.newMap(100, Sparse())
+	c.Assert(cap(*m.expiryTimes.(*heapIndex).minHeap), Equals, 0)
+	m.Set("a", 1, 1)
+	c.Assert(m.Len(), Equals, 1)
+
+	m = &TtlMap{capacity: maxPreallocated * 4}
+	c.Assert(m.preallocated(), Equals, maxPreallocated)
+}
+
+func (s *TestSuite) TestTTLHistogram(c *C) {
+	m := s.newMap(10)
+	buckets := []time.Duration{time.Second, 5 * time.Second}
+	c.Assert(m.TTLHistogram(buckets), DeepEquals, []int{0, 0, 0})
+
+	m.Set("a", 1, 1)
+	m.Set("b", 2, 2)
+	m.Set("c", 3, 5)
+	m.Set("d", 4, 6)
+	m.Set("e", 5, NoExpiration)
+	c.Assert(m.TTLHistogram(buckets), DeepEquals, []int{1, 2, 2})
+	c.Assert(m.TTLHistogram(nil), DeepEquals, []int{5})
+
+	s.advanceSeconds(1)
+	c.Assert(m.TTLHistogram(buckets), DeepEquals, []int{1, 2, 1})
+}
+
+func (s *TestSuite) TestGetTyped(c *C) {
+	m := s.newMap(3)
+
+	m.Set("s", "banana", 1)
+	m.Set("b", []byte("banana"), 1)
+	m.Set("t", true, 1)
+
+	str, exists, err := m.GetString("s")
+	c.Assert(err, Equals, nil)
+	c.Assert(exists, Equals, true)
+	c.Assert(str, Equals, "banana")
+
+	bytes, exists, err := m.GetBytes("b")
+	c.Assert(err, Equals, nil)
+	c.Assert(exists, Equals, true)
+	c.Assert(bytes, DeepEquals, []byte("banana"))
+
+	b, exists, err := m.GetBool("t")
+	c.Assert(err, Equals, nil)
+	c.Assert(exists, Equals, true)
+	c.Assert(b, Equals, true)
+
+	_, _, err = m.GetString("t")
+	c.Assert(err, Not(Equals), nil)
+	_, _, err = m.GetBytes("s")
+	c.Assert(err, Not(Equals), nil)
+	_, _, err = m.GetBool("b")
+	c.Assert(err, Not(Equals), nil)
+
+	s.advanceSeconds(1)
+
+	_, exists, err = m.GetString("s")
+	c.Assert(err, Equals, nil)
+	c.Assert(exists, Equals, false)
+	_, exists, err = m.GetBytes("b")
+	c.Assert(err, Equals, nil)
+	c.Assert(exists, Equals, false)
+	_, exists, err = m.GetBool("t")
+	c.Assert(err, Equals, nil)
+	c.Assert(exists, Equals, false)
+}
+
+func (s *TestSuite) TestAppend(c *C) {
+	m := s.newMap(3)
+
+	_, err := m.Append("b", []byte("x"), 0)
+	c.Assert(err, Not(Equals), nil)
+
+	data := []byte("ban")
+	n, err := m.Append("b", data, 1)
+	c.Assert(err, Equals, nil)
+	c.Assert(n, Equals, 3)
+
+	// The value does not alias the passed slice
+	data[0] = 'x'
+
+	n, err = m.Append("b", []byte("ana"), 1)
+	c.Assert(err, Equals, nil)
+	c.Assert(n, Equals, 6)
+
+	bytes, _, _ := m.GetBytes("b")
+	c.Assert(bytes, DeepEquals, []byte("banana"))
+
+	m.Set("s", "ban", 1)
+	n, err = m.Append("s", []byte("ana"), 1)
+	c.Assert(err, Equals, nil)
+	c.Assert(n, Equals, 6)
+
+	str, _, _ := m.GetString("s")
+	c.Assert(str, Equals, "banana")
+
+	m.Set("i", 1, 1)
+	_, err = m.Append("i", []byte("x"), 1)
+	c.Assert(err, Not(Equals), nil)
+
+	s.advanceSeconds(1)
+
+	n, err = m.Append("s", []byte("x"), 1)
+	c.Assert(err, Equals, nil)
+	c.Assert(n, Equals, 1)
+}
+
+func (s *TestSuite) TestExpire(c *C) {
+	var expired []string
+	m := s.newMap(2, CallOnExpire(func(k string, el interface{}) {
+		expired = append(expired, k)
+	}))
+
+	c.Assert(m.Expire("a"), Equals, false)
+
+	m.Set("a", 1, 10)
+	m.Set("b", 2, 1)
+
+	c.Assert(m.Expire("a"), Equals, true)
+	c.Assert(expired, DeepEquals, []string{"a"})
+
+	_, exists := m.Get("a")
+	c.Assert(exists, Equals, false)
+
+	s.advanceSeconds(1)
+
+	c.Assert(m.Expire("b"), Equals, false)
+	c.Assert(expired, DeepEquals, []string{"a", "b"})
+	c.Assert(m.Len(), Equals, 0)
+}
+
+func (s *TestSuite) TestPersist(c *C) {
+	m := s.newMap(2)
+
+	c.Assert(m.Persist("a"), Equals, false)
+
+	m.Set("a", 1, 1)
+	c.Assert(m.Persist("a"), Equals, true)
+
+	s.advanceSeconds(100000)
+
+	valI, ttl, exists := m.GetWithTTL("a")
+	c.Assert(exists, Equals, true)
+	c.Assert(valI, Equals, 1)
+	c.Assert(ttl, Equals, time.Duration(0))
+
+	expiresAt, exists := m.ExpiresAt("a")
+	c.Assert(exists, Equals, true)
+	c.Assert(expiresAt.IsZero(), Equals, true)
+
+	// Touch brings the ttl back
+	c.Assert(m.Touch("a", 1), Equals, true)
+	s.advanceSeconds(1)
+	c.Assert(m.Persist("a"), Equals, false)
+}
+
+func (s *TestSuite) TestPersistEvictedLast(c *C) {
+	m := s.newMap(2)
+
+	m.Set("a", 1, 1)
+	m.Persist("a")
+	m.Set("b", 2, 10)
+	m.Set("c", 3, 10)
+
+	_, exists := m.Get("a")
+	c.Assert(exists, Equals, true)
+	_, exists = m.Get("b")
+	c.Assert(exists, Equals, false)
+}
+
+func (s *TestSuite) TestRandomKey(c *C) {
+	m := s.newMap(3)
+
+	_, ok := m.RandomKey()
+	c.Assert(ok, Equals, false)
+
+	m.Set("a", 1, 1)
+	m.Set("b", 2, 2)
+	m.Set("c", 3, 1)
+
+	for i := 0; i < 10; i += 1 {
+		key, ok := m.RandomKey()
+		c.Assert(ok, Equals, true)
+		c.Assert(m.Contains(key), Equals, true)
+	}
+
+	s.advanceSeconds(1)
+
+	for i := 0; i < 10; i += 1 {
+		key, ok := m.RandomKey()
+		c.Assert(ok, Equals, true)
+		c.Assert(key, Equals, "b")
+	}
+
+	s.advanceSeconds(1)
+
+	_, ok = m.RandomKey()
+	c.Assert(ok, Equals, false)
+}
+
+func (s *TestSuite) TestRandomSample(c *C) {
+	m := s.newMap(10)
+
+	c.Assert(m.RandomSample(3), HasLen, 0)
+
+	for i := 0; i < 10; i += 1 {
+		m.Set(string(rune('a'+i)), i, 1+i%2)
+	}
+
+	sample := m.RandomSample(3)
+	c.Assert(sample, HasLen, 3)
+	seen := make(map[string]bool)
+	for _, key := range sample {
+		c.Assert(seen[key], Equals, false)
+		seen[key] = true
+	}
+
+	s.advanceSeconds(1)
+
+	sample = m.RandomSample(100)
+	sort.Strings(sample)
+	c.Assert(sample, DeepEquals, []string{"b", "d", "f", "h", "j"})
+	c.Assert(m.RandomSample(0), HasLen, 0)
+}
+
+func (s *TestSuite) TestSetCapacity(c *C) {
+	m := s.newMap(4)
+	c.Assert(m.Capacity(), Equals, 4)
+
+	c.Assert(m.SetCapacity(0), Not(Equals), nil)
+	c.Assert(m.Capacity(), Equals, 4)
+
+	m.Set("a", 1, 1)
+	m.Set("b", 2, 5)
+	m.Set("c", 3, 6)
+	m.Set("d", 4, 7)
+
+	s.advanceSeconds(1)
+
+	c.Assert(m.SetCapacity(2), Equals, nil)
+	c.Assert(m.Capacity(), Equals, 2)
+	c.Assert(m.Len(), Equals, 2)
+	c.Assert(m.Keys(), HasLen, 2)
+	c.Assert(m.Contains("c"), Equals, true)
+	c.Assert(m.Contains("d"), Equals, true)
+
+	c.Assert(m.SetCapacity(3), Equals, nil)
+	m.Set("e", 5, 5)
+	c.Assert(m.Len(), Equals, 3)
+}
+
+func (s *TestSuite) TestSetWithDuration(c *C) {
+	m := s.newMap(2)
+
+	err := m.SetWithDuration("a", 1, 0)
+	c.Assert(err, Not(Equals), nil)
+
+	err = m.SetWithDuration("a", 1, 250*time.Millisecond)
+	c.Assert(err, Equals, nil)
+	err = m.SetWithDuration("b", 2, 900*time.Millisecond)
+	c.Assert(err, Equals, nil)
+
+	s.advance(200 * time.Millisecond)
+
+	valI, ttl, exists := m.GetWithTTL("a")
+	c.Assert(exists, Equals, true)
+	c.Assert(valI, Equals, 1)
+	c.Assert(ttl, Equals, 50*time.Millisecond)
+
+	s.advance(50 * time.Millisecond)
+
+	_, exists = m.Get("a")
+	c.Assert(exists, Equals, false)
+	_, exists = m.Get("b")
+	c.Assert(exists, Equals, true)
+}
+
+// Expiry times are nanoseconds, which overflow 32 bit ints after about two
+// seconds, they must keep working on 32 bit platforms
+func (s *TestSuite) TestExpiryTimesOfLongLivedMap(c *C) {
+	m := s.newMap(2)
+	s.advance(365 * 24 * time.Hour)
+
+	m.Set("a", 1, 5)
+	m.Set("b", 2, 1000000)
+	s.advanceSeconds(1)
+	_, exists := m.Get("a")
+	c.Assert(exists, Equals, true)
+
+	s.advanceSeconds(5)
+	_, exists = m.Get("a")
+	c.Assert(exists, Equals, false)
+	_, ttl, exists := m.GetWithTTL("b")
+	c.Assert(exists, Equals, true)
+	c.Assert(ttl, Equals, (1000000-6)*time.Second)
+}
+
+func (s *TestSuite) TestIncrementTouchWithDuration(c *C) {
+	m := s.newMap(1)
+
+	_, err := m.IncrementWithDuration("a", 1, 0)
+	c.Assert(err, Not(Equals), nil)
+
+	val, err := m.IncrementWithDuration("a", 1, 100*time.Millisecond)
+	c.Assert(err, Equals, nil)
+	c.Assert(val, Equals, 1)
+
+	c.Assert(m.TouchWithDuration("a", 0), Equals, false)
+	c.Assert(m.TouchWithDuration("a", 500*time.Millisecond), Equals, true)
+
+	s.advance(400 * time.Millisecond)
+
+	val, err = m.IncrementWithDuration("a", 2, 100*time.Millisecond)
+	c.Assert(err, Equals, nil)
+	c.Assert(val, Equals, 3)
+
+	s.advance(100 * time.Millisecond)
+
+	_, exists, _ := m.GetInt("a")
+	c.Assert(exists, Equals, false)
+	c.Assert(m.TouchWithDuration("a", time.Second), Equals, false)
+}
+
+func (s *TestSuite) TestDefaultTTL(c *C) {
+	_, err := NewMap(1, DefaultTTL(0))
+	c.Assert(err, Not(Equals), nil)
+
+	m := s.newMap(1)
+	err = m.SetDefault("a", 1)
+	c.Assert(err, Not(Equals), nil)
+
+	m = s.newMap(1, DefaultTTL(2*time.Second))
+	err = m.SetDefault("a", 1)
+	c.Assert(err, Equals, nil)
+
+	s.advanceSeconds(1)
+
+	valI, exists := m.Get("a")
+	c.Assert(exists, Equals, true)
+	c.Assert(valI, Equals, 1)
+
+	s.advanceSeconds(1)
+
+	_, exists = m.Get("a")
+	c.Assert(exists, Equals, false)
+}
+
+func (s *TestSuite) TestSlidingExpiration(c *C) {
+	m := s.newMap(3, SlidingExpiration())
+
+	m.Set("a", 1, 2)
+	m.Set("b", 2, 2)
+	m.Set("c", 3, 2)
+	m.Persist("c")
+
+	for i := 0; i < 3; i += 1 {
+		s.advanceSeconds(1)
+		valI, exists := m.Get("a")
+		c.Assert(exists, Equals, true)
+		c.Assert(valI, Equals, 1)
+	}
+
+	_, exists := m.Get("b")
+	c.Assert(exists, Equals, false)
+
+	_, ttl, exists := m.GetWithTTL("a")
+	c.Assert(exists, Equals, true)
+	c.Assert(ttl, Equals, 2*time.Second)
+
+	_, ttl, exists = m.GetWithTTL("c")
+	c.Assert(exists, Equals, true)
+	c.Assert(ttl, Equals, time.Duration(0))
+
+	s.advanceSeconds(1)
+	c.Assert(m.GetMany([]string{"a"}), DeepEquals, map[string]interface{}{"a": 1})
+
+	s.advanceSeconds(2)
+
+	_, exists = m.Get("a")
+	c.Assert(exists, Equals, false)
+}
+
+func (s *TestSuite) TestSlidingExpirationTouch(c *C) {
+	m := s.newMap(1, SlidingExpiration())
+
+	m.Set("a", 1, 1)
+	m.Touch("a", 5)
+
+	s.advanceSeconds(4)
+	_, exists := m.Get("a")
+	c.Assert(exists, Equals, true)
+
+	s.advanceSeconds(4)
+	_, exists = m.Get("a")
+	c.Assert(exists, Equals, true)
+}
+
+func (s *TestSuite) TestNoSlidingExpiration(c *C) {
+	m := s.newMap(1)
+
+	m.Set("a", 1, 2)
+	s.advanceSeconds(1)
+	_, exists := m.Get("a")
+	c.Assert(exists, Equals, true)
+
+	s.advanceSeconds(1)
+	_, exists = m.Get("a")
+	c.Assert(exists, Equals, false)
+}
+
+func (s *TestSuite) TestTTLBoundsValidation(c *C) {
+	_, err := NewMap(1, MinTTL(0))
+	c.Assert(err, Not(Equals), nil)
+
+	_, err = NewMap(1, MaxTTL(-time.Second))
+	c.Assert(err, Not(Equals), nil)
+
+	_, err = NewMap(1, MinTTL(2*time.Second), MaxTTL(time.Second))
+	c.Assert(err, Not(Equals), nil)
+}
+
+func (s *TestSuite) TestTTLBounds(c *C) {
+	m := s.newMap(3, MinTTL(2*time.Second), MaxTTL(10*time.Second))
+
+	m.Set("a", 1, 1)
+	m.Set("b", 2, 1000)
+	m.SetWithExpireAt("c", 3, s.timeProvider.UtcNow().Add(time.Hour))
+
+	_, ttl, _ := m.GetWithTTL("a")
+	c.Assert(ttl, Equals, 2*time.Second)
+	_, ttl, _ = m.GetWithTTL("b")
+	c.Assert(ttl, Equals, 10*time.Second)
+	_, ttl, _ = m.GetWithTTL("c")
+	c.Assert(ttl, Equals, 10*time.Second)
+
+	m.Increment("a", 1, 5)
+	_, ttl, _ = m.GetWithTTL("a")
+	c.Assert(ttl, Equals, 5*time.Second)
+}
+
+func (s *TestSuite) TestTTLJitter(c *C) {
+	_, err := NewMap(1, TTLJitter(-0.1))
+	c.Assert(err, Not(Equals), nil)
+	_, err = NewMap(1, TTLJitter(1))
+	c.Assert(err, Not(Equals), nil)
+
+	m := s.newMap(100, TTLJitter(0.1))
+
+	ttls := make(map[time.Duration]bool)
+	for i := 0; i < 100; i += 1 {
+		key := fmt.Sprintf("k%d", i)
+		m.Set(key, i, 100)
+		_, ttl, exists := m.GetWithTTL(key)
+		c.Assert(exists, Equals, true)
+		c.Assert(ttl >= 90*time.Second, Equals, true)
+		c.Assert(ttl <= 110*time.Second, Equals, true)
+		ttls[ttl] = true
+	}
+	c.Assert(len(ttls) > 1, Equals, true)
+}
+
+func (s *TestSuite) TestNoExpiration(c *C) {
+	m := s.newMap(2)
+
+	err := m.Set("a", 1, NoExpiration)
+	c.Assert(err, Equals, nil)
+	err = m.SetWithDuration("b", 2, NoExpiration)
+	c.Assert(err, Equals, nil)
+	_, err = m.Increment("c", 3, NoExpiration)
+	c.Assert(err, Equals, nil)
+
+	s.advanceSeconds(100000)
+
+	c.Assert(m.LiveLen(), Equals, 2)
+	c.Assert(m.RemoveExpired(0), HasLen, 0)
+
+	_, ttl, exists := m.GetWithTTL("b")
+	c.Assert(exists, Equals, true)
+	c.Assert(ttl, Equals, time.Duration(0))
+
+	valI, exists, err := m.GetInt("c")
+	c.Assert(err, Equals, nil)
+	c.Assert(exists, Equals, true)
+	c.Assert(valI, Equals, 3)
+
+	// Elements with a ttl are evicted before the never expiring ones
+	m.Set("d", 4, 1)
+	m.Set("e", 5, 1)
+	c.Assert(m.Contains("c"), Equals, true)
+	c.Assert(m.Contains("d"), Equals, false)
+}
+
+func (s *TestSuite) TestNoExpirationMaxTTL(c *C) {
+	m := s.newMap(1, MaxTTL(10*time.Second))
+
+	err := m.Set("a", 1, NoExpiration)
+	c.Assert(err, Equals, nil)
+
+	_, ttl, _ := m.GetWithTTL("a")
+	c.Assert(ttl, Equals, 10*time.Second)
+}
+
+func (s *TestSuite) TestPurgeOnWrite(c *C) {
+	_, err := NewMap(1, PurgeOnWrite(0))
+	c.Assert(err, Not(Equals), nil)
+
+	var expired []string
+	m := s.newMap(10, PurgeOnWrite(2), CallOnExpire(func(k string, el interface{}) {
+		expired = append(expired, k)
+	}))
+
+	m.Set("a", 1, 1)
+	m.Set("b", 2, 2)
+	m.Set("c", 3, 3)
+	m.Set("d", 4, 10)
+
+	s.advanceSeconds(3)
+
+	m.Set("e", 5, 10)
+	c.Assert(expired, DeepEquals, []string{"a", "b"})
+	c.Assert(m.Len(), Equals, 3)
+
+	m.Increment("f", 1, 10)
+	c.Assert(expired, DeepEquals, []string{"a", "b", "c"})
+	c.Assert(m.Len(), Equals, 3)
+}
+
+func (s *TestSuite) TestMonotonicClock(c *C) {
+	m, err := NewMap(1)
+	c.Assert(err, Equals, nil)
+
+	// Readings that carry the monotonic clock print it as "m=+..."
+	c.Assert(m.monotonic, Equals, true)
+	c.Assert(m.base.String(), Matches, ".*m=[+-].*")
+
+	err = m.SetWithDuration("a", 1, time.Hour)
+	c.Assert(err, Equals, nil)
+
+	_, ttl, exists := m.GetWithTTL("a")
+	c.Assert(exists, Equals, true)
+	c.Assert(ttl > 59*time.Minute, Equals, true)
+	c.Assert(ttl <= time.Hour, Equals, true)
+
+	expiresAt, _ := m.ExpiresAt("a")
+	c.Assert(expiresAt.Location(), Equals, time.UTC)
+}
+
+func (s *TestSuite) TestClockProviderNotMonotonic(c *C) {
+	m := s.newMap(1)
+	c.Assert(m.monotonic, Equals, false)
+	c.Assert(m.base, Equals, s.timeProvider.UtcNow())
+}
+
+func (s *TestSuite) TestGetStale(c *C) {
+	_, err := NewMap(1, StaleGracePeriod(0))
+	c.Assert(err, Not(Equals), nil)
+
+	var expired []string
+	m := s.newMap(2, StaleGracePeriod(2*time.Second), CallOnExpire(func(k string, el interface{}) {
+		expired = append(expired, k)
+	}))
+
+	_, _, ok := m.GetStale("a")
+	c.Assert(ok, Equals, false)
+
+	m.Set("a", 1, 1)
+
+	valI, stale, ok := m.GetStale("a")
+	c.Assert(ok, Equals, true)
+	c.Assert(stale, Equals, false)
+	c.Assert(valI, Equals, 1)
+
+	s.advanceSeconds(1)
+
+	_, exists := m.Get("a")
+	c.Assert(exists, Equals, false)
+	c.Assert(m.RemoveExpired(0), HasLen, 0)
+
+	valI, stale, ok = m.GetStale("a")
+	c.Assert(ok, Equals, true)
+	c.Assert(stale, Equals, true)
+	c.Assert(valI, Equals, 1)
+	c.Assert(expired, HasLen, 0)
+
+	s.advanceSeconds(2)
+
+	_, _, ok = m.GetStale("a")
+	c.Assert(ok, Equals, false)
+	c.Assert(expired, DeepEquals, []string{"a"})
+	c.Assert(m.Len(), Equals, 0)
+}
+
+func (s *TestSuite) TestStaleGracePeriodReap(c *C) {
+	m := s.newMap(2, StaleGracePeriod(2*time.Second))
+
+	m.Set("a", 1, 1)
+	s.advanceSeconds(2)
+	c.Assert(m.RemoveExpired(0), HasLen, 0)
+
+	s.advanceSeconds(1)
+	c.Assert(m.RemoveExpired(0), HasLen, 1)
+}
+
+func (s *TestSuite) TestSubSecondPrecision(c *C) {
+	m := s.newMap(2)
+
+	m.Set("a", 1, 1)
+	s.advance(900 * time.Millisecond)
+	m.Set("b", 2, 1)
+
+	expiresA, _ := m.ExpiresAt("a")
+	expiresB, _ := m.ExpiresAt("b")
+	c.Assert(expiresB.Sub(expiresA), Equals, 900*time.Millisecond)
+
+	// A 1 second ttl lasts exactly 1 second
+	s.advance(100 * time.Millisecond)
+	c.Assert(m.Contains("a"), Equals, false)
+	s.advance(899 * time.Millisecond)
+	c.Assert(m.Contains("b"), Equals, true)
+	s.advance(time.Millisecond)
+	c.Assert(m.Contains("b"), Equals, false)
+}
+
+func (s *TestSuite) TestExpiryGranularity(c *C) {
+	_, err := NewMap(1, ExpiryGranularity(0))
+	c.Assert(err, Not(Equals), nil)
+
+	m := s.newMap(2, ExpiryGranularity(time.Second))
+	start := s.timeProvider.UtcNow()
+
+	m.SetWithDuration("a", 1, 200*time.Millisecond)
+	expiresAt, _ := m.ExpiresAt("a")
+	c.Assert(expiresAt, Equals, start.Add(time.Second))
+
+	s.advance(300 * time.Millisecond)
+
+	// Still in the same window, the deadline does not move
+	m.SetWithDuration("a", 2, 200*time.Millisecond)
+	expiresAt, _ = m.ExpiresAt("a")
+	c.Assert(expiresAt, Equals, start.Add(time.Second))
+
+	m.TouchWithDuration("a", time.Second)
+	expiresAt, _ = m.ExpiresAt("a")
+	c.Assert(expiresAt, Equals, start.Add(2*time.Second))
+
+	m.SetWithExpireAt("b", 1, start.Add(2500*time.Millisecond))
+	expiresAt, _ = m.ExpiresAt("b")
+	c.Assert(expiresAt, Equals, start.Add(3*time.Second))
+}
+
+func (s *TestSuite) TestRoundExpiryTime(c *C) {
+	m := s.newMap(1, ExpiryGranularity(10))
+	c.Assert(m.roundExpiryTime(0), Equals, int64(0))
+	c.Assert(m.roundExpiryTime(1), Equals, int64(10))
+	c.Assert(m.roundExpiryTime(10), Equals, int64(10))
+	c.Assert(m.roundExpiryTime(-1), Equals, int64(0))
+	c.Assert(m.roundExpiryTime(-11), Equals, int64(-10))
+}
+
+func (s *TestSuite) TestIncrementKeepTTL(c *C) {
+	m := s.newMap(1)
+
+	_, err := m.IncrementKeepTTL("a", 1, 0)
+	c.Assert(err, Not(Equals), nil)
+
+	val, err := m.IncrementKeepTTL("a", 1, 2)
+	c.Assert(err, Equals, nil)
+	c.Assert(val, Equals, 1)
+
+	s.advanceSeconds(1)
+
+	val, err = m.IncrementKeepTTL("a", 1, 2)
+	c.Assert(err, Equals, nil)
+	c.Assert(val, Equals, 2)
+
+	s.advanceSeconds(1)
+
+	// The window closed at the initially scheduled time
+	_, exists, _ := m.GetInt("a")
+	c.Assert(exists, Equals, false)
+
+	val, err = m.IncrementKeepTTL("a", 5, 2)
+	c.Assert(err, Equals, nil)
+	c.Assert(val, Equals, 5)
+
+	m.Set("a", "banana", 1)
+	_, err = m.IncrementKeepTTL("a", 1, 2)
+	c.Assert(err, Not(Equals), nil)
+}
+
+func (s *TestSuite) TestSetKeepTTL(c *C) {
+	m := s.newMap(1)
+
+	c.Assert(m.SetKeepTTL("a", 1), Equals, false)
+	c.Assert(m.Len(), Equals, 0)
+
+	m.Set("a", 1, 2)
+	s.advanceSeconds(1)
+
+	c.Assert(m.SetKeepTTL("a", 2), Equals, true)
+
+	valI, ttl, exists := m.GetWithTTL("a")
+	c.Assert(exists, Equals, true)
+	c.Assert(valI, Equals, 2)
+	c.Assert(ttl, Equals, time.Second)
+
+	s.advanceSeconds(1)
+
+	c.Assert(m.SetKeepTTL("a", 3), Equals, false)
+}
@@ -0,0 +1,85 @@
+// Package ttlmapotel reports the statistics of ttlmap maps as OpenTelemetry
+// metrics. It lives apart from ttlmap, so the map itself does not depend on
+// OpenTelemetry.
+package ttlmapotel
+
+import (
+	"context"
+
+	"github.com/mailgun/ttlmap"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// ScopeName is the instrumentation scope of the meter the instruments are
+// created with
+const ScopeName = "github.com/mailgun/ttlmap/ttlmapotel"
+
+// Source is a map with statistics, such as ttlmap.TtlMap and
+// ttlmap.ShardedMap
+type Source interface {
+	Stats() ttlmap.Stats
+	Capacity() int
+}
+
+// Register creates asynchronous instruments for the statistics of the map
+// with the given provider. The measurements carry the attribute map="name"
+// followed by attrs, and are read from Stats on every collection. Unregister
+// the returned registration to stop reporting the map.
+func Register(provider metric.MeterProvider, name string, source Source, attrs ...attribute.KeyValue) (metric.Registration, error) {
+	meter := provider.Meter(ScopeName)
+
+	size, err := meter.Int64ObservableGauge("ttlmap.size",
+		metric.WithDescription("Number of elements in the map, including expired ones not removed yet."),
+		metric.WithUnit("{element}"))
+	if err != nil {
+		return nil, err
+	}
+	capacity, err := meter.Int64ObservableGauge("ttlmap.capacity",
+		metric.WithDescription("Maximum number of elements in the map."),
+		metric.WithUnit("{element}"))
+	if err != nil {
+		return nil, err
+	}
+	counter := func(name, description, unit string) (metric.Int64ObservableCounter, error) {
+		return meter.Int64ObservableCounter(name, metric.WithDescription(description), metric.WithUnit(unit))
+	}
+	hits, err := counter("ttlmap.hits", "Lookups that found a live element.", "{lookup}")
+	if err != nil {
+		return nil, err
+	}
+	misses, err := counter("ttlmap.misses", "Lookups that found no live element.", "{lookup}")
+	if err != nil {
+		return nil, err
+	}
+	sets, err := counter("ttlmap.sets", "Values written to the map.", "{value}")
+	if err != nil {
+		return nil, err
+	}
+	deletes, err := counter("ttlmap.deletes", "Elements deleted from the map.", "{element}")
+	if err != nil {
+		return nil, err
+	}
+	expirations, err := counter("ttlmap.expirations", "Elements removed because they expired.", "{element}")
+	if err != nil {
+		return nil, err
+	}
+	evictions, err := counter("ttlmap.evictions", "Elements evicted to make room for other elements.", "{element}")
+	if err != nil {
+		return nil, err
+	}
+
+	attributes := metric.WithAttributes(append([]attribute.KeyValue{attribute.String("map", name)}, attrs...)...)
+	return meter.RegisterCallback(func(ctx context.Context, o metric.Observer) error {
+		stats := source.Stats()
+		o.ObserveInt64(size, int64(stats.Len), attributes)
+		o.ObserveInt64(capacity, int64(source.Capacity()), attributes)
+		o.ObserveInt64(hits, int64(stats.Hits), attributes)
+		o.ObserveInt64(misses, int64(stats.Misses), attributes)
+		o.ObserveInt64(sets, int64(stats.Sets), attributes)
+		o.ObserveInt64(deletes, int64(stats.Deletes), attributes)
+		o.ObserveInt64(expirations, int64(stats.Expirations), attributes)
+		o.ObserveInt64(evictions, int64(stats.CapacityEvictions), attributes)
+		return nil
+	}, size, capacity, hits, misses, sets, deletes, expirations, evictions)
+}
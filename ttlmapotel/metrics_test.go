@@ -0,0 +1,83 @@
+package ttlmapotel
+
+import (
+	"context"
+	"testing"
+
+	"github.com/mailgun/ttlmap"
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	. "gopkg.in/check.v1"
+)
+
+func Test(t *testing.T) { TestingT(t) }
+
+type TestSuite struct{}
+
+var _ = Suite(&TestSuite{})
+
+// collect returns the data points of the ttlmap instruments by name
+func collect(c *C, reader *sdkmetric.ManualReader) map[string]metricdata.DataPoint[int64] {
+	var rm metricdata.ResourceMetrics
+	c.Assert(reader.Collect(context.Background(), &rm), IsNil)
+
+	points := make(map[string]metricdata.DataPoint[int64])
+	for _, scope := range rm.ScopeMetrics {
+		if scope.Scope.Name != ScopeName {
+			continue
+		}
+		for _, m := range scope.Metrics {
+			switch data := m.Data.(type) {
+			case metricdata.Gauge[int64]:
+				c.Assert(data.DataPoints, HasLen, 1)
+				points[m.Name] = data.DataPoints[0]
+			case metricdata.Sum[int64]:
+				c.Assert(data.IsMonotonic, Equals, true)
+				c.Assert(data.DataPoints, HasLen, 1)
+				points[m.Name] = data.DataPoints[0]
+			}
+		}
+	}
+	return points
+}
+
+func (s *TestSuite) TestRegister(c *C) {
+	reader := sdkmetric.NewManualReader()
+	provider := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+
+	m, err := ttlmap.NewMap(2)
+	c.Assert(err, IsNil)
+	registration, err := Register(provider, "sessions", m, attribute.String("service", "api"))
+	c.Assert(err, IsNil)
+
+	m.Set("a", 1, 10)
+	m.Set("b", 1, 10)
+	m.Set("c", 1, 10)
+	m.Get("c")
+	m.Get("missing")
+	m.Delete("c")
+
+	points := collect(c, reader)
+	values := make(map[string]int64)
+	for name, point := range points {
+		values[name] = point.Value
+	}
+	c.Assert(values, DeepEquals, map[string]int64{
+		"ttlmap.size":        1,
+		"ttlmap.capacity":    2,
+		"ttlmap.hits":        1,
+		"ttlmap.misses":      1,
+		"ttlmap.sets":        3,
+		"ttlmap.deletes":     1,
+		"ttlmap.expirations": 0,
+		"ttlmap.evictions":   1,
+	})
+	name, _ := points["ttlmap.size"].Attributes.Value("map")
+	c.Assert(name.AsString(), Equals, "sessions")
+	service, _ := points["ttlmap.hits"].Attributes.Value("service")
+	c.Assert(service.AsString(), Equals, "api")
+
+	c.Assert(registration.Unregister(), IsNil)
+	c.Assert(collect(c, reader), HasLen, 0)
+}
@@ -0,0 +1,82 @@
+// Package ttlmapprom exports the statistics of ttlmap maps as Prometheus
+// metrics. It lives apart from ttlmap, so the map itself does not depend on
+// the Prometheus client.
+package ttlmapprom
+
+import (
+	"github.com/mailgun/ttlmap"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Source is a map with statistics, such as ttlmap.TtlMap and
+// ttlmap.ShardedMap
+type Source interface {
+	Stats() ttlmap.Stats
+	Capacity() int
+}
+
+type collector struct {
+	source Source
+
+	size        *prometheus.Desc
+	capacity    *prometheus.Desc
+	hits        *prometheus.Desc
+	misses      *prometheus.Desc
+	hitRatio    *prometheus.Desc
+	sets        *prometheus.Desc
+	deletes     *prometheus.Desc
+	expirations *prometheus.Desc
+	evictions   *prometheus.Desc
+}
+
+// Collector returns a collector of the statistics of the map, labeled with
+// map="name" so the metrics of several maps can be told apart. The metrics
+// are read from Stats on every scrape.
+func Collector(name string, source Source) prometheus.Collector {
+	labels := prometheus.Labels{"map": name}
+	desc := func(metric, help string) *prometheus.Desc {
+		return prometheus.NewDesc(prometheus.BuildFQName("ttlmap", "", metric), help, nil, labels)
+	}
+	return &collector{
+		source:      source,
+		size:        desc("size", "Number of elements in the map, including expired ones not removed yet."),
+		capacity:    desc("capacity", "Maximum number of elements in the map."),
+		hits:        desc("hits_total", "Lookups that found a live element."),
+		misses:      desc("misses_total", "Lookups that found no live element."),
+		hitRatio:    desc("hit_ratio", "Share of the lookups that found a live element since the map was created."),
+		sets:        desc("sets_total", "Values written to the map."),
+		deletes:     desc("deletes_total", "Elements deleted from the map."),
+		expirations: desc("expirations_total", "Elements removed because they expired."),
+		evictions:   desc("evictions_total", "Elements evicted to make room for other elements."),
+	}
+}
+
+func (c *collector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.size
+	ch <- c.capacity
+	ch <- c.hits
+	ch <- c.misses
+	ch <- c.hitRatio
+	ch <- c.sets
+	ch <- c.deletes
+	ch <- c.expirations
+	ch <- c.evictions
+}
+
+func (c *collector) Collect(ch chan<- prometheus.Metric) {
+	stats := c.source.Stats()
+	hitRatio := 0.0
+	if lookups := stats.Hits + stats.Misses; lookups > 0 {
+		hitRatio = float64(stats.Hits) / float64(lookups)
+	}
+
+	ch <- prometheus.MustNewConstMetric(c.size, prometheus.GaugeValue, float64(stats.Len))
+	ch <- prometheus.MustNewConstMetric(c.capacity, prometheus.GaugeValue, float64(c.source.Capacity()))
+	ch <- prometheus.MustNewConstMetric(c.hits, prometheus.CounterValue, float64(stats.Hits))
+	ch <- prometheus.MustNewConstMetric(c.misses, prometheus.CounterValue, float64(stats.Misses))
+	ch <- prometheus.MustNewConstMetric(c.hitRatio, prometheus.GaugeValue, hitRatio)
+	ch <- prometheus.MustNewConstMetric(c.sets, prometheus.CounterValue, float64(stats.Sets))
+	ch <- prometheus.MustNewConstMetric(c.deletes, prometheus.CounterValue, float64(stats.Deletes))
+	ch <- prometheus.MustNewConstMetric(c.expirations, prometheus.CounterValue, float64(stats.Expirations))
+	ch <- prometheus.MustNewConstMetric(c.evictions, prometheus.CounterValue, float64(stats.CapacityEvictions))
+}
@@ -0,0 +1,64 @@
+package ttlmapprom
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/mailgun/ttlmap"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	. "gopkg.in/check.v1"
+)
+
+func Test(t *testing.T) { TestingT(t) }
+
+type TestSuite struct{}
+
+var _ = Suite(&TestSuite{})
+
+func (s *TestSuite) TestCollector(c *C) {
+	m, err := ttlmap.NewMap(2)
+	c.Assert(err, IsNil)
+	collector := Collector("sessions", m)
+
+	c.Assert(testutil.CollectAndCompare(collector, strings.NewReader(`
+# HELP ttlmap_hit_ratio Share of the lookups that found a live element since the map was created.
+# TYPE ttlmap_hit_ratio gauge
+ttlmap_hit_ratio{map="sessions"} 0
+`), "ttlmap_hit_ratio"), IsNil)
+
+	m.Set("a", 1, 10)
+	m.Set("b", 1, 10)
+	m.Set("c", 1, 10)
+	m.Get("c")
+	m.Get("a")
+	m.Delete("c")
+
+	c.Assert(testutil.CollectAndCompare(collector, strings.NewReader(`
+# HELP ttlmap_capacity Maximum number of elements in the map.
+# TYPE ttlmap_capacity gauge
+ttlmap_capacity{map="sessions"} 2
+# HELP ttlmap_deletes_total Elements deleted from the map.
+# TYPE ttlmap_deletes_total counter
+ttlmap_deletes_total{map="sessions"} 1
+# HELP ttlmap_evictions_total Elements evicted to make room for other elements.
+# TYPE ttlmap_evictions_total counter
+ttlmap_evictions_total{map="sessions"} 1
+# HELP ttlmap_hit_ratio Share of the lookups that found a live element since the map was created.
+# TYPE ttlmap_hit_ratio gauge
+ttlmap_hit_ratio{map="sessions"} 0.5
+# HELP ttlmap_hits_total Lookups that found a live element.
+# TYPE ttlmap_hits_total counter
+ttlmap_hits_total{map="sessions"} 1
+# HELP ttlmap_misses_total Lookups that found no live element.
+# TYPE ttlmap_misses_total counter
+ttlmap_misses_total{map="sessions"} 1
+# HELP ttlmap_size Number of elements in the map, including expired ones not removed yet.
+# TYPE ttlmap_size gauge
+ttlmap_size{map="sessions"} 1
+`), "ttlmap_capacity", "ttlmap_deletes_total", "ttlmap_evictions_total", "ttlmap_hit_ratio",
+		"ttlmap_hits_total", "ttlmap_misses_total", "ttlmap_size"), IsNil)
+
+	sharded, err := ttlmap.NewSharded(16)
+	c.Assert(err, IsNil)
+	c.Assert(testutil.CollectAndCount(Collector("sharded", sharded)), Equals, 9)
+}
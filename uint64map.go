@@ -0,0 +1,327 @@
+package ttlmap
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/mailgun/timetools"
+)
+
+// Uint64Map is a map keyed by uint64, e.g. by ids or hashes. Keys are hashed
+// as integers and stored inline in the elements, which saves the string
+// hashing and the key allocations of a TtlMap. It covers the core of TtlMap
+// only: elements expire lazily on reads or with RemoveExpired, and the
+// soonest expiring element is evicted when the map is full. The expiration
+// callback fires on the same paths as for TtlMap: reads, Delete and
+// RemoveExpired call it for the expired elements they find, overwriting an
+// expired element and evicting one for capacity do not.
+type Uint64Map struct {
+	capacity    int
+	elements    map[uint64]*uint64Element
+	expiryTimes *minHeap
+	clock       timetools.TimeProvider
+	mutex       *sync.RWMutex
+	onExpire    func(key uint64, value interface{})
+	// base is the instant expiry times are measured from, as for TtlMap
+	base      time.Time
+	monotonic bool
+}
+
+type uint64Element struct {
+	key    uint64
+	value  interface{}
+	heapEl heapElement
+}
+
+type Uint64MapOption func(m *Uint64Map) error
+
+// Uint64Clock sets the clock of a Uint64Map, see Clock
+func Uint64Clock(c timetools.TimeProvider) Uint64MapOption {
+	return func(m *Uint64Map) error {
+		if c == nil {
+			return errors.New("Please pass clock")
+		}
+		m.clock = c
+		return nil
+	}
+}
+
+// Uint64OnExpire sets the callback called with the expired elements of a
+// Uint64Map, see CallOnExpire
+func Uint64OnExpire(cb func(key uint64, value interface{})) Uint64MapOption {
+	return func(m *Uint64Map) error {
+		m.onExpire = cb
+		return nil
+	}
+}
+
+func NewUint64Map(capacity int, opts ...Uint64MapOption) (*Uint64Map, error) {
+	return newUint64Map(capacity, false, opts...)
+}
+
+func NewConcurrentUint64Map(capacity int, opts ...Uint64MapOption) (*Uint64Map, error) {
+	return newUint64Map(capacity, true, opts...)
+}
+
+func newUint64Map(capacity int, concurrent bool, opts ...Uint64MapOption) (*Uint64Map, error) {
+	if capacity <= 0 {
+		return nil, errors.New("Capacity should be > 0")
+	}
+	m := &Uint64Map{capacity: capacity}
+	for _, o := range opts {
+		if err := o(m); err != nil {
+			return nil, err
+		}
+	}
+	if concurrent {
+		m.mutex = &sync.RWMutex{}
+	}
+	size := capacity
+	if size > maxPreallocated {
+		size = maxPreallocated
+	}
+	m.elements = make(map[uint64]*uint64Element, size)
+	h := make(minHeap, 0, size)
+	m.expiryTimes = &h
+	if m.clock == nil {
+		m.clock = &timetools.RealTime{}
+		m.monotonic = true
+	}
+	m.base = m.currentTime()
+	return m, nil
+}
+
+func (m *Uint64Map) Set(key uint64, value interface{}, ttlSeconds int) error {
+	if ttlSeconds == NoExpiration {
+		return m.SetWithDuration(key, value, NoExpiration)
+	}
+	if ttlSeconds <= 0 {
+		return fmt.Errorf("ttlSeconds should be >= 0, got %d", ttlSeconds)
+	}
+	return m.SetWithDuration(key, value, time.Second*time.Duration(ttlSeconds))
+}
+
+// SetWithDuration is like Set but accepts a ttl with sub-second precision
+func (m *Uint64Map) SetWithDuration(key uint64, value interface{}, ttl time.Duration) error {
+	if ttl != NoExpiration && ttl <= 0 {
+		return fmt.Errorf("ttl should be > 0, got %v", ttl)
+	}
+	if m.mutex != nil {
+		m.mutex.Lock()
+		defer m.mutex.Unlock()
+	}
+
+	now := m.now()
+	expiryTime := neverExpires
+	if ttl != NoExpiration {
+		expiryTime = now + int64(ttl)
+	}
+	if el, ok := m.elements[key]; ok {
+		el.value = value
+		m.expiryTimes.UpdateEl(&el.heapEl, expiryTime)
+		return nil
+	}
+	m.insert(key, value, expiryTime)
+	return nil
+}
+
+func (m *Uint64Map) Get(key uint64) (interface{}, bool) {
+	value, _, ok := m.GetWithTTL(key)
+	return value, ok
+}
+
+// GetWithTTL returns the value of the element along with the time left
+// before it expires, the ttl is 0 for persisted elements
+func (m *Uint64Map) GetWithTTL(key uint64) (interface{}, time.Duration, bool) {
+	value, expiryTime, found := m.lockNGet(key)
+	if !found {
+		return nil, 0, false
+	}
+	now := m.now()
+	if expiryTime <= now {
+		m.lockNExpire(key, now)
+		return nil, 0, false
+	}
+	if expiryTime == neverExpires {
+		return value, 0, true
+	}
+	return value, time.Duration(expiryTime - now), true
+}
+
+// Contains reports whether an element with the given key exists and has not
+// expired yet
+func (m *Uint64Map) Contains(key uint64) bool {
+	_, expiryTime, found := m.lockNGet(key)
+	return found && expiryTime > m.now()
+}
+
+// Increment adds value to the integer stored with the given key, or sets it
+// if there is no live element, and resets the ttl
+func (m *Uint64Map) Increment(key uint64, value int, ttlSeconds int) (int, error) {
+	if ttlSeconds <= 0 && ttlSeconds != NoExpiration {
+		return 0, fmt.Errorf("ttlSeconds should be >= 0, got %d", ttlSeconds)
+	}
+	if m.mutex != nil {
+		m.mutex.Lock()
+		defer m.mutex.Unlock()
+	}
+
+	now := m.now()
+	expiryTime := neverExpires
+	if ttlSeconds != NoExpiration {
+		expiryTime = now + int64(time.Second*time.Duration(ttlSeconds))
+	}
+	el, ok := m.elements[key]
+	if !ok {
+		m.insert(key, value, expiryTime)
+		return value, nil
+	}
+	if el.heapEl.Priority <= now {
+		el.value = value
+		m.expiryTimes.UpdateEl(&el.heapEl, expiryTime)
+		return value, nil
+	}
+	current, ok := el.value.(int)
+	if !ok {
+		return 0, fmt.Errorf("Expected existing value to be integer, got %T", el.value)
+	}
+	el.value = current + value
+	m.expiryTimes.UpdateEl(&el.heapEl, expiryTime)
+	return current + value, nil
+}
+
+func (m *Uint64Map) Delete(key uint64) bool {
+	if m.mutex != nil {
+		m.mutex.Lock()
+		defer m.mutex.Unlock()
+	}
+
+	el, ok := m.elements[key]
+	if !ok {
+		return false
+	}
+	if el.heapEl.Priority <= m.now() {
+		m.expire(el)
+		return false
+	}
+	m.remove(el)
+	return true
+}
+
+// RemoveExpired removes up to max expired elements, all of them if max <= 0,
+// and returns their number
+func (m *Uint64Map) RemoveExpired(max int) int {
+	if m.mutex != nil {
+		m.mutex.Lock()
+		defer m.mutex.Unlock()
+	}
+
+	now := m.now()
+	removed := 0
+	for m.expiryTimes.Len() > 0 && (max <= 0 || removed < max) {
+		heapEl := m.expiryTimes.PeekEl()
+		if heapEl.Priority > now {
+			break
+		}
+		m.expire(heapEl.Value.(*uint64Element))
+		removed += 1
+	}
+	return removed
+}
+
+// Len returns the number of elements, including the expired ones that were
+// not removed yet
+func (m *Uint64Map) Len() int {
+	if m.mutex != nil {
+		m.mutex.RLock()
+		defer m.mutex.RUnlock()
+	}
+	return len(m.elements)
+}
+
+func (m *Uint64Map) Capacity() int {
+	return m.capacity
+}
+
+// Clear removes all elements without calling the expiration callback
+func (m *Uint64Map) Clear() {
+	if m.mutex != nil {
+		m.mutex.Lock()
+		defer m.mutex.Unlock()
+	}
+
+	m.elements = make(map[uint64]*uint64Element)
+	h := make(minHeap, 0)
+	m.expiryTimes = &h
+}
+
+func (m *Uint64Map) lockNGet(key uint64) (value interface{}, expiryTime int64, found bool) {
+	if m.mutex != nil {
+		m.mutex.RLock()
+		defer m.mutex.RUnlock()
+	}
+
+	el, ok := m.elements[key]
+	if !ok {
+		return nil, 0, false
+	}
+	return el.value, el.heapEl.Priority, true
+}
+
+// lockNExpire removes the element with the given key if it is still expired,
+// it may have been set again since it was read
+func (m *Uint64Map) lockNExpire(key uint64, now int64) {
+	if m.mutex != nil {
+		m.mutex.Lock()
+		defer m.mutex.Unlock()
+	}
+
+	if el, ok := m.elements[key]; ok && el.heapEl.Priority <= now {
+		m.expire(el)
+	}
+}
+
+// insert adds an element with a key that is not in the map, evicting one if
+// the map is full
+func (m *Uint64Map) insert(key uint64, value interface{}, expiryTime int64) {
+	if len(m.elements) >= m.capacity {
+		m.evict()
+	}
+	el := &uint64Element{key: key, value: value}
+	el.heapEl.Value = el
+	el.heapEl.Priority = expiryTime
+	m.elements[key] = el
+	m.expiryTimes.PushEl(&el.heapEl)
+}
+
+// evict makes room for an element, removing the soonest expiring one
+// without calling the expiration callback, even if it has expired
+func (m *Uint64Map) evict() {
+	m.remove(m.expiryTimes.PeekEl().Value.(*uint64Element))
+}
+
+func (m *Uint64Map) expire(el *uint64Element) {
+	m.remove(el)
+	if m.onExpire != nil {
+		m.onExpire(el.key, el.value)
+	}
+}
+
+func (m *Uint64Map) remove(el *uint64Element) {
+	delete(m.elements, el.key)
+	m.expiryTimes.RemoveEl(&el.heapEl)
+}
+
+func (m *Uint64Map) currentTime() time.Time {
+	if m.monotonic {
+		return time.Now()
+	}
+	return m.clock.UtcNow()
+}
+
+// now returns the current time in nanoseconds since the map was created
+func (m *Uint64Map) now() int64 {
+	return int64(m.currentTime().Sub(m.base))
+}
@@ -0,0 +1,143 @@
+package ttlmap
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+func (s *TestSuite) newUint64Map(capacity int, opts ...Uint64MapOption) *Uint64Map {
+	opts = append(opts, Uint64Clock(s.timeProvider))
+	m, err := NewConcurrentUint64Map(capacity, opts...)
+	if err != nil {
+		panic(err)
+	}
+	return m
+}
+
+func (s *TestSuite) TestUint64Map(c *C) {
+	_, err := NewUint64Map(0)
+	c.Assert(err, NotNil)
+
+	var expired []uint64
+	m := s.newUint64Map(3, Uint64OnExpire(func(key uint64, value interface{}) {
+		expired = append(expired, key)
+	}))
+
+	c.Assert(m.Set(1, "a", 1), IsNil)
+	c.Assert(m.Set(1<<63, "b", 5), IsNil)
+	c.Assert(m.Set(3, "c", NoExpiration), IsNil)
+	c.Assert(m.Set(4, "d", 0), NotNil)
+
+	value, ttl, exists := m.GetWithTTL(1 << 63)
+	c.Assert(exists, Equals, true)
+	c.Assert(value, Equals, "b")
+	c.Assert(ttl, Equals, 5*time.Second)
+	_, ttl, _ = m.GetWithTTL(3)
+	c.Assert(ttl, Equals, time.Duration(0))
+
+	s.advanceSeconds(1)
+	_, exists = m.Get(1)
+	c.Assert(exists, Equals, false)
+	c.Assert(expired, DeepEquals, []uint64{1})
+	c.Assert(m.Len(), Equals, 2)
+
+	// The soonest expiring element is evicted when the map is full
+	m.Set(4, "d", 10)
+	m.Set(5, "e", 10)
+	c.Assert(m.Contains(1<<63), Equals, false)
+	c.Assert(m.Contains(3), Equals, true)
+	c.Assert(m.Len(), Equals, 3)
+
+	c.Assert(m.Delete(3), Equals, true)
+	c.Assert(m.Delete(3), Equals, false)
+
+	s.advanceSeconds(10)
+	c.Assert(m.RemoveExpired(1), Equals, 1)
+	c.Assert(m.RemoveExpired(0), Equals, 1)
+	c.Assert(m.Len(), Equals, 0)
+}
+
+func (s *TestSuite) TestUint64MapIncrement(c *C) {
+	m := s.newUint64Map(10)
+
+	value, err := m.Increment(1, 2, 1)
+	c.Assert(err, IsNil)
+	c.Assert(value, Equals, 2)
+	value, _ = m.Increment(1, 3, 1)
+	c.Assert(value, Equals, 5)
+
+	s.advanceSeconds(1)
+	value, _ = m.Increment(1, 1, 1)
+	c.Assert(value, Equals, 1)
+
+	m.Set(2, "a", 10)
+	_, err = m.Increment(2, 1, 10)
+	c.Assert(err, NotNil)
+
+	m.Clear()
+	c.Assert(m.Len(), Equals, 0)
+}
+
+// The expiration callback fires on the same paths for both maps
+func (s *TestSuite) TestUint64MapCallbacksMatchTtlMap(c *C) {
+	scenarios := []struct {
+		name    string
+		ttlMap  func(m *TtlMap)
+		uint64  func(m *Uint64Map)
+		expired int
+	}{
+		{"get", func(m *TtlMap) { m.Get("1") }, func(m *Uint64Map) { m.Get(1) }, 1},
+		{"delete", func(m *TtlMap) { m.Delete("1") }, func(m *Uint64Map) { m.Delete(1) }, 1},
+		{"remove expired", func(m *TtlMap) { m.RemoveExpired(0) }, func(m *Uint64Map) { m.RemoveExpired(0) }, 1},
+		{"set", func(m *TtlMap) { m.Set("1", 3, 10) }, func(m *Uint64Map) { m.Set(1, 3, 10) }, 0},
+		{"increment", func(m *TtlMap) { m.Increment("1", 3, 10) }, func(m *Uint64Map) { m.Increment(1, 3, 10) }, 0},
+		{"evict", func(m *TtlMap) { m.Set("3", 3, 10) }, func(m *Uint64Map) { m.Set(3, 3, 10) }, 0},
+	}
+	for _, scenario := range scenarios {
+		var ttlMapExpired, uint64Expired []interface{}
+		m := s.newMap(2, CallOnExpire(func(key string, value interface{}) {
+			ttlMapExpired = append(ttlMapExpired, value)
+		}))
+		u := s.newUint64Map(2, Uint64OnExpire(func(key uint64, value interface{}) {
+			uint64Expired = append(uint64Expired, value)
+		}))
+		m.Set("1", 1, 1)
+		m.Set("2", 2, 5)
+		u.Set(1, 1, 1)
+		u.Set(2, 2, 5)
+		s.advanceSeconds(1)
+
+		scenario.ttlMap(m)
+		scenario.uint64(u)
+		c.Assert(ttlMapExpired, HasLen, scenario.expired, Commentf(scenario.name))
+		c.Assert(uint64Expired, DeepEquals, ttlMapExpired, Commentf(scenario.name))
+		c.Assert(u.Len(), Equals, m.Len(), Commentf(scenario.name))
+	}
+}
+
+func BenchmarkUint64MapGet(b *testing.B) {
+	m, _ := NewUint64Map(1000)
+	for i := uint64(0); i < 1000; i += 1 {
+		m.Set(i, i, 60)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i += 1 {
+		m.Get(uint64(i % 1000))
+	}
+}
+
+func BenchmarkUint64KeysInTtlMap(b *testing.B) {
+	m, _ := NewMap(1000)
+	keys := make([]string, 1000)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("%d", uint64(1)<<40+uint64(i))
+		m.Set(keys[i], i, 60)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i += 1 {
+		m.Get(keys[i%1000])
+	}
+}
@@ -0,0 +1,132 @@
+package ttlmap
+
+import (
+	"container/list"
+	"fmt"
+	"time"
+)
+
+// TimingWheel replaces the expiry heap with a timing wheel of the given
+// resolution. Elements are scheduled into buckets covering resolution worth
+// of expiry times, so setting or touching an element costs O(1) as long as
+// its bucket already exists, and only the much smaller set of non-empty
+// buckets is kept ordered. In exchange elements within a bucket are not
+// ordered: the reaper and capacity eviction may remove them up to one
+// resolution out of order. Reads still honor exact expiry times.
+func TimingWheel(resolution time.Duration) TtlMapOption {
+	return func(m *TtlMap) error {
+		if resolution <= 0 {
+			return fmt.Errorf("Timing wheel resolution should be > 0, got %v", resolution)
+		}
+		m.wheelResolution = resolution
+		return nil
+	}
+}
+
+type timingWheel struct {
+	resolution int64
+	buckets    map[int64]*wheelBucket
+	// slots orders the non-empty buckets
+	slots *minHeap
+	len   int
+}
+
+type wheelBucket struct {
+	slot     int64
+	elements *list.List
+	heapEl   *heapElement
+}
+
+func newTimingWheel(resolution time.Duration) *timingWheel {
+	return &timingWheel{
+		resolution: int64(resolution),
+		buckets:    make(map[int64]*wheelBucket),
+		slots:      newMinHeap(),
+	}
+}
+
+func (w *timingWheel) slotOf(priority int64) int64 {
+	slot := priority / w.resolution
+	if priority < 0 && priority%w.resolution != 0 {
+		slot -= 1
+	}
+	return slot
+}
+
+func (w *timingWheel) Len() int {
+	return w.len
+}
+
+func (w *timingWheel) PushEl(el *heapElement) {
+	slot := w.slotOf(el.Priority)
+	b, ok := w.buckets[slot]
+	if !ok {
+		b = &wheelBucket{slot: slot, elements: list.New()}
+		b.heapEl = &heapElement{Value: b, Priority: slot}
+		w.buckets[slot] = b
+		w.slots.PushEl(b.heapEl)
+	}
+	el.Value.(*mapElement).wheelEl = b.elements.PushBack(el)
+	w.len += 1
+}
+
+func (w *timingWheel) PopEl() *heapElement {
+	el := w.PeekEl()
+	w.RemoveEl(el)
+	return el
+}
+
+func (w *timingWheel) PeekEl() *heapElement {
+	b := w.slots.PeekEl().Value.(*wheelBucket)
+	return b.elements.Front().Value.(*heapElement)
+}
+
+func (w *timingWheel) UpdateEl(el *heapElement, priority int64) {
+	if w.slotOf(priority) == w.slotOf(el.Priority) {
+		el.Priority = priority
+		return
+	}
+	w.RemoveEl(el)
+	el.Priority = priority
+	w.PushEl(el)
+}
+
+func (w *timingWheel) RemoveEl(el *heapElement) {
+	b := w.buckets[w.slotOf(el.Priority)]
+	mapEl := el.Value.(*mapElement)
+	b.elements.Remove(mapEl.wheelEl)
+	mapEl.wheelEl = nil
+	w.len -= 1
+	if b.elements.Len() == 0 {
+		delete(w.buckets, b.slot)
+		w.slots.RemoveEl(b.heapEl)
+	}
+}
+
+func (w *timingWheel) ForEach(fn func(el *heapElement) bool) {
+	for _, b := range w.buckets {
+		for e := b.elements.Front(); e != nil; e = e.Next() {
+			if !fn(e.Value.(*heapElement)) {
+				return
+			}
+		}
+	}
+}
+
+func (w *timingWheel) CountExpired(now int64) int {
+	count := 0
+	nowSlot := w.slotOf(now)
+	for slot, b := range w.buckets {
+		switch {
+		case slot < nowSlot:
+			count += b.elements.Len()
+		case slot == nowSlot:
+			for e := b.elements.Front(); e != nil; e = e.Next() {
+				if e.Value.(*heapElement).Priority <= now {
+					count += 1
+				}
+			}
+		}
+	}
+	return count
+}
@@ -0,0 +1,112 @@
+package ttlmap
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+func (s *TestSuite) TestTimingWheelValidation(c *C) {
+	_, err := NewMap(1, TimingWheel(0))
+	c.Assert(err, Not(Equals), nil)
+}
+
+func (s *TestSuite) TestTimingWheelGetSetExpire(c *C) {
+	m := s.newMap(3, TimingWheel(time.Second))
+
+	m.Set("a", 1, 1)
+	m.SetWithDuration("b", 2, 1500*time.Millisecond)
+	m.Set("c", 3, 5)
+
+	wheel := m.expiryTimes.(*timingWheel)
+	c.Assert(wheel.Len(), Equals, 3)
+	c.Assert(len(wheel.buckets), Equals, 2)
+
+	s.advance(time.Second)
+
+	_, exists := m.Get("a")
+	c.Assert(exists, Equals, false)
+
+	// Reads are exact even though b shares a bucket with a
+	valI, exists := m.Get("b")
+	c.Assert(exists, Equals, true)
+	c.Assert(valI, Equals, 2)
+	c.Assert(m.LiveLen(), Equals, 2)
+
+	s.advance(500 * time.Millisecond)
+
+	_, exists = m.Get("b")
+	c.Assert(exists, Equals, false)
+	c.Assert(m.Len(), Equals, 1)
+	c.Assert(wheel.Len(), Equals, 1)
+	c.Assert(len(wheel.buckets), Equals, 1)
+}
+
+func (s *TestSuite) TestTimingWheelTouchWithinBucket(c *C) {
+	m := s.newMap(1, TimingWheel(time.Minute))
+
+	m.Set("a", 1, 1)
+	heapEl := &m.elements["a"].heapEl
+	wheel := m.expiryTimes.(*timingWheel)
+	bucket := wheel.buckets[wheel.slotOf(heapEl.Priority)]
+
+	c.Assert(m.Touch("a", 10), Equals, true)
+	c.Assert(wheel.buckets[wheel.slotOf(heapEl.Priority)], Equals, bucket)
+
+	expiresAt, _ := m.ExpiresAt("a")
+	c.Assert(expiresAt, Equals, s.timeProvider.UtcNow().Add(10*time.Second))
+
+	c.Assert(m.Touch("a", 120), Equals, true)
+	c.Assert(wheel.buckets[wheel.slotOf(heapEl.Priority)], Not(Equals), bucket)
+	c.Assert(len(wheel.buckets), Equals, 1)
+}
+
+func (s *TestSuite) TestTimingWheelEviction(c *C) {
+	m := s.newMap(2, TimingWheel(time.Second))
+
+	m.Set("a", 1, 5)
+	m.Set("b", 2, 6)
+	m.Set("c", 3, 7)
+
+	c.Assert(m.Contains("a"), Equals, false)
+	c.Assert(m.Contains("b"), Equals, true)
+	c.Assert(m.Contains("c"), Equals, true)
+
+	s.advanceSeconds(6)
+
+	removed := m.RemoveExpired(0)
+	c.Assert(removed, HasLen, 1)
+	c.Assert(removed[0].Key, Equals, "b")
+}
+
+func (s *TestSuite) TestTimingWheelClearAndSample(c *C) {
+	m := s.newMap(10, TimingWheel(time.Second))
+
+	for i := 0; i < 10; i += 1 {
+		m.Set(fmt.Sprintf("k%d", i), i, 1+i%2)
+	}
+
+	s.advanceSeconds(1)
+
+	sample := m.RandomSample(10)
+	sort.Strings(sample)
+	c.Assert(sample, DeepEquals, []string{"k1", "k3", "k5", "k7", "k9"})
+
+	m.Clear()
+	_, ok := m.expiryTimes.(*timingWheel)
+	c.Assert(ok, Equals, true)
+	c.Assert(m.expiryTimes.Len(), Equals, 0)
+	_, ok = m.RandomKey()
+	c.Assert(ok, Equals, false)
+}
+
+func (s *TestSuite) TestTimingWheelNegativeSlots(c *C) {
+	wheel := newTimingWheel(10)
+	c.Assert(wheel.slotOf(-1), Equals, int64(-1))
+	c.Assert(wheel.slotOf(-10), Equals, int64(-1))
+	c.Assert(wheel.slotOf(-11), Equals, int64(-2))
+	c.Assert(wheel.slotOf(0), Equals, int64(0))
+	c.Assert(wheel.slotOf(19), Equals, int64(1))
+}
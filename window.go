@@ -0,0 +1,112 @@
+package ttlmap
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// HitRatioWindows makes Stats report the hits and misses over the given
+// rolling windows, e.g. the last minute and the last hour, next to the
+// lifetime counters. Each window is counted in windowBuckets buckets, so it
+// covers the given duration minus up to one bucket. Lookups take a mutex to
+// count, which readers otherwise never share.
+func HitRatioWindows(windows ...time.Duration) TtlMapOption {
+	return func(m *TtlMap) error {
+		if len(windows) == 0 {
+			return errors.New("Hit ratio windows should not be empty")
+		}
+		m.hitWindows = &hitWindows{}
+		for _, window := range windows {
+			if window < windowBuckets {
+				return fmt.Errorf("Hit ratio window should be >= %v, got %v", time.Duration(windowBuckets), window)
+			}
+			m.hitWindows.windows = append(m.hitWindows.windows, &hitWindow{
+				length:  window,
+				bucket:  int64(window / windowBuckets),
+				buckets: make([]hitBucket, windowBuckets),
+			})
+		}
+		return nil
+	}
+}
+
+// WindowStats are the lookups over a rolling window
+type WindowStats struct {
+	Window time.Duration
+	Hits   uint64
+	Misses uint64
+	// HitRatio is the share of the lookups that were hits, 0 without any
+	HitRatio float64
+}
+
+// windowBuckets is the number of buckets a window is counted in
+const windowBuckets = 60
+
+type hitWindows struct {
+	mutex   sync.Mutex
+	windows []*hitWindow
+}
+
+type hitWindow struct {
+	length time.Duration
+	// bucket is the length of a bucket in the units of the expiry heap
+	// priorities
+	bucket  int64
+	buckets []hitBucket
+}
+
+type hitBucket struct {
+	// start identifies the bucket, buckets of older starts are stale
+	start  int64
+	hits   uint64
+	misses uint64
+}
+
+func (h *hitWindows) record(now int64, hits, misses uint64) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	for _, w := range h.windows {
+		b := w.current(now)
+		b.hits += hits
+		b.misses += misses
+	}
+}
+
+// current returns the bucket of now, reset if it held an older one
+func (w *hitWindow) current(now int64) *hitBucket {
+	start := now - now%w.bucket
+	b := &w.buckets[(start/w.bucket)%int64(len(w.buckets))]
+	if b.start != start {
+		*b = hitBucket{start: start}
+	}
+	return b
+}
+
+func (h *hitWindows) stats(now int64) []WindowStats {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	stats := make([]WindowStats, len(h.windows))
+	for i, w := range h.windows {
+		oldest := now - now%w.bucket - int64(len(w.buckets)-1)*w.bucket
+		stats[i].Window = w.length
+		for _, b := range w.buckets {
+			if b.start >= oldest && b.start <= now {
+				stats[i].Hits += b.hits
+				stats[i].Misses += b.misses
+			}
+		}
+		stats[i].HitRatio = hitRatio(stats[i].Hits, stats[i].Misses)
+	}
+	return stats
+}
+
+func hitRatio(hits, misses uint64) float64 {
+	if hits+misses == 0 {
+		return 0
+	}
+	return float64(hits) / float64(hits+misses)
+}
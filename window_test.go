@@ -0,0 +1,51 @@
+package ttlmap
+
+import (
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+func (s *TestSuite) TestHitRatioWindows(c *C) {
+	m := s.newMap(10, HitRatioWindows(time.Minute, time.Hour))
+	m.Set("a", 1, NoExpiration)
+
+	// An hour ago everything missed
+	for i := 0; i < 3; i += 1 {
+		m.Get("b")
+	}
+	s.advance(time.Hour - 2*time.Minute)
+	m.Get("a")
+	m.GetMany([]string{"a", "b"})
+	s.advance(2*time.Minute + time.Second)
+	m.Get("a")
+
+	stats := m.Stats()
+	c.Assert(stats.Hits, Equals, uint64(3))
+	c.Assert(stats.Misses, Equals, uint64(4))
+	c.Assert(stats.Windows, DeepEquals, []WindowStats{
+		{Window: time.Minute, Hits: 1, HitRatio: 1},
+		{Window: time.Hour, Hits: 3, Misses: 1, HitRatio: 0.75},
+	})
+
+	s.advance(2 * time.Hour)
+	c.Assert(m.Stats().Windows, DeepEquals, []WindowStats{
+		{Window: time.Minute},
+		{Window: time.Hour},
+	})
+
+	_, err := NewMap(10, HitRatioWindows())
+	c.Assert(err, NotNil)
+	_, err = NewMap(10, HitRatioWindows(time.Nanosecond))
+	c.Assert(err, NotNil)
+}
+
+func (s *TestSuite) TestShardedHitRatioWindows(c *C) {
+	sm := s.newShardedMap(16, Shards(4), HitRatioWindows(time.Minute))
+	sm.Set("a", 1, 10)
+	sm.Get("a")
+	sm.Get("b")
+	sm.Get("c")
+	sm.Get("d")
+	c.Assert(sm.Stats().Windows, DeepEquals, []WindowStats{{Window: time.Minute, Hits: 1, Misses: 3, HitRatio: 0.25}})
+}